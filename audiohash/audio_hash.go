@@ -0,0 +1,177 @@
+// Package audiohash provides utilities for computing spectrogram-based
+// fingerprints of audio, for near-duplicate detection.
+package audiohash
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// Config holds the spectrogram parameters used for fingerprinting.
+type Config struct {
+	// SampleRate is the rate the signal is resampled to before analysis.
+	SampleRate int
+	// FrameSize is the FFT window length in samples; it must be a power of two.
+	FrameSize int
+	// HopSize is the number of samples between consecutive frames.
+	HopSize int
+	// MinFrequency and MaxFrequency bound the analysed band in Hz.
+	MinFrequency float64
+	MaxFrequency float64
+}
+
+var defaultConfig = Config{
+	SampleRate:   5512,
+	FrameSize:    2048,
+	HopSize:      64,
+	MinFrequency: 300,
+	MaxFrequency: 2000,
+}
+
+// bands is the number of mel bands per frame. Adjacent band differences
+// yield bands-1 = 32 bits per frame.
+const bands = 33
+
+var ErrTooShort = errors.New("audio is shorter than one analysis frame")
+
+// Fingerprint is a sequence of 32-bit sub-fingerprints, one per frame.
+type Fingerprint []uint32
+
+// FromPath computes the fingerprint of the audio file at filePath.
+// It optionally accepts a custom configuration.
+func FromPath(filePath string, configs ...Config) (Fingerprint, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return FromReader(f, configs...)
+}
+
+// FromReader decodes r with a registered format and computes its fingerprint.
+// It optionally accepts a custom configuration.
+func FromReader(r io.Reader, configs ...Config) (Fingerprint, error) {
+	if len(configs) > 0 {
+		if err := configs[0].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	audio, _, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromAudio(audio, configs...)
+}
+
+// FromAudio computes the fingerprint of decoded audio.
+// It optionally accepts a custom configuration.
+func FromAudio(audio *Audio, configs ...Config) (Fingerprint, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	// 1. Resample to the analysis rate
+	samples := resample(audio.Samples, audio.SampleRate, config.SampleRate)
+	if len(samples) < config.FrameSize {
+		return nil, ErrTooShort
+	}
+
+	// 2. Compute mel band energies per frame
+	energies := bandEnergies(samples, config)
+
+	// 3. Derive one sub-fingerprint per frame from energy differences
+	fingerprint := make(Fingerprint, len(energies)-1)
+	for t := 1; t < len(energies); t++ {
+		var bits uint32
+		for b := 0; b < bands-1; b++ {
+			delta := (energies[t][b] - energies[t][b+1]) - (energies[t-1][b] - energies[t-1][b+1])
+			if delta > 0 {
+				bits |= 1 << b
+			}
+		}
+		fingerprint[t-1] = bits
+	}
+
+	return fingerprint, nil
+}
+
+// resample converts samples from one rate to another using linear
+// interpolation.
+func resample(samples []float64, from, to int) []float64 {
+	if from == to || from <= 0 {
+		return samples
+	}
+
+	ratio := float64(from) / float64(to)
+	out := make([]float64, int(float64(len(samples))/ratio))
+	for i := range out {
+		pos := float64(i) * ratio
+		j := int(pos)
+		frac := pos - float64(j)
+		next := j
+		if j+1 < len(samples) {
+			next = j + 1
+		}
+		out[i] = samples[j]*(1-frac) + samples[next]*frac
+	}
+	return out
+}
+
+// bandEnergies computes the log energy of each mel band for every frame.
+func bandEnergies(samples []float64, config Config) [][bands]float64 {
+	edges := melEdges(config)
+
+	window := make([]float64, config.FrameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(config.FrameSize-1))
+	}
+
+	frames := (len(samples)-config.FrameSize)/config.HopSize + 1
+	energies := make([][bands]float64, frames)
+	spectrum := make([]complex128, config.FrameSize)
+	for t := range frames {
+		offset := t * config.HopSize
+		for i := range spectrum {
+			spectrum[i] = complex(samples[offset+i]*window[i], 0)
+		}
+		fft(spectrum)
+
+		for b := range bands {
+			var energy float64
+			for k := edges[b]; k < edges[b+1]; k++ {
+				re, im := real(spectrum[k]), imag(spectrum[k])
+				energy += re*re + im*im
+			}
+			energies[t][b] = math.Log1p(energy)
+		}
+	}
+	return energies
+}
+
+// melEdges returns the FFT bin boundaries of the mel-spaced bands.
+func melEdges(config Config) [bands + 1]int {
+	toMel := func(f float64) float64 { return 2595 * math.Log10(1+f/700) }
+	fromMel := func(m float64) float64 { return 700 * (math.Pow(10, m/2595) - 1) }
+
+	low, high := toMel(config.MinFrequency), toMel(config.MaxFrequency)
+	binWidth := float64(config.SampleRate) / float64(config.FrameSize)
+
+	var edges [bands + 1]int
+	for i := range edges {
+		freq := fromMel(low + (high-low)*float64(i)/bands)
+		edges[i] = int(math.Round(freq / binWidth))
+		if i > 0 && edges[i] <= edges[i-1] {
+			edges[i] = edges[i-1] + 1
+		}
+	}
+	return edges
+}
@@ -0,0 +1,40 @@
+package audiohash
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidConfig is wrapped by the errors of Config.Validate.
+var ErrInvalidConfig = errors.New("invalid audio hash config")
+
+// Validate reports every problem with the configuration, so mistakes
+// surface before any decoding work. The fingerprinting functions call it
+// automatically.
+func (c Config) Validate() error {
+	var errs []error
+	if c.SampleRate <= 0 {
+		errs = append(errs, fmt.Errorf("%w: SampleRate %d is not positive", ErrInvalidConfig, c.SampleRate))
+	}
+	if c.FrameSize < 2 || c.FrameSize&(c.FrameSize-1) != 0 {
+		errs = append(errs, fmt.Errorf("%w: FrameSize %d is not a power of two", ErrInvalidConfig, c.FrameSize))
+	}
+	if c.HopSize <= 0 {
+		errs = append(errs, fmt.Errorf("%w: HopSize %d is not positive", ErrInvalidConfig, c.HopSize))
+	}
+	if c.MinFrequency < 0 || c.MinFrequency >= c.MaxFrequency {
+		errs = append(errs, fmt.Errorf("%w: frequency band %g-%g Hz is empty", ErrInvalidConfig, c.MinFrequency, c.MaxFrequency))
+	}
+	if nyquist := float64(c.SampleRate) / 2; c.MaxFrequency > nyquist {
+		errs = append(errs, fmt.Errorf("%w: MaxFrequency %g Hz is above the Nyquist frequency %g Hz", ErrInvalidConfig, c.MaxFrequency, nyquist))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// Every band needs its own FFT bins below the Nyquist frequency.
+	if edges := melEdges(c); edges[bands] > c.FrameSize/2 {
+		return fmt.Errorf("%w: FrameSize %d is too small for %d bands between %g and %g Hz", ErrInvalidConfig, c.FrameSize, bands, c.MinFrequency, c.MaxFrequency)
+	}
+	return nil
+}
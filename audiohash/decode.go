@@ -0,0 +1,106 @@
+package audiohash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Audio is a decoded mono signal with samples in the range [-1, 1].
+type Audio struct {
+	SampleRate int
+	Samples    []float64
+}
+
+// DecodeFunc decodes an audio stream into mono samples.
+type DecodeFunc func(r io.Reader) (*Audio, error)
+
+type format struct {
+	name   string
+	magic  string
+	decode DecodeFunc
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []format
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("audio format is not supported")
+	// ErrDecoderPanic is returned when a decoder panics on malformed input.
+	ErrDecoderPanic = errors.New("audio decoder panicked")
+)
+
+// RegisterFormat registers an audio format for use by Decode, in the same
+// manner as image.RegisterFormat. Magic is the prefix that identifies the
+// format's encoding; '?' matches any byte. Decoders for compressed formats
+// such as MP3 can be plugged in this way without this package depending on
+// them.
+func RegisterFormat(name, magic string, decode DecodeFunc) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	formats = append(formats, format{name: name, magic: magic, decode: decode})
+}
+
+// Formats returns the names of the registered formats, in registration
+// order.
+func Formats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.name
+	}
+	return names
+}
+
+// Decode decodes an audio stream using the registered format matching its
+// leading bytes, and returns the format name.
+func Decode(r io.Reader) (*Audio, string, error) {
+	br := bufio.NewReader(r)
+
+	formatsMu.RLock()
+	candidates := append([]format(nil), formats...)
+	formatsMu.RUnlock()
+
+	for _, f := range candidates {
+		head, err := br.Peek(len(f.magic))
+		if err != nil || !matchMagic(f.magic, head) {
+			continue
+		}
+
+		audio, err := safeDecode(f.decode, br)
+		if err != nil {
+			return nil, f.name, err
+		}
+		return audio, f.name, nil
+	}
+
+	return nil, "", ErrUnsupportedFormat
+}
+
+func matchMagic(magic string, head []byte) bool {
+	for i := range len(magic) {
+		if magic[i] != '?' && magic[i] != head[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// safeDecode calls decode, converting a panic into an error so one corrupt
+// file cannot crash a batch run.
+func safeDecode(decode DecodeFunc, r io.Reader) (audio *Audio, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			audio, err = nil, fmt.Errorf("%w: %v", ErrDecoderPanic, p)
+		}
+	}()
+
+	return decode(r)
+}
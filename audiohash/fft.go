@@ -0,0 +1,35 @@
+package audiohash
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// fft performs an in-place radix-2 Fast Fourier Transform. The length of x
+// must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	shift := 64 - uint(bits.Len(uint(n))-1)
+
+	for i := range n {
+		j := int(bits.Reverse64(uint64(i)) >> shift)
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := range size / 2 {
+				even := x[start+k]
+				odd := w * x[start+k+size/2]
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package audiohash
+
+import "bytes"
+
+// FuzzDecodeAndHash decodes data with the registered formats and
+// fingerprints it, as a fuzz target for testing.F or go-fuzz. Malformed
+// input must only produce errors, so any panic is a bug that would crash
+// batch jobs. Following the go-fuzz convention, it returns 1 for inputs
+// that were fingerprinted and 0 otherwise.
+func FuzzDecodeAndHash(data []byte) int {
+	audio, _, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	if _, err := FromAudio(audio); err != nil {
+		return 0
+	}
+	return 1
+}
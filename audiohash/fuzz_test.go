@@ -0,0 +1,44 @@
+package audiohash_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/insomnius/tools/audiohash"
+)
+
+// wav returns a mono 16-bit PCM WAV stream of a square wave.
+func wav(samples int) []byte {
+	data := make([]byte, 2*samples)
+	for i := range samples {
+		value := int16(8000)
+		if i/20%2 == 1 {
+			value = -8000
+		}
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(value))
+	}
+
+	b := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1)    // PCM
+	b = binary.LittleEndian.AppendUint16(b, 1)    // channels
+	b = binary.LittleEndian.AppendUint32(b, 8000) // sample rate
+	b = binary.LittleEndian.AppendUint32(b, 16000)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 16)
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
+
+func FuzzDecodeAndHash(f *testing.F) {
+	f.Add(wav(16000))
+	f.Add(wav(100))
+	f.Add(wav(16000)[:60])
+	f.Add([]byte("RIFF\x00\x00\x00\x00WAVEdata\xff\xff\xff\xff"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		audiohash.FuzzDecodeAndHash(data)
+	})
+}
@@ -0,0 +1,151 @@
+package audiohash
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// MatchConfig holds options for comparing fingerprints.
+type MatchConfig struct {
+	// MaxOffset is the largest alignment shift, in frames, that is searched.
+	MaxOffset int
+	// MinOverlap is the minimum number of overlapping frames for a score.
+	MinOverlap int
+	// Threshold is the maximum bit error rate for two fingerprints to match.
+	Threshold float64
+}
+
+var defaultMatchConfig = MatchConfig{
+	MaxOffset:  512,
+	MinOverlap: 128,
+	Threshold:  0.35,
+}
+
+// Match describes the best alignment between two fingerprints.
+type Match struct {
+	// Offset is the shift of b relative to a, in frames.
+	Offset int
+	// BitErrorRate is the fraction of differing bits at Offset; 0 means
+	// identical and about 0.5 means unrelated.
+	BitErrorRate float64
+}
+
+// Compare finds the alignment of b against a with the lowest bit error rate.
+// It optionally accepts a custom configuration.
+func Compare(a, b Fingerprint, configs ...MatchConfig) Match {
+	config := defaultMatchConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	best := Match{BitErrorRate: 1}
+	for offset := -config.MaxOffset; offset <= config.MaxOffset; offset++ {
+		startA, startB := max(offset, 0), max(-offset, 0)
+		overlap := min(len(a)-startA, len(b)-startB)
+		if overlap < config.MinOverlap || overlap <= 0 {
+			continue
+		}
+
+		var differing int
+		for i := range overlap {
+			differing += bits.OnesCount32(a[startA+i] ^ b[startB+i])
+		}
+
+		rate := float64(differing) / float64(overlap*32)
+		if rate < best.BitErrorRate {
+			best = Match{Offset: offset, BitErrorRate: rate}
+		}
+	}
+	return best
+}
+
+// Matcher finds near-duplicates of a fingerprint among a set of references.
+type Matcher struct {
+	config     MatchConfig
+	names      []string
+	references []Fingerprint
+}
+
+// Result is a reference that matched a query.
+type Result struct {
+	Name string
+	Match
+}
+
+// NewMatcher returns an empty Matcher.
+// It optionally accepts a custom configuration.
+func NewMatcher(configs ...MatchConfig) *Matcher {
+	config := defaultMatchConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	return &Matcher{config: config}
+}
+
+// Add registers a reference fingerprint under name.
+func (m *Matcher) Add(name string, fingerprint Fingerprint) {
+	m.names = append(m.names, name)
+	m.references = append(m.references, fingerprint)
+}
+
+// Find returns the references matching query within the threshold, best
+// match first.
+func (m *Matcher) Find(query Fingerprint) []Result {
+	var results []Result
+	for i, reference := range m.references {
+		match := Compare(reference, query, m.config)
+		if match.BitErrorRate <= m.config.Threshold {
+			results = append(results, Result{Name: m.names[i], Match: match})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].BitErrorRate < results[j].BitErrorRate
+	})
+	return results
+}
+
+// Clusters links references that match each other within the threshold and
+// returns the groups of names with more than one member.
+func (m *Matcher) Clusters() [][]string {
+	parent := make([]int, len(m.references))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := 0; i < len(m.references); i++ {
+		for j := i + 1; j < len(m.references); j++ {
+			if find(i) == find(j) {
+				continue
+			}
+			if Compare(m.references[i], m.references[j], m.config).BitErrorRate <= m.config.Threshold {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	groups := map[int][]string{}
+	var roots []int
+	for i, name := range m.names {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], name)
+	}
+
+	var clusters [][]string
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			clusters = append(clusters, groups[root])
+		}
+	}
+	return clusters
+}
@@ -0,0 +1,128 @@
+package audiohash
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+var ErrInvalidWAV = errors.New("invalid or unsupported WAV stream")
+
+func init() {
+	RegisterFormat("wav", "RIFF????WAVE", decodeWAV)
+}
+
+// decodeWAV decodes PCM and IEEE float WAV streams, mixing all channels
+// down to mono.
+func decodeWAV(r io.Reader) (*Audio, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	var (
+		formatTag  uint16
+		channels   int
+		sampleRate int
+		bitDepth   int
+		haveFormat bool
+	)
+
+	for {
+		var chunkHeader [8]byte
+		if _, err := io.ReadFull(r, chunkHeader[:]); err != nil {
+			return nil, ErrInvalidWAV
+		}
+		id := string(chunkHeader[:4])
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+
+		switch id {
+		case "fmt ":
+			// Chunks are read incrementally rather than allocated from the
+			// declared size, which malformed files can set to 4 GiB.
+			body, err := io.ReadAll(io.LimitReader(r, size))
+			if err != nil || int64(len(body)) != size || size < 16 {
+				return nil, ErrInvalidWAV
+			}
+			formatTag = binary.LittleEndian.Uint16(body[0:])
+			channels = int(binary.LittleEndian.Uint16(body[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			bitDepth = int(binary.LittleEndian.Uint16(body[14:]))
+			if formatTag == wavFormatExtensible && size >= 26 {
+				formatTag = binary.LittleEndian.Uint16(body[24:])
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat || channels == 0 || sampleRate == 0 {
+				return nil, ErrInvalidWAV
+			}
+			data, err := io.ReadAll(io.LimitReader(r, size))
+			if err != nil {
+				return nil, err
+			}
+			samples, err := wavSamples(data, formatTag, channels, bitDepth)
+			if err != nil {
+				return nil, err
+			}
+			return &Audio{SampleRate: sampleRate, Samples: samples}, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, ErrInvalidWAV
+			}
+		}
+
+		if size%2 == 1 && id == "fmt " {
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil {
+				return nil, ErrInvalidWAV
+			}
+		}
+	}
+}
+
+// wavSamples converts interleaved sample data to mono floats.
+func wavSamples(data []byte, formatTag uint16, channels, bitDepth int) ([]float64, error) {
+	width := bitDepth / 8
+	if width == 0 {
+		return nil, ErrInvalidWAV
+	}
+
+	var sample func(b []byte) float64
+	switch {
+	case formatTag == wavFormatPCM && bitDepth == 8:
+		sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case formatTag == wavFormatPCM && bitDepth == 16:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case formatTag == wavFormatPCM && bitDepth == 24:
+		sample = func(b []byte) float64 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return float64(v) / (1 << 23)
+		}
+	case formatTag == wavFormatPCM && bitDepth == 32:
+		sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case formatTag == wavFormatFloat && bitDepth == 32:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case formatTag == wavFormatFloat && bitDepth == 64:
+		sample = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+	default:
+		return nil, ErrInvalidWAV
+	}
+
+	frameWidth := width * channels
+	samples := make([]float64, len(data)/frameWidth)
+	for i := range samples {
+		frame := data[i*frameWidth:]
+		var sum float64
+		for c := range channels {
+			sum += sample(frame[c*width:])
+		}
+		samples[i] = sum / float64(channels)
+	}
+	return samples, nil
+}
@@ -0,0 +1,201 @@
+// Package blocklist checks perceptual hashes against a list of known-bad
+// hashes, such as those of content removed by moderators, so re-uploads
+// and lightly edited copies are caught.
+package blocklist
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/insomnius/tools/index"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Entry is a known-bad hash.
+type Entry struct {
+	// ID identifies the entry in matches, e.g. a case number. It may be
+	// empty.
+	ID   string
+	Hash perceptualhash.Hash
+	// Threshold is the maximum Hamming distance at which a hash matches the
+	// entry. Entries read from a list without their own threshold get
+	// Config.Threshold.
+	Threshold int
+}
+
+// Match is an entry a checked hash matched.
+type Match struct {
+	Entry
+	// Distance is the Hamming distance between the checked hash and the
+	// entry hash.
+	Distance int
+}
+
+// Config holds options for a blocklist.
+type Config struct {
+	// Threshold is the maximum distance for entries that do not set their
+	// own.
+	Threshold int
+	// Logger receives errors of reloads triggered by Watch, after which the
+	// previous list stays in use. Nothing is logged when it is nil.
+	Logger *slog.Logger
+}
+
+var defaultConfig = Config{
+	Threshold: 8,
+}
+
+// ErrNoFile is returned by Reload and Watch for blocklists not loaded from
+// a file.
+var ErrNoFile = errors.New("blocklist was not loaded from a file")
+
+// Blocklist is a set of known-bad hashes. It is safe for concurrent use;
+// checks run against a consistent snapshot while the list is reloaded.
+type Blocklist struct {
+	path   string
+	config Config
+
+	mu       sync.RWMutex
+	list     *list
+	modified time.Time
+	size     int64
+}
+
+// list is an immutable snapshot of the entries, indexed for radius queries.
+type list struct {
+	entries []Entry
+	index   *index.Index
+	// radius is the largest entry threshold.
+	radius int
+}
+
+// newList indexes entries under their position in the slice.
+func newList(entries []Entry) *list {
+	l := &list{entries: entries, index: index.New()}
+	for i, e := range entries {
+		l.index.Add(index.Entry{ID: strconv.Itoa(i), Hash: e.Hash})
+		l.radius = max(l.radius, e.Threshold)
+	}
+	return l
+}
+
+// New returns a blocklist of the given entries.
+// It optionally accepts a custom configuration.
+func New(entries []Entry, configs ...Config) *Blocklist {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	return &Blocklist{config: config, list: newList(entries)}
+}
+
+// Load reads a blocklist from a CSV or NDJSON file; see ReadEntries for the
+// formats. Files ending in .ndjson, .jsonl or .json are read as NDJSON,
+// others as CSV. The file can be reloaded with Reload or Watch.
+// It optionally accepts a custom configuration.
+func Load(path string, configs ...Config) (*Blocklist, error) {
+	b := New(nil, configs...)
+	b.path = path
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Check returns the closest entry matching h within its threshold.
+func (b *Blocklist) Check(h perceptualhash.Hash) (Match, bool) {
+	b.mu.RLock()
+	l := b.list
+	b.mu.RUnlock()
+
+	// The index returns candidates closest first.
+	for _, candidate := range l.index.Query(h, l.radius) {
+		i, _ := strconv.Atoi(candidate.ID)
+		if e := l.entries[i]; candidate.Distance <= e.Threshold {
+			return Match{Entry: e, Distance: candidate.Distance}, true
+		}
+	}
+	return Match{}, false
+}
+
+// Len returns the number of entries.
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.list.entries)
+}
+
+// Reload reads the file the blocklist was loaded from again and replaces
+// the entries. On error the previous entries stay in use.
+func (b *Blocklist) Reload() error {
+	if b.path == "" {
+		return ErrNoFile
+	}
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return err
+	}
+	entries, err := readFile(b.path, b.config)
+	if err != nil {
+		return err
+	}
+
+	l := newList(entries)
+	b.mu.Lock()
+	b.list, b.modified, b.size = l, info.ModTime(), info.Size()
+	b.mu.Unlock()
+	return nil
+}
+
+// Watch checks the file the blocklist was loaded from every interval until
+// ctx is done, and reloads it whenever its modification time or size
+// changed, so moderators can update the list without restarts. Failed
+// reloads are logged to Config.Logger and retried on the next change.
+func (b *Blocklist) Watch(ctx context.Context, interval time.Duration) error {
+	if b.path == "" {
+		return ErrNoFile
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failed time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(b.path)
+		if err != nil {
+			b.logError(err)
+			continue
+		}
+		b.mu.RLock()
+		unchanged := info.ModTime().Equal(b.modified) && info.Size() == b.size
+		b.mu.RUnlock()
+		if unchanged || info.ModTime().Equal(failed) {
+			continue
+		}
+
+		if err := b.Reload(); err != nil {
+			failed = info.ModTime()
+			b.logError(err)
+		}
+	}
+}
+
+// logError logs a failed reload.
+func (b *Blocklist) logError(err error) {
+	if b.config.Logger != nil {
+		b.config.Logger.Warn("reloading blocklist failed", "path", b.path, "error", err)
+	}
+}
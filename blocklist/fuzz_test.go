@@ -0,0 +1,26 @@
+package blocklist_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/insomnius/tools/blocklist"
+)
+
+func FuzzReadEntries(f *testing.F) {
+	f.Add("hash,id,threshold\nc3d1a0e4f0b2c4d8,case-1,4\n# comment\n\n2d52af2450a2552a\n", false)
+	f.Add("c3d1a0e4f0b2c4d8,\"quoted, id\",x\n", false)
+	f.Add(`{"hash": "c3d1a0e4f0b2c4d8", "id": "case-1234", "threshold": 4}`+"\n\n{\"hash\": 1}\n", true)
+	f.Add(`{"hash": "zz"`, true)
+	f.Fuzz(func(t *testing.T, data string, ndjson bool) {
+		format := blocklist.CSV
+		if ndjson {
+			format = blocklist.NDJSON
+		}
+		entries, err := blocklist.ReadEntries(strings.NewReader(data), format)
+		if err != nil {
+			return
+		}
+		blocklist.New(entries)
+	})
+}
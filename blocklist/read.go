@@ -0,0 +1,139 @@
+package blocklist
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Format is the encoding of a blocklist file.
+type Format int
+
+const (
+	// CSV lists one entry per record as hash[,id[,threshold]], with an
+	// optional header record starting with "hash" and blank lines and lines
+	// starting with # ignored.
+	CSV Format = iota
+	// NDJSON lists one JSON object per line, such as
+	// {"hash": "c3d1a0e4f0b2c4d8", "id": "case-1234", "threshold": 4}, where
+	// id and threshold are optional. Blank lines are ignored.
+	NDJSON
+)
+
+// ReadEntries reads blocklist entries in the given format from r. Entries
+// without a threshold get Config.Threshold. Errors name the offending line.
+// It optionally accepts a custom configuration.
+func ReadEntries(r io.Reader, format Format, configs ...Config) ([]Entry, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	switch format {
+	case CSV:
+		return readCSV(r, config)
+	case NDJSON:
+		return readNDJSON(r, config)
+	}
+	return nil, fmt.Errorf("unknown blocklist format %d", format)
+}
+
+// readFile reads the entries of a blocklist file, selecting the format by
+// extension.
+func readFile(path string, config Config) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := CSV
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl", ".json":
+		format = NDJSON
+	}
+	entries, err := ReadEntries(f, format, config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func readCSV(r io.Reader, config Config) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var entries []Entry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(entries) == 0 && strings.EqualFold(record[0], "hash") {
+			continue
+		}
+		if len(record) > 3 {
+			return nil, fmt.Errorf("line %d: %d fields, want at most 3", line, len(record))
+		}
+
+		e := Entry{Threshold: config.Threshold}
+		if e.Hash, err = perceptualhash.ParseHash(record[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(record) > 1 {
+			e.ID = record[1]
+		}
+		if len(record) > 2 && record[2] != "" {
+			if e.Threshold, err = strconv.Atoi(record[2]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid threshold %q", line, record[2])
+			}
+		}
+		entries = append(entries, e)
+	}
+}
+
+func readNDJSON(r io.Reader, config Config) ([]Entry, error) {
+	scanner := bufio.NewScanner(r)
+	var entries []Entry
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var record struct {
+			Hash      string `json:"hash"`
+			ID        string `json:"id"`
+			Threshold *int   `json:"threshold"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		e := Entry{ID: record.ID, Threshold: config.Threshold}
+		hash, err := perceptualhash.ParseHash(record.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		e.Hash = hash
+		if record.Threshold != nil {
+			e.Threshold = *record.Threshold
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
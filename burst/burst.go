@@ -0,0 +1,234 @@
+// Package burst groups photos taken in rapid succession, such as the frames
+// of a camera burst or repeated shots of one scene, and picks the best frame
+// of each group by sharpness and exposure. Unlike dedupe, which only finds
+// copies of one picture, it tells apart near-identical frames that are all
+// originals.
+package burst
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insomnius/tools/exif"
+	"github.com/insomnius/tools/perceptualhash"
+	"github.com/insomnius/tools/quality"
+)
+
+// Config holds options for grouping bursts.
+type Config struct {
+	// MaxGap is the longest time between consecutive frames of a burst.
+	MaxGap time.Duration
+	// Threshold is the maximum Hamming distance between the hashes of
+	// consecutive frames.
+	Threshold int
+	// Extensions, Include and Exclude select the files of Find, as
+	// documented on perceptualhash.ImagePaths.
+	Extensions []string
+	Include    []string
+	Exclude    []string
+	// Workers is the number of files read concurrently by Find. Zero means
+	// the number of CPUs.
+	Workers int
+}
+
+var defaultConfig = Config{
+	MaxGap:    2 * time.Second,
+	Threshold: 12,
+}
+
+// scoreSize is the longer side frames are reduced to before scoring, so
+// frames at different resolutions score alike.
+const scoreSize = 512
+
+// Photo is a frame considered for a burst.
+type Photo struct {
+	Path string
+	// Time is the EXIF capture time.
+	Time time.Time
+	Hash perceptualhash.Hash
+	// Sharpness is the quality.BlurScore of the frame and Exposure its
+	// quality.Exposure.
+	Sharpness float64
+	Exposure  float64
+}
+
+// Burst is a group of frames, in capture order.
+type Burst struct {
+	Photos []Photo
+	// Best is the index of the best frame in Photos.
+	Best int
+}
+
+// Failure is a file that could not be read, decoded or hashed, or that has
+// no capture time.
+type Failure struct {
+	Path string
+	Err  error
+}
+
+// Result is the outcome of Find.
+type Result struct {
+	Bursts   []Burst
+	Failures []Failure
+}
+
+// Find reads the capture time, hash and quality scores of the photos under
+// root and groups them with Group.
+// It optionally accepts a custom configuration.
+func Find(ctx context.Context, root string, configs ...Config) (Result, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	hasher, err := perceptualhash.New(perceptualhash.WithWalk(perceptualhash.WalkConfig{Extensions: config.Extensions, Include: config.Include, Exclude: config.Exclude}))
+	if err != nil {
+		return Result{}, err
+	}
+
+	var (
+		mu     sync.Mutex
+		photos []Photo
+		result Result
+		wg     sync.WaitGroup
+	)
+	paths := make(chan string)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				photo, err := readPhoto(path, hasher)
+				mu.Lock()
+				if err != nil {
+					result.Failures = append(result.Failures, Failure{Path: path, Err: err})
+				} else {
+					photos = append(photos, photo)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+walk:
+	for path, err := range hasher.ImagePaths(root) {
+		if err != nil {
+			result.Failures = append(result.Failures, Failure{Path: path, Err: err})
+			continue
+		}
+		select {
+		case paths <- path:
+		case <-ctx.Done():
+			break walk
+		}
+	}
+	close(paths)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	result.Bursts = Group(photos, config)
+	slices.SortFunc(result.Failures, func(a, b Failure) int { return strings.Compare(a.Path, b.Path) })
+	return result, nil
+}
+
+// readPhoto reads the capture time of the photo at path and decodes it once
+// for its hash, computed with hasher, and scores.
+func readPhoto(path string, hasher *perceptualhash.DCTHasher) (Photo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Photo{}, err
+	}
+	metadata, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Photo{}, err
+	}
+	if metadata.CaptureTime.IsZero() {
+		return Photo{}, exif.ErrNoExif
+	}
+
+	img, _, err := perceptualhash.Decode(data)
+	if err != nil {
+		return Photo{}, err
+	}
+	photo := Photo{Path: path, Time: metadata.CaptureTime}
+	if photo.Hash, err = hasher.Hash(img); err != nil {
+		return Photo{}, err
+	}
+	scoring := quality.Config{Size: scoreSize}
+	if photo.Sharpness, err = quality.BlurScore(img, scoring); err != nil {
+		return Photo{}, err
+	}
+	if photo.Exposure, err = quality.Exposure(img, scoring); err != nil {
+		return Photo{}, err
+	}
+	return photo, nil
+}
+
+// Group sorts photos by capture time and groups consecutive ones taken
+// within Config.MaxGap of each other and within Config.Threshold of each
+// other's hash. Groups of a single photo are left out. The best frame of a
+// burst is the one with the highest sum of its sharpness, relative to the
+// sharpest frame, and its exposure.
+// It optionally accepts a custom configuration.
+func Group(photos []Photo, configs ...Config) []Burst {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	photos = slices.Clone(photos)
+	slices.SortStableFunc(photos, func(a, b Photo) int {
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	var bursts []Burst
+	start := 0
+	for i := 1; i <= len(photos); i++ {
+		if i < len(photos) {
+			prev, cur := photos[i-1], photos[i]
+			if cur.Time.Sub(prev.Time) <= config.MaxGap && cur.Hash.Distance(prev.Hash) <= config.Threshold {
+				continue
+			}
+		}
+		if i-start > 1 {
+			frames := photos[start:i:i]
+			bursts = append(bursts, Burst{Photos: frames, Best: best(frames)})
+		}
+		start = i
+	}
+	return bursts
+}
+
+// best returns the index of the best frame of a burst.
+func best(frames []Photo) int {
+	var sharpest float64
+	for _, frame := range frames {
+		sharpest = max(sharpest, frame.Sharpness)
+	}
+
+	bestIndex, bestScore := 0, -1.0
+	for i, frame := range frames {
+		score := frame.Exposure
+		if sharpest > 0 {
+			score += frame.Sharpness / sharpest
+		}
+		if score > bestScore {
+			bestIndex, bestScore = i, score
+		}
+	}
+	return bestIndex
+}
@@ -0,0 +1,196 @@
+// Package cdc provides content-defined chunking using the FastCDC algorithm,
+// so shifted but otherwise duplicate content produces identical chunks.
+package cdc
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Config holds the chunk size bounds for a Chunker.
+type Config struct {
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+var defaultConfig = Config{
+	MinSize: 2 * 1024,
+	AvgSize: 8 * 1024,
+	MaxSize: 64 * 1024,
+}
+
+var ErrInvalidConfig = errors.New("chunk sizes must satisfy 64 <= min <= avg <= max")
+
+// normalizationLevel controls how strongly chunk sizes are pulled towards
+// AvgSize, as described in the FastCDC paper.
+const normalizationLevel = 2
+
+// Chunk is a contiguous piece of the input stream.
+type Chunk struct {
+	Offset int64
+	Length int
+	// Data is only valid until the next call to Next.
+	Data []byte
+	// Digest is the SHA-256 of Data, usable as a dedupe key.
+	Digest [sha256.Size]byte
+}
+
+// Chunker splits a stream into content-defined chunks.
+type Chunker struct {
+	reader io.Reader
+	config Config
+	maskS  uint64
+	maskL  uint64
+
+	buf    []byte
+	start  int
+	end    int
+	offset int64
+	eof    bool
+}
+
+// NewChunker returns a Chunker reading from r.
+// It optionally accepts a custom configuration.
+func NewChunker(r io.Reader, configs ...Config) (*Chunker, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	if config.MinSize < 64 || config.MinSize > config.AvgSize || config.AvgSize > config.MaxSize {
+		return nil, ErrInvalidConfig
+	}
+
+	avgBits := bits.Len(uint(config.AvgSize)) - 1
+	return &Chunker{
+		reader: r,
+		config: config,
+		maskS:  topMask(avgBits + normalizationLevel),
+		maskL:  topMask(avgBits - normalizationLevel),
+		buf:    make([]byte, config.MaxSize*2),
+	}, nil
+}
+
+// topMask returns a mask with the n most significant bits set. The gear hash
+// shifts left, so the high bits depend on the widest window of input.
+func topMask(n int) uint64 {
+	n = max(n, 1)
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk, or io.EOF once the input is exhausted.
+func (c *Chunker) Next() (Chunk, error) {
+	if err := c.fill(); err != nil {
+		return Chunk{}, err
+	}
+	if c.start == c.end {
+		return Chunk{}, io.EOF
+	}
+
+	length := c.cutpoint(c.buf[c.start:c.end])
+	data := c.buf[c.start : c.start+length]
+	chunk := Chunk{
+		Offset: c.offset,
+		Length: length,
+		Data:   data,
+		Digest: sha256.Sum256(data),
+	}
+
+	c.start += length
+	c.offset += int64(length)
+	return chunk, nil
+}
+
+// fill tops the buffer up so that at least MaxSize bytes are available,
+// unless the reader is exhausted.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.config.MaxSize {
+		return nil
+	}
+
+	copy(c.buf, c.buf[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+
+	for c.end < len(c.buf) {
+		n, err := c.reader.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cutpoint returns the length of the next chunk within data.
+func (c *Chunker) cutpoint(data []byte) int {
+	n := len(data)
+	if n <= c.config.MinSize {
+		return n
+	}
+	if n > c.config.MaxSize {
+		n = c.config.MaxSize
+	}
+	normal := min(c.config.AvgSize, n)
+
+	var fp uint64
+	i := c.config.MinSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Split chunks the whole of r and returns every chunk with its own copy of
+// the data.
+func Split(r io.Reader, configs ...Config) ([]Chunk, error) {
+	chunker, err := NewChunker(r, configs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunk.Data = append([]byte(nil), chunk.Data...)
+		chunks = append(chunks, chunk)
+	}
+}
+
+// gear is the table of random values driving the rolling gear hash. It is
+// derived from a fixed seed so chunk boundaries are stable across builds.
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x2545f4914f6cdd1d)
+	for i := range table {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// runAnalyze implements "phash analyze".
+func runAnalyze(args []string) error {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	samples := flags.Int("samples", 1000, "number of images compared against all others")
+	seed := flags.Uint64("seed", 0, "seed for choosing the sampled images")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("analyze: expected exactly one directory")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var hashes []perceptualhash.Hash
+	results, errc := new(perceptualhash.DCTHasher).HashDirStream(ctx, flags.Arg(0))
+	for result := range results {
+		if result.Err != nil {
+			continue
+		}
+		hash, err := perceptualhash.ParseHash(result.Hash)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	report := perceptualhash.AnalyzeDistances(hashes, perceptualhash.AnalyzeConfig{Samples: *samples, Seed: *seed})
+
+	fmt.Printf("Distance to the nearest other image, %d images:\n", len(hashes))
+	peak := slices.Max(report.Nearest[:])
+	last := 0
+	for d, count := range report.Nearest {
+		if count > 0 {
+			last = d
+		}
+	}
+	for d, count := range report.Nearest[:last+1] {
+		bar := 0
+		if peak > 0 {
+			bar = (count*50 + peak - 1) / peak
+		}
+		fmt.Printf("%3d %7d %s\n", d, count, strings.Repeat("#", bar))
+	}
+
+	if len(report.Thresholds) == 0 {
+		fmt.Println("No natural gap found.")
+	} else {
+		fmt.Printf("Suggested thresholds: %s\n", strings.Trim(fmt.Sprint(report.Thresholds), "[]"))
+	}
+	fmt.Printf("0.1%% of image pairs are within distance %d.\n", report.Percentile(0.001))
+	return nil
+}
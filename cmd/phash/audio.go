@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/insomnius/tools/audiohash"
+)
+
+// runAudio dispatches the "phash audio" subcommands.
+func runAudio(args []string) error {
+	if len(args) == 0 || args[0] != "dedupe" {
+		return errors.New("audio: expected subcommand \"dedupe\"")
+	}
+	return runAudioDedupe(args[1:])
+}
+
+// audioCluster is a group of audio files that match each other.
+type audioCluster struct {
+	Paths []string `json:"paths"`
+}
+
+// runAudioDedupe implements "phash audio dedupe".
+func runAudioDedupe(args []string) error {
+	flags := flag.NewFlagSet("audio dedupe", flag.ExitOnError)
+	threshold := flags.Float64("threshold", 0.35, "maximum bit error rate for duplicates")
+	maxOffset := flags.Int("max-offset", 512, "largest alignment shift searched, in frames")
+	extensions := flags.String("ext", ".wav", "comma-separated list of file extensions to include")
+	workers := flags.Int("workers", 0, "number of concurrent workers (default: number of CPUs)")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	verbose := flags.Bool("v", false, "log skipped files")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("audio dedupe: expected exactly one directory")
+	}
+	if *workers <= 0 {
+		*workers = defaultWorkers()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logger := newLogger(*verbose)
+
+	// 1. Collect candidate files
+	var paths []string
+	exts := strings.Split(strings.ToLower(*extensions), ",")
+	err := filepath.WalkDir(flags.Arg(0), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !slices.Contains(exts, strings.ToLower(filepath.Ext(path))) {
+			logger.Debug("skipping file with unsupported extension", "path", path)
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 2. Fingerprint every file
+	fingerprints := make([]audiohash.Fingerprint, len(paths))
+	errs := make([]error, len(paths))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range *workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fingerprints[i], errs[i] = audiohash.FromPath(paths[i])
+			}
+		}()
+	}
+feed:
+	for i := range paths {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 3. Cluster matching fingerprints
+	matcher := audiohash.NewMatcher(audiohash.MatchConfig{
+		MaxOffset:  *maxOffset,
+		MinOverlap: 128,
+		Threshold:  *threshold,
+	})
+	fingerprinted := 0
+	for i, path := range paths {
+		if errs[i] != nil {
+			logger.Warn("fingerprinting failed", "path", path, "error", errs[i])
+			continue
+		}
+		matcher.Add(path, fingerprints[i])
+		fingerprinted++
+	}
+
+	// 4. Report
+	var clusters []audioCluster
+	for _, names := range matcher.Clusters() {
+		clusters = append(clusters, audioCluster{Paths: names})
+	}
+
+	if *asJSON {
+		return writeJSON(clusters)
+	}
+
+	for i, cluster := range clusters {
+		fmt.Printf("Cluster %d:\n", i+1)
+		for _, path := range cluster.Paths {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	fmt.Printf("%d audio files, %d duplicate clusters\n", fingerprinted, len(clusters))
+
+	return nil
+}
+
+func defaultWorkers() int {
+	return runtime.NumCPU()
+}
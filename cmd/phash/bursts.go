@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/insomnius/tools/burst"
+)
+
+// runBursts implements "phash bursts".
+func runBursts(args []string) error {
+	flags := flag.NewFlagSet("bursts", flag.ExitOnError)
+	gap := flags.Duration("gap", 2*time.Second, "maximum time between consecutive frames of a burst")
+	threshold := flags.Int("threshold", 12, "maximum hash distance between consecutive frames")
+	asJSON := flags.Bool("json", false, "print the bursts as JSON")
+	extensions := flags.String("ext", ".jpg,.jpeg", "comma-separated file extensions to read")
+	exclude := flags.String("exclude", "", "comma-separated patterns of files and directories to skip")
+	workers := flags.Int("workers", 0, "number of files read concurrently (default: number of CPUs)")
+	verbose := flags.Bool("v", false, "list files without capture time or that failed")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("bursts: expected exactly one directory")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := burst.Find(ctx, flags.Arg(0), burst.Config{
+		MaxGap:     *gap,
+		Threshold:  *threshold,
+		Extensions: splitList(*extensions),
+		Exclude:    splitList(*exclude),
+		Workers:    *workers,
+	})
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		for _, failure := range result.Failures {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", failure.Path, failure.Err)
+		}
+	}
+
+	if *asJSON {
+		return writeJSON(result.Bursts)
+	}
+	frames := 0
+	for i, b := range result.Bursts {
+		frames += len(b.Photos)
+		first := b.Photos[0].Time
+		fmt.Printf("Burst %d: %d frames at %s\n", i+1, len(b.Photos), first.Format("2006-01-02 15:04:05"))
+		for j, photo := range b.Photos {
+			mark := " "
+			if j == b.Best {
+				mark = "*"
+			}
+			fmt.Printf("  %s %s  +%s  sharpness %.0f  exposure %.2f\n", mark, photo.Path, photo.Time.Sub(first), photo.Sharpness, photo.Exposure)
+		}
+	}
+	fmt.Printf("%d bursts, %d frames, %d files skipped\n", len(result.Bursts), frames, len(result.Failures))
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/insomnius/tools/dedupe"
+)
+
+// runCompareDirs implements "phash compare-dirs".
+func runCompareDirs(args []string) error {
+	flags := flag.NewFlagSet("compare-dirs", flag.ExitOnError)
+	threshold := flags.Int("threshold", 10, "maximum hash distance for matches")
+	asJSON := flags.Bool("json", false, "print the comparison as JSON")
+	extensions := flags.String("ext", ".jpg,.jpeg,.png", "comma-separated file extensions to hash")
+	exclude := flags.String("exclude", "", "comma-separated patterns of files and directories to skip")
+	workers := flags.Int("workers", 0, "number of files processed concurrently (default: number of CPUs)")
+	verbose := flags.Bool("v", false, "log skipped and failed files")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return errors.New("compare-dirs: expected exactly two directories")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	config := dedupe.Config{
+		Extensions: splitList(*extensions),
+		Exclude:    splitList(*exclude),
+		Workers:    *workers,
+		Logger:     newLogger(*verbose),
+	}
+	if config.Workers == 0 {
+		config.Workers = defaultWorkers()
+	}
+
+	comparison, err := dedupe.CompareDirs(ctx, flags.Arg(0), flags.Arg(1), *threshold, config)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(comparison)
+	}
+	for _, pair := range comparison.Matches {
+		kind := fmt.Sprintf("distance %d", pair.Distance)
+		if pair.Exact {
+			kind = "exact"
+		}
+		fmt.Printf("match   %s  %s  (%s)\n", pair.A, pair.B, kind)
+	}
+	for _, path := range comparison.OnlyA {
+		fmt.Printf("only a  %s\n", path)
+	}
+	for _, path := range comparison.OnlyB {
+		fmt.Printf("only b  %s\n", path)
+	}
+	fmt.Printf("%d matched, %d only in %s, %d only in %s, %d failures\n",
+		len(comparison.Matches), len(comparison.OnlyA), flags.Arg(0), len(comparison.OnlyB), flags.Arg(1), len(comparison.Failures))
+	return nil
+}
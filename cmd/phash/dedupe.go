@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/insomnius/tools/dedupe"
+	"github.com/insomnius/tools/hashplugin"
+	"github.com/insomnius/tools/organize"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// runDedupe implements "phash dedupe".
+func runDedupe(args []string) error {
+	flags := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	threshold := flags.Int("threshold", 10, "maximum hash distance in bits for duplicates")
+	workers := flags.Int("workers", 0, "number of concurrent workers (default: number of CPUs)")
+	maxInFlight := flags.Int("max-in-flight", 0, "maximum number of files processed at once, including timed out ones (default: workers)")
+	timeout := flags.Duration("timeout", 0, "skip files taking longer than this to process (0 means no limit)")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	verbose := flags.Bool("v", false, "log skipped files and reused hashes")
+	showProgress := flags.Bool("progress", false, "show progress on stderr")
+	quarantine := flags.String("quarantine", "", "move all but the best copy of each cluster into this directory")
+	link := flags.String("link", "", "replace all but the best copy of each cluster with links: hard, soft or auto")
+	keep := flags.String("keep", "resolution", "policy for the copy to keep: resolution or size")
+	algorithm := flags.String("algorithm", "phash", "hash algorithm: "+strings.Join(perceptualhash.Hashers(), ", "))
+	plugin := flags.String("plugin", "", "hash with the plugin started by this command line instead of -algorithm")
+	montage := flags.String("montage", "", "write a contact sheet PNG of each cluster into this directory")
+	extensions := flags.String("ext", ".jpg,.jpeg,.png", "comma-separated file extensions to hash")
+	include := flags.String("include", "", "comma-separated patterns of files to hash, e.g. \"photos/**\"")
+	exclude := flags.String("exclude", "", "comma-separated patterns of files and directories to skip, e.g. \"node_modules,*.thumb.jpg\"")
+	followSymlinks := flags.Bool("follow-symlinks", false, "descend into symbolically linked directories, hashing every file once")
+	dryRun := flags.Bool("dry-run", false, "print the moves or links -quarantine or -link would make, without making them")
+	journal := flags.String("journal", "", "record the operations performed in this JSON file for \"phash undo\" (default: phash-journal-<time>.json)")
+	backup := flags.String("backup", "", "with -link, move replaced files into this directory so \"phash undo\" can restore them (default: phash-backup-<time>)")
+	report := flags.String("html", "", "write a self-contained HTML report with thumbnails of each cluster to this file")
+	cacheDir := flags.String("cache", "", "keep computed hashes in this directory, so unchanged images are not hashed again")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("dedupe: expected exactly one directory")
+	}
+	if *quarantine != "" && *link != "" {
+		return errors.New("dedupe: -quarantine and -link cannot be combined")
+	}
+	if *backup != "" && *link == "" {
+		return errors.New("dedupe: -backup requires -link")
+	}
+
+	linkModes := map[string]organize.LinkMode{
+		"hard": organize.Hardlink,
+		"soft": organize.Symlink,
+		"auto": organize.HardlinkOrSymlink,
+	}
+	linkMode, ok := linkModes[*link]
+	if !ok && *link != "" {
+		return fmt.Errorf("dedupe: unknown link mode %q", *link)
+	}
+
+	policies := map[string]organize.Policy{
+		"resolution": organize.LargestResolution,
+		"size":       organize.LargestFile,
+	}
+	policy, ok := policies[*keep]
+	if !ok {
+		return fmt.Errorf("dedupe: unknown keep policy %q", *keep)
+	}
+
+	hasher, err := perceptualhash.Lookup(*algorithm)
+	if err != nil {
+		return fmt.Errorf("dedupe: unknown algorithm %q", *algorithm)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	config := dedupe.Config{
+		Threshold:      *threshold,
+		Extensions:     splitList(*extensions),
+		Include:        splitList(*include),
+		Exclude:        splitList(*exclude),
+		FollowSymlinks: *followSymlinks,
+		Workers:        *workers,
+		MaxInFlight:    *maxInFlight,
+		Timeout:        *timeout,
+		Logger:         newLogger(*verbose),
+	}
+	// The default algorithm goes through perceptualhash.FromPath, which
+	// also uses the hash cache.
+	if *algorithm != "phash" {
+		config.Hasher = hasher
+	}
+	if fields := strings.Fields(*plugin); len(fields) > 0 {
+		h, err := hashplugin.Start(fields[0], fields[1:], hashplugin.Config{Timeout: 30 * time.Second, MaxSize: 512, Stderr: os.Stderr})
+		if err != nil {
+			return fmt.Errorf("dedupe: %w", err)
+		}
+		defer h.Close()
+		config.Hasher = h
+	}
+	if *cacheDir != "" {
+		if config.Cache, err = perceptualhash.NewDiskCache(*cacheDir); err != nil {
+			return fmt.Errorf("dedupe: %w", err)
+		}
+	}
+	if config.Workers == 0 {
+		config.Workers = defaultWorkers()
+	}
+	if *showProgress {
+		config.OnProgress = printProgress
+	}
+
+	result, err := dedupe.Run(ctx, flags.Arg(0), config)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if err := writeJSON(result.Clusters); err != nil {
+			return err
+		}
+	} else {
+		for i, cluster := range result.Clusters {
+			fmt.Printf("Cluster %d:\n", i+1)
+			for _, item := range cluster {
+				for _, path := range item.Paths {
+					fmt.Printf("  %s  %s\n", item.Hash, path)
+				}
+			}
+		}
+		fmt.Printf("%d distinct images, %d duplicate clusters, %d failures\n", len(result.Items), len(result.Clusters), len(result.Failures))
+	}
+
+	if *report != "" {
+		if err := writeReport(*report, result); err != nil {
+			return err
+		}
+	}
+
+	if *montage != "" {
+		if err := writeMontages(*montage, result.Clusters); err != nil {
+			return err
+		}
+	}
+
+	if *quarantine == "" && *link == "" {
+		return nil
+	}
+
+	record := organize.Journal{Created: time.Now()}
+	// Linked duplicates are near-duplicates rather than identical copies,
+	// so they are always kept aside for "phash undo".
+	if *link != "" && *backup == "" {
+		*backup = fmt.Sprintf("phash-backup-%s", record.Created.Format("20060102-150405"))
+	}
+
+	organizeConfig := organize.Config{
+		Root:          flags.Arg(0),
+		QuarantineDir: *quarantine,
+		Policy:        policy,
+		BackupDir:     *backup,
+		DryRun:        *dryRun,
+	}
+	decisions, err := organize.Decide(clusterPaths(result.Clusters), organizeConfig)
+	if err != nil {
+		return err
+	}
+
+	if *link != "" {
+		record.Links, err = organize.ReplaceWithLinks(decisions, linkMode, organizeConfig)
+		for _, l := range record.Links {
+			if *dryRun {
+				fmt.Printf("would link %s -> %s\n", l.Path, l.Target)
+				continue
+			}
+			config.Logger.Info("linked duplicate", "path", l.Path, "target", l.Target, "symbolic", l.Symbolic)
+		}
+		if !*asJSON && !*dryRun {
+			fmt.Printf("%d duplicates replaced with links, originals moved to %s\n", len(record.Links), *backup)
+		}
+	} else {
+		record.Moves, err = organize.Quarantine(decisions, organizeConfig)
+		for _, move := range record.Moves {
+			if *dryRun {
+				fmt.Printf("would move %s -> %s\n", move.From, move.To)
+				continue
+			}
+			config.Logger.Info("quarantined duplicate", "from", move.From, "to", move.To)
+		}
+		if !*asJSON && !*dryRun {
+			fmt.Printf("%d duplicates moved to %s\n", len(record.Moves), *quarantine)
+		}
+	}
+	if *dryRun || len(record.Moves)+len(record.Links) == 0 {
+		return err
+	}
+
+	// The journal is written even after a failure, so the operations that
+	// did happen can still be undone.
+	if *journal == "" {
+		*journal = fmt.Sprintf("phash-journal-%s.json", record.Created.Format("20060102-150405"))
+	}
+	if journalErr := organize.WriteJournal(*journal, record); journalErr != nil {
+		return errors.Join(err, fmt.Errorf("writing journal: %w", journalErr))
+	}
+	if !*asJSON {
+		fmt.Printf("journal written to %s; revert with: phash undo %s\n", *journal, *journal)
+	}
+	return err
+}
+
+// runUndo implements "phash undo".
+func runUndo(args []string) error {
+	flags := flag.NewFlagSet("undo", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("undo: expected exactly one journal file")
+	}
+
+	record, err := organize.ReadJournal(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := organize.Undo(record); err != nil {
+		return err
+	}
+	fmt.Printf("%d moves and %d links reverted\n", len(record.Moves), len(record.Links))
+	return nil
+}
+
+// printProgress reports progress on a single, continuously updated stderr line.
+func printProgress(done, total int, current string) {
+	fmt.Fprintf(os.Stderr, "\r\033[K%d/%d %s", done, total, current)
+	if done == total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// writeReport writes the HTML report of result to path.
+func writeReport(path string, result dedupe.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = dedupe.WriteReport(f, result)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeMontages renders every cluster as cluster-N.png in dir.
+func writeMontages(dir string, clusters [][]dedupe.Item) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for i, cluster := range clusters {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("cluster-%d.png", i+1)))
+		if err != nil {
+			return err
+		}
+		err = png.Encode(f, dedupe.Montage(cluster))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterPaths flattens each cluster of items into its file paths.
+func clusterPaths(clusters [][]dedupe.Item) [][]string {
+	paths := make([][]string, len(clusters))
+	for i, cluster := range clusters {
+		for _, item := range cluster {
+			paths[i] = append(paths[i], item.Paths...)
+		}
+	}
+	return paths
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newLogger returns a logger writing to stderr, including debug records
+// when verbose is set.
+func newLogger(verbose bool) *slog.Logger {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelDebug
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// writeJSON writes v to stdout as indented JSON.
+func writeJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
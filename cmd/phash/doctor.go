@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/insomnius/tools/audiohash"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// doctorFixture is a small PNG hashed by the self-test. PNG decodes
+// identically with every backend, so its hash never varies.
+//
+//go:embed doctor_fixture.png
+var doctorFixture []byte
+
+// doctorFixtureHash is the hash of doctorFixture under the default
+// configuration, with both the floating-point and the fixed-point DCT.
+const doctorFixtureHash = "363126e7e6f64946"
+
+// imageMagics holds leading bytes of each image format, enough for
+// image.DecodeConfig to tell whether a decoder is registered.
+var imageMagics = []struct{ name, magic string }{
+	{"jpeg", "\xff\xd8\xff"},
+	{"png", "\x89PNG\r\n\x1a\n"},
+	{"gif", "GIF89a"},
+	{"webp", "RIFF\x00\x00\x00\x00WEBPVP8 "},
+	{"bmp", "BM\x00\x00\x00\x00\x00\x00\x00\x00"},
+	{"tiff", "II*\x00"},
+}
+
+// runDoctor implements "phash doctor".
+func runDoctor(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	cacheDir := flags.String("cache", "", "also check that this hash cache directory is usable")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return errors.New("doctor: expected no arguments")
+	}
+
+	fmt.Printf("Go:         %s %s/%s, NumCPU %d, GOMAXPROCS %d\n", runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU(), runtime.GOMAXPROCS(0))
+	fmt.Printf("Backend:    %s\n", perceptualhash.Backend())
+	fmt.Printf("Images:     %s\n", imageFormats())
+	fmt.Printf("Audio:      %s\n", strings.Join(audiohash.Formats(), ", "))
+	fmt.Printf("Hashers:    %s\n", strings.Join(perceptualhash.Hashers(), ", "))
+	fmt.Printf("Index:      in-memory, no external backends to reach\n")
+
+	var failed bool
+	if *cacheDir != "" {
+		if err := checkCache(*cacheDir); err != nil {
+			fmt.Printf("Cache:      FAIL: %v\n", err)
+			failed = true
+		} else {
+			fmt.Printf("Cache:      ok, %s\n", *cacheDir)
+		}
+	}
+
+	if err := selfTest(); err != nil {
+		fmt.Printf("Self-test:  FAIL: %v\n", err)
+		failed = true
+	} else {
+		fmt.Printf("Self-test:  ok, %s\n", doctorFixtureHash)
+	}
+
+	if failed {
+		return errors.New("doctor: some checks failed")
+	}
+	return nil
+}
+
+// imageFormats lists the image formats with a registered decoder, marking
+// those perceptualhash can hash, then those without one.
+func imageFormats() string {
+	var supported, missing []string
+	probed := map[string]bool{}
+	for _, format := range imageMagics {
+		probed[format.name] = true
+		_, _, err := image.DecodeConfig(strings.NewReader(format.magic))
+		switch {
+		case errors.Is(err, image.ErrFormat):
+			missing = append(missing, format.name)
+		case slices.Contains(perceptualhash.Formats(), format.name):
+			supported = append(supported, format.name+" (hashed)")
+		default:
+			supported = append(supported, format.name)
+		}
+	}
+
+	// RAW files are TIFF files hashed from their JPEG previews.
+	for _, format := range perceptualhash.Formats() {
+		if !probed[format] {
+			supported = append(supported, format+" (hashed)")
+		}
+	}
+
+	line := strings.Join(supported, ", ")
+	if len(missing) > 0 {
+		line += "; not compiled in: " + strings.Join(missing, ", ")
+	}
+	return line
+}
+
+// checkCache stores and reads back an entry in a disk cache in dir.
+func checkCache(dir string) error {
+	cache, err := perceptualhash.NewDiskCache(dir)
+	if err != nil {
+		return err
+	}
+
+	key := perceptualhash.CacheKey(doctorFixture, perceptualhash.Config{})
+	cache.Set(key, doctorFixtureHash)
+	hash, ok := cache.Get(key)
+	if !ok || hash != doctorFixtureHash {
+		return fmt.Errorf("%s is not writable", filepath.Clean(dir))
+	}
+	return nil
+}
+
+// selfTest hashes the embedded fixture with both DCT implementations.
+func selfTest() error {
+	transforms := []struct {
+		name      string
+		transform perceptualhash.Transform
+	}{
+		{"floating-point", perceptualhash.FloatDCT},
+		{"fixed-point", perceptualhash.FixedPointDCT},
+	}
+	for _, t := range transforms {
+		h, err := perceptualhash.New(perceptualhash.WithTransform(t.transform))
+		if err != nil {
+			return fmt.Errorf("%s DCT: %w", t.name, err)
+		}
+		hash, err := h.FromReader(bytes.NewReader(doctorFixture))
+		if err != nil {
+			return fmt.Errorf("%s DCT: %w", t.name, err)
+		}
+		if hash != doctorFixtureHash {
+			return fmt.Errorf("%s DCT hashed the fixture to %s, want %s", t.name, hash, doctorFixtureHash)
+		}
+	}
+	return nil
+}
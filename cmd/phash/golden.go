@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/insomnius/tools/phashtest"
+)
+
+// runGolden implements "phash golden".
+func runGolden(args []string) error {
+	flags := flag.NewFlagSet("golden", flag.ExitOnError)
+	output := flags.String("o", "golden-hashes.json", "golden file to write")
+	version := flags.String("version", "", "version label recorded in the golden file")
+	algorithms := flags.String("algorithms", "", "comma-separated hash algorithms (default: all registered)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("golden: expected exactly one fixture directory")
+	}
+
+	golden, err := phashtest.HashFixtures(flags.Arg(0), splitList(*algorithms)...)
+	if err != nil {
+		return err
+	}
+	golden.Version = *version
+	if err := phashtest.WriteGoldenHashes(*output, golden); err != nil {
+		return err
+	}
+
+	for _, algorithm := range slices.Sorted(maps.Keys(golden.Hashes)) {
+		fmt.Printf("%s: %d fixtures\n", algorithm, len(golden.Hashes[algorithm]))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Command phash finds duplicate images and audio files using the perceptual
+// hashing packages in this repository.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage:
+  phash dedupe [flags] <dir>           find duplicate images
+  phash audio dedupe [flags] <dir>     find duplicate audio files
+  phash compare-dirs [flags] <a> <b>   match images across two directories
+  phash bursts [flags] <dir>           group burst photos and pick the best frame of each
+  phash undo <journal>                 revert the moves and links of a dedupe run
+  phash golden [flags] <dir>           write the golden hashes of a fixture directory
+  phash analyze [flags] <dir>          suggest thresholds from the distribution of distances
+  phash manifest [flags] <dir>         write or check a manifest of digests and hashes
+  phash doctor [flags]                 report the build environment and run a self-test
+
+Run "phash <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "dedupe":
+		err = runDedupe(os.Args[2:])
+	case "audio":
+		err = runAudio(os.Args[2:])
+	case "compare-dirs":
+		err = runCompareDirs(os.Args[2:])
+	case "bursts":
+		err = runBursts(os.Args[2:])
+	case "undo":
+		err = runUndo(os.Args[2:])
+	case "golden":
+		err = runGolden(os.Args[2:])
+	case "analyze":
+		err = runAnalyze(os.Args[2:])
+	case "manifest":
+		err = runManifest(os.Args[2:])
+	case "doctor":
+		err = runDoctor(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "phash:", err)
+		os.Exit(1)
+	}
+}
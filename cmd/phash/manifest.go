@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/insomnius/tools/manifest"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// runManifest implements "phash manifest".
+func runManifest(args []string) error {
+	flags := flag.NewFlagSet("manifest", flag.ExitOnError)
+	output := flags.String("o", "", "write the manifest to this file instead of stdout")
+	check := flags.String("check", "", "verify the directory against this manifest instead of writing one")
+	extensions := flags.String("ext", ".jpg,.jpeg,.png", "comma-separated file extensions to include")
+	exclude := flags.String("exclude", "", "comma-separated patterns of files and directories to skip")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("manifest: expected exactly one directory")
+	}
+	root := flags.Arg(0)
+
+	if *check != "" {
+		return checkManifest(root, *check)
+	}
+
+	entries, err := manifest.Generate(context.Background(), root, perceptualhash.WithWalk(perceptualhash.WalkConfig{
+		Extensions: splitList(*extensions),
+		Exclude:    splitList(*exclude),
+	}))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", e.Path, e.Err)
+		}
+	}
+
+	if *output == "" {
+		return manifest.Write(os.Stdout, entries)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := manifest.Write(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkManifest verifies the files under root against the manifest at path.
+func checkManifest(root, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	entries, err := manifest.Read(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	problems, err := manifest.Verify(context.Background(), root, entries)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: %v\n", p.Path, p.Err)
+	}
+	fmt.Printf("%d files checked, %d failed\n", len(entries), len(problems))
+	if len(problems) > 0 {
+		return errors.New("manifest: verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// Package crawler fetches images by URL, such as those listed in a sitemap
+// or a CSV export, hashes them and adds them to an index, with politeness
+// controls for the hosts it fetches from.
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/insomnius/tools/index"
+	"github.com/insomnius/tools/internal/fetch"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Config holds options for Crawl.
+type Config struct {
+	// Concurrency is the number of images fetched at once.
+	Concurrency int
+	// PerHostInterval is the minimum time between requests to one host,
+	// including retries.
+	PerHostInterval time.Duration
+	// Retries is the number of times a request failing with a network error,
+	// 429 Too Many Requests or a 5xx status is retried.
+	Retries int
+	// Backoff is the wait before the first retry, doubled for every further
+	// one. A Retry-After header takes precedence.
+	Backoff time.Duration
+	// Timeout bounds each request, including reading the body. Zero means
+	// no limit.
+	Timeout time.Duration
+	// MaxBytes is the largest image fetched. Zero means no limit.
+	MaxBytes int64
+	// UserAgent identifies the crawler to the hosts it fetches from.
+	UserAgent string
+	// Client sends the requests. Nil means http.DefaultClient.
+	Client *http.Client
+	// Hasher computes the perceptual hashes, which must match those of the
+	// other entries of the index. Nil means the default configuration.
+	Hasher *perceptualhash.DCTHasher
+}
+
+var defaultConfig = Config{
+	Concurrency:     8,
+	PerHostInterval: 500 * time.Millisecond,
+	Retries:         3,
+	Backoff:         time.Second,
+	Timeout:         30 * time.Second,
+	MaxBytes:        32 << 20,
+	UserAgent:       "insomnius-tools-crawler",
+}
+
+var (
+	// ErrTooLarge is returned for images larger than Config.MaxBytes.
+	ErrTooLarge = fetch.ErrTooLarge
+	// ErrStatus is returned for responses with an unsuccessful status.
+	ErrStatus = fetch.ErrStatus
+)
+
+// Adder is implemented by the index types.
+type Adder interface {
+	Add(e index.Entry)
+}
+
+// Failure is a URL that could not be fetched or hashed.
+type Failure struct {
+	URL string
+	Err error
+}
+
+// Result summarizes a crawl.
+type Result struct {
+	// Added is the number of images added to the index.
+	Added    int
+	Failures []Failure
+}
+
+// Crawl fetches the images at urls, hashes them and adds them to ix with
+// their URL as ID. Failures are collected in the result and the crawl goes
+// on; the error is only set if ctx was done before the crawl finished.
+// It optionally accepts a custom configuration.
+func Crawl(ctx context.Context, urls []string, ix Adder, configs ...Config) (Result, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	c := &crawler{config: config, hosts: map[string]time.Time{}}
+	if c.config.Client == nil {
+		c.config.Client = http.DefaultClient
+	}
+	if c.config.Hasher == nil {
+		c.config.Hasher = new(perceptualhash.DCTHasher)
+	}
+
+	var (
+		mu     sync.Mutex
+		result Result
+		wg     sync.WaitGroup
+	)
+	work := make(chan string)
+	for range max(config.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range work {
+				hash, err := c.hash(ctx, u)
+				if err == nil {
+					ix.Add(index.Entry{ID: u, Hash: hash})
+				}
+
+				mu.Lock()
+				if err != nil {
+					result.Failures = append(result.Failures, Failure{URL: u, Err: err})
+				} else {
+					result.Added++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, u := range urls {
+		select {
+		case work <- u:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return result, ctx.Err()
+}
+
+// crawler holds the state shared by the workers of a crawl.
+type crawler struct {
+	config Config
+
+	mu sync.Mutex
+	// hosts holds the earliest time of the next request to each host.
+	hosts map[string]time.Time
+}
+
+// hash fetches the image at rawURL, retrying transient failures, and
+// hashes it.
+func (c *crawler) hash(ctx context.Context, rawURL string) (perceptualhash.Hash, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	var data []byte
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		data, retryAfter, err = c.fetch(ctx, u)
+		if err == nil || retryAfter < 0 || attempt >= c.config.Retries {
+			break
+		}
+
+		wait := c.config.Backoff << attempt
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	hash, err := c.config.Hasher.FromBytes(data)
+	if err != nil {
+		return 0, err
+	}
+	return perceptualhash.ParseHash(hash)
+}
+
+// fetch makes one request for u once its host may be contacted again. On
+// failure, retryAfter is negative if retrying is pointless, positive if the
+// server asked to wait that long, and zero otherwise.
+func (c *crawler) fetch(ctx context.Context, u *url.URL) (data []byte, retryAfter time.Duration, err error) {
+	if err := c.wait(ctx, u.Host); err != nil {
+		return nil, -1, err
+	}
+
+	data, err = fetch.Get(ctx, fetch.Request{
+		Client:    c.config.Client,
+		URL:       u.String(),
+		UserAgent: c.config.UserAgent,
+		Timeout:   c.config.Timeout,
+		MaxBytes:  c.config.MaxBytes,
+	})
+	var statusErr *fetch.StatusError
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return nil, -1, err
+	case errors.As(err, &statusErr):
+		if statusErr.Code != http.StatusTooManyRequests && statusErr.Code < 500 {
+			return nil, -1, err
+		}
+		return nil, statusErr.RetryAfter, err
+	}
+	return data, 0, err
+}
+
+// wait blocks until a request to host is allowed by
+// Config.PerHostInterval, reserving the slot.
+func (c *crawler) wait(ctx context.Context, host string) error {
+	c.mu.Lock()
+	slot := time.Now()
+	if next := c.hosts[host]; next.After(slot) {
+		slot = next
+	}
+	c.hosts[host] = slot.Add(c.config.PerHostInterval)
+	c.mu.Unlock()
+
+	if delay := time.Until(slot); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
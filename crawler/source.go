@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadSitemap returns the image URLs of an XML sitemap: those of its
+// <image:loc> elements, from the Google image sitemap extension, or, for
+// sitemaps without them, the page URLs of its <loc> elements. Sitemap
+// indexes are not followed.
+func ReadSitemap(r io.Reader) ([]string, error) {
+	var sitemap struct {
+		URLs []struct {
+			Loc    string `xml:"loc"`
+			Images []struct {
+				Loc string `xml:"loc"`
+			} `xml:"image"`
+		} `xml:"url"`
+	}
+	if err := xml.NewDecoder(r).Decode(&sitemap); err != nil {
+		return nil, fmt.Errorf("sitemap: %w", err)
+	}
+
+	var images, pages []string
+	for _, u := range sitemap.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			pages = append(pages, loc)
+		}
+		for _, image := range u.Images {
+			if loc := strings.TrimSpace(image.Loc); loc != "" {
+				images = append(images, loc)
+			}
+		}
+	}
+	if len(images) > 0 {
+		return images, nil
+	}
+	return pages, nil
+}
+
+// ReadCSV returns the URLs of a CSV file: the column headed "url" if the
+// first record has one, and the first column otherwise. Blank lines and
+// lines starting with # are ignored, so a plain list of URLs, one per line,
+// is read as well.
+func ReadCSV(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var urls []string
+	column := 0
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return urls, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if first {
+			header := false
+			for i, field := range record {
+				if strings.EqualFold(strings.TrimSpace(field), "url") {
+					column, header = i, true
+				}
+			}
+			if header {
+				continue
+			}
+		}
+		if column < len(record) {
+			if url := strings.TrimSpace(record[column]); url != "" {
+				urls = append(urls, url)
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Package cuckoo provides a cuckoo filter, a compact probabilistic set that
+// answers whether an item, such as an image digest, was added. Unlike a
+// Bloom filter it supports deletes, so content that expires can be removed
+// from the set. False positives occur at a rate of about 0.012%; false
+// negatives never do.
+package cuckoo
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math/bits"
+	"sync"
+)
+
+// Config holds options for a Filter.
+type Config struct {
+	// Capacity is the number of items the filter is sized for. Adds may
+	// fail with ErrFull once it is exceeded.
+	Capacity int
+	// MaxKicks bounds the items relocated to make room for an added one.
+	MaxKicks int
+}
+
+var defaultConfig = Config{
+	Capacity: 1 << 20,
+	MaxKicks: 500,
+}
+
+var (
+	// ErrInvalidConfig is returned by New when Capacity or MaxKicks is not
+	// positive.
+	ErrInvalidConfig = errors.New("capacity and max kicks must be positive")
+	// ErrFull is returned by Add when no room can be made for the item.
+	ErrFull = errors.New("cuckoo filter is full")
+	// ErrInvalidData is returned by UnmarshalBinary for data not written by
+	// MarshalBinary.
+	ErrInvalidData = errors.New("invalid cuckoo filter data")
+)
+
+// bucketSize is the number of fingerprints per bucket.
+const bucketSize = 4
+
+// maxLoad is the load factor the number of buckets is sized for.
+const maxLoad = 0.95
+
+// magic starts the serialized form of a Filter, followed by a version byte.
+const (
+	magic   = "CKOO"
+	version = 1
+)
+
+// bucket holds fingerprints; 0 marks an empty slot.
+type bucket [bucketSize]uint16
+
+// victim holds a fingerprint evicted by an Add that ran out of kicks, so no
+// added item is ever lost.
+type victim struct {
+	fingerprint uint16
+	index       uint32
+	used        bool
+}
+
+// Filter is a cuckoo filter of 16-bit fingerprints. Create it with New or
+// by decoding into a zero Filter with UnmarshalBinary. It is safe for
+// concurrent use.
+type Filter struct {
+	mu       sync.RWMutex
+	buckets  []bucket
+	count    int
+	victim   victim
+	maxKicks int
+	// rng picks the fingerprints to relocate; it is deterministic so runs
+	// are reproducible.
+	rng uint64
+}
+
+// New returns an empty Filter.
+// It optionally accepts a custom configuration.
+func New(configs ...Config) (*Filter, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	if config.Capacity <= 0 || config.MaxKicks <= 0 {
+		return nil, ErrInvalidConfig
+	}
+
+	n := uint(float64(config.Capacity)/bucketSize/maxLoad) + 1
+	return &Filter{
+		buckets:  make([]bucket, 1<<bits.Len(n-1)),
+		maxKicks: config.MaxKicks,
+		rng:      1,
+	}, nil
+}
+
+// Add adds item to the filter. Adding an item twice stores it twice, and it
+// then takes two deletes to remove.
+func (f *Filter) Add(item []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.victim.used {
+		return ErrFull
+	}
+	fingerprint, i1, i2 := f.locate(item)
+	if f.buckets[i1].insert(fingerprint) || f.buckets[i2].insert(fingerprint) {
+		f.count++
+		return nil
+	}
+
+	// Relocate fingerprints to their alternate buckets until one fits.
+	index := i1
+	if f.next()&1 == 1 {
+		index = i2
+	}
+	for range f.maxKicks {
+		slot := f.next() % bucketSize
+		fingerprint, f.buckets[index][slot] = f.buckets[index][slot], fingerprint
+		index = f.alternate(index, fingerprint)
+		if f.buckets[index].insert(fingerprint) {
+			f.count++
+			return nil
+		}
+	}
+	f.victim = victim{fingerprint: fingerprint, index: index, used: true}
+	f.count++
+	return nil
+}
+
+// Contains reports whether item was added and not deleted since, or, rarely,
+// whether an item sharing its fingerprint and buckets was.
+func (f *Filter) Contains(item []byte) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	fingerprint, i1, i2 := f.locate(item)
+	if f.victim.used && f.victim.fingerprint == fingerprint && (f.victim.index == i1 || f.victim.index == i2) {
+		return true
+	}
+	return f.buckets[i1].contains(fingerprint) || f.buckets[i2].contains(fingerprint)
+}
+
+// Delete removes item and reports whether it was present. Only delete items
+// that were added: deleting another item sharing their fingerprint would
+// remove them instead.
+func (f *Filter) Delete(item []byte) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fingerprint, i1, i2 := f.locate(item)
+	if f.victim.used && f.victim.fingerprint == fingerprint && (f.victim.index == i1 || f.victim.index == i2) {
+		f.victim.used = false
+		f.count--
+		return true
+	}
+	if !f.buckets[i1].remove(fingerprint) && !f.buckets[i2].remove(fingerprint) {
+		return false
+	}
+	f.count--
+
+	// The delete may have made room for the victim.
+	if v := f.victim; v.used {
+		if f.buckets[v.index].insert(v.fingerprint) || f.buckets[f.alternate(v.index, v.fingerprint)].insert(v.fingerprint) {
+			f.victim.used = false
+		}
+	}
+	return true
+}
+
+// Len returns the number of items in the filter.
+func (f *Filter) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.count
+}
+
+// MarshalBinary encodes the filter, for storing it or sending it to other
+// processes.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data := make([]byte, 0, 24+2*bucketSize*len(f.buckets))
+	data = append(data, magic...)
+	data = append(data, version)
+	var used byte
+	if f.victim.used {
+		used = 1
+	}
+	data = append(data, used)
+	data = binary.LittleEndian.AppendUint16(data, f.victim.fingerprint)
+	data = binary.LittleEndian.AppendUint32(data, f.victim.index)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(f.buckets)))
+	data = binary.LittleEndian.AppendUint64(data, uint64(f.count))
+	for _, b := range f.buckets {
+		for _, fingerprint := range b {
+			data = binary.LittleEndian.AppendUint16(data, fingerprint)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary, replacing the
+// contents of f. A zero Filter can be decoded into; it then uses the
+// default MaxKicks.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < 24 || string(data[:4]) != magic || data[4] != version || data[5] > 1 {
+		return ErrInvalidData
+	}
+	v := victim{
+		used:        data[5] == 1,
+		fingerprint: binary.LittleEndian.Uint16(data[6:]),
+		index:       binary.LittleEndian.Uint32(data[8:]),
+	}
+	n := binary.LittleEndian.Uint32(data[12:])
+	count := binary.LittleEndian.Uint64(data[16:])
+	data = data[24:]
+	if n == 0 || n&(n-1) != 0 || uint64(len(data)) != 2*bucketSize*uint64(n) || v.index >= n {
+		return ErrInvalidData
+	}
+
+	buckets := make([]bucket, n)
+	for i := range buckets {
+		for j := range bucketSize {
+			buckets[i][j] = binary.LittleEndian.Uint16(data[2*(bucketSize*i+j):])
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buckets, f.count, f.victim = buckets, int(count), v
+	if f.maxKicks == 0 {
+		f.maxKicks = defaultConfig.MaxKicks
+	}
+	if f.rng == 0 {
+		f.rng = 1
+	}
+	return nil
+}
+
+// locate returns the fingerprint of item and its two candidate buckets.
+func (f *Filter) locate(item []byte) (uint16, uint32, uint32) {
+	h := fnv.New64a()
+	h.Write(item)
+	sum := h.Sum64()
+
+	fingerprint := uint16(sum >> 48)
+	if fingerprint == 0 {
+		fingerprint = 1
+	}
+	index := uint32(sum) & uint32(len(f.buckets)-1)
+	return fingerprint, index, f.alternate(index, fingerprint)
+}
+
+// alternate returns the other bucket of a fingerprint stored in bucket
+// index. It is its own inverse, so relocations need not know the item.
+func (f *Filter) alternate(index uint32, fingerprint uint16) uint32 {
+	return (index ^ uint32(fingerprint)*0x5bd1e995) & uint32(len(f.buckets)-1)
+}
+
+// next advances the xorshift generator used to pick relocations.
+func (f *Filter) next() uint64 {
+	f.rng ^= f.rng << 13
+	f.rng ^= f.rng >> 7
+	f.rng ^= f.rng << 17
+	return f.rng
+}
+
+func (b *bucket) insert(fingerprint uint16) bool {
+	for i, stored := range b {
+		if stored == 0 {
+			b[i] = fingerprint
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bucket) contains(fingerprint uint16) bool {
+	for _, stored := range b {
+		if stored == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bucket) remove(fingerprint uint16) bool {
+	for i, stored := range b {
+		if stored == fingerprint {
+			b[i] = 0
+			return true
+		}
+	}
+	return false
+}
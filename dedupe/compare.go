@@ -0,0 +1,107 @@
+package dedupe
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/insomnius/tools/index"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Pair is a file of the first directory of CompareDirs matched with a file
+// of the second.
+type Pair struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	// Distance is the hash distance between the files, 0 for exact copies.
+	Distance int `json:"distance"`
+	// Exact reports byte-identical files.
+	Exact bool `json:"exact"`
+}
+
+// Comparison is the outcome of CompareDirs.
+type Comparison struct {
+	// Matches pairs every file of the first directory with the closest
+	// file of the second within the threshold, sorted by the first path.
+	Matches []Pair `json:"matches"`
+	// OnlyA and OnlyB list the files of each directory without a match in
+	// the other, sorted.
+	OnlyA    []string  `json:"only_a"`
+	OnlyB    []string  `json:"only_b"`
+	Failures []Failure `json:"-"`
+}
+
+// CompareDirs hashes the images under dirA and dirB and matches them
+// across the directories, answering whether the photos of one were already
+// imported into the other. Files within threshold bits of each other match;
+// byte-identical files always do. Config.Threshold is ignored.
+// It optionally accepts a custom configuration.
+func CompareDirs(ctx context.Context, dirA, dirB string, threshold int, configs ...Config) (Comparison, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	itemsA, failuresA, err := hashTree(ctx, dirA, config, logger)
+	if err != nil {
+		return Comparison{}, err
+	}
+	itemsB, failuresB, err := hashTree(ctx, dirB, config, logger)
+	if err != nil {
+		return Comparison{}, err
+	}
+	comparison := Comparison{Failures: append(failuresA, failuresB...)}
+
+	byDigest := map[string]int{}
+	ix := index.New()
+	for j, item := range itemsB {
+		byDigest[item.Digest] = j
+		if hash, err := perceptualhash.ParseHash(item.Hash); err == nil {
+			ix.Add(index.Entry{ID: strconv.Itoa(j), Hash: hash})
+		}
+	}
+
+	matched := make([]bool, len(itemsB))
+	for _, item := range itemsA {
+		j, exact := byDigest[item.Digest]
+		distance := 0
+		if !exact {
+			j = -1
+			if hash, err := perceptualhash.ParseHash(item.Hash); err == nil {
+				if matches := ix.Query(hash, threshold); len(matches) > 0 {
+					j, _ = strconv.Atoi(matches[0].ID)
+					distance = matches[0].Distance
+				}
+			}
+		}
+
+		if j < 0 {
+			comparison.OnlyA = append(comparison.OnlyA, item.Paths...)
+			continue
+		}
+		matched[j] = true
+		for _, path := range item.Paths {
+			comparison.Matches = append(comparison.Matches, Pair{A: path, B: itemsB[j].Paths[0], Distance: distance, Exact: exact})
+		}
+	}
+	for j, item := range itemsB {
+		if !matched[j] {
+			comparison.OnlyB = append(comparison.OnlyB, item.Paths...)
+		}
+	}
+
+	slices.SortFunc(comparison.Matches, func(a, b Pair) int { return strings.Compare(a.A, b.A) })
+	slices.Sort(comparison.OnlyA)
+	slices.Sort(comparison.OnlyB)
+	return comparison, nil
+}
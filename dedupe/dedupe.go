@@ -0,0 +1,427 @@
+// Package dedupe finds duplicate images by first grouping byte-identical
+// files with a checksum and then comparing perceptual hashes only across
+// distinct contents.
+package dedupe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Config holds options for a dedupe run.
+type Config struct {
+	// Threshold is the maximum number of differing hash bits for two
+	// contents to be considered duplicates.
+	Threshold int
+	// Extensions lists the file extensions to include, lower-case with dot.
+	Extensions []string
+	// Include and Exclude select files by pattern, such as "node_modules"
+	// or "raw/**", with the syntax documented on perceptualhash.ImagePaths.
+	Include []string
+	Exclude []string
+	// FollowSymlinks descends into symbolically linked directories. Every
+	// file is then collected once, however many links lead to it, so
+	// organizing duplicates never acts on the same file twice; links
+	// forming cycles are logged and skipped.
+	FollowSymlinks bool
+	// Workers is the number of files processed concurrently.
+	Workers int
+	// MaxInFlight bounds the number of files being read or decoded at once,
+	// including calls abandoned after a timeout. The walk blocks until a
+	// slot is free, so memory stays bounded on very large archives. Zero
+	// means Workers.
+	MaxInFlight int
+	// Timeout bounds the time spent on a single file. Files exceeding it are
+	// reported as failures with ErrTimeout. Zero means no limit.
+	Timeout time.Duration
+	// Logger receives warnings about skipped and failed files. Nothing is
+	// logged when it is nil.
+	Logger *slog.Logger
+	// OnProgress, if set, is called after each unit of work: checksumming a
+	// file, then hashing a distinct content. Until checksums are complete,
+	// total assumes every file is distinct; it shrinks once exact copies
+	// are known. Calls are serialized.
+	OnProgress func(done, total int, current string)
+	// Hasher, if set, replaces the default perceptual hash, e.g. with an
+	// algorithm selected by name with perceptualhash.Lookup.
+	Hasher perceptualhash.Hasher
+	// Cache, if set, stores the hashes of the default perceptual hash, so
+	// contents seen by an earlier run are not hashed again.
+	Cache perceptualhash.Cache
+}
+
+var defaultConfig = Config{
+	Threshold:  10,
+	Extensions: []string{".jpg", ".jpeg", ".png"},
+	Workers:    runtime.NumCPU(),
+}
+
+// ErrTimeout is recorded for files that exceed Config.Timeout.
+var ErrTimeout = errors.New("file processing timed out")
+
+// Item is a distinct file content and every path that holds it.
+type Item struct {
+	Digest string   `json:"digest"`
+	Hash   string   `json:"hash"`
+	Paths  []string `json:"paths"`
+}
+
+// Failure records a file that could not be checksummed or hashed.
+type Failure struct {
+	Path string
+	Err  error
+}
+
+// Result is the outcome of a dedupe run.
+type Result struct {
+	// Items holds every distinct content that was hashed successfully.
+	Items []Item
+	// Clusters groups items whose hashes are within the threshold of each
+	// other. Only clusters spanning more than one path are included.
+	Clusters [][]Item
+	Failures []Failure
+}
+
+// Run walks root and reports exact and perceptual duplicates.
+// It optionally accepts a custom configuration.
+func Run(ctx context.Context, root string, configs ...Config) (Result, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	items, failures, err := hashTree(ctx, root, config, logger)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Items: items, Failures: failures}
+
+	// Cluster distinct contents by hash distance
+	result.Clusters = cluster(result.Items, config.Threshold)
+
+	return result, nil
+}
+
+// hashTree walks root, groups byte-identical files and hashes every
+// distinct content once.
+func hashTree(ctx context.Context, root string, config Config, logger *slog.Logger) ([]Item, []Failure, error) {
+	// 1. Collect candidate files
+	paths, err := collect(root, config, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 2. Group byte-identical files by checksum
+	tracker := &progress{report: config.OnProgress, total: 2 * len(paths)}
+	digests := parallel(ctx, config, paths, checksum, func(i int) {
+		tracker.step(paths[i])
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var items []Item
+	var failures []Failure
+	byDigest := map[string]*Item{}
+	var distinct []*Item
+	for i, path := range paths {
+		if digests[i].err != nil {
+			logger.Warn("checksum failed", "path", path, "error", digests[i].err)
+			failures = append(failures, Failure{Path: path, Err: digests[i].err})
+			continue
+		}
+		item, ok := byDigest[digests[i].value]
+		if !ok {
+			item = &Item{Digest: digests[i].value}
+			byDigest[digests[i].value] = item
+			distinct = append(distinct, item)
+		} else {
+			logger.Debug("reusing hash of identical content", "path", path, "original", item.Paths[0])
+		}
+		item.Paths = append(item.Paths, path)
+	}
+
+	// 3. Hash one representative per distinct content
+	tracker.setTotal(len(paths) + len(distinct))
+	dctHasher, err := perceptualhash.New(perceptualhash.WithPipeline(perceptualhash.PipelineConfig{Cache: config.Cache}))
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := parallel(ctx, config, distinct, func(item *Item) (string, error) {
+		if config.Hasher != nil {
+			return hashWith(config.Hasher, item.Paths[0])
+		}
+		return dctHasher.FromPath(item.Paths[0])
+	}, func(i int) {
+		tracker.step(distinct[i].Paths[0])
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for i, item := range distinct {
+		if hashes[i].err != nil {
+			logger.Warn("hashing failed", "path", item.Paths[0], "copies", len(item.Paths), "error", hashes[i].err)
+			for _, path := range item.Paths {
+				failures = append(failures, Failure{Path: path, Err: hashes[i].err})
+			}
+			continue
+		}
+		item.Hash = hashes[i].value
+		items = append(items, *item)
+	}
+
+	return items, failures, nil
+}
+
+// collect returns the files under root selected by the extensions,
+// patterns and symlink handling of config.
+func collect(root string, config Config, logger *slog.Logger) ([]string, error) {
+	walk := perceptualhash.WalkConfig{
+		Extensions: config.Extensions,
+		Include:    config.Include,
+		Exclude:    config.Exclude,
+	}
+	if config.FollowSymlinks {
+		walk.Symlinks = perceptualhash.SymlinkFollow
+		walk.SkipVisited = true
+	}
+	h, err := perceptualhash.New(perceptualhash.WithWalk(walk))
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for path, err := range h.ImagePaths(root) {
+		if errors.Is(err, perceptualhash.ErrSymlinkCycle) {
+			logger.Warn("skipping symbolic link cycle", "path", path)
+			continue
+		}
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// checksum returns the hex encoded SHA-256 of the file at path.
+func checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashWith decodes the image at path as perceptualhash.Decode does, with
+// its format allow-list and guard against decoder panics, and hashes it
+// with h.
+func hashWith(h perceptualhash.Hasher, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	img, _, err := perceptualhash.Decode(data)
+	if err != nil {
+		return "", err
+	}
+	hash, err := h.Hash(img)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+type outcome struct {
+	value string
+	err   error
+}
+
+// progress serializes progress reports from concurrent workers.
+type progress struct {
+	mu     sync.Mutex
+	report func(done, total int, current string)
+	done   int
+	total  int
+}
+
+func (p *progress) step(current string) {
+	if p.report == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	p.report(p.done, p.total, current)
+}
+
+func (p *progress) setTotal(total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total = total
+}
+
+// parallel applies fn to every input using the configured number of workers
+// and returns the outcomes in input order, calling done with each index as
+// it completes. It stops early if ctx is cancelled.
+func parallel[T any](ctx context.Context, config Config, inputs []T, fn func(T) (string, error), done func(int)) []outcome {
+	outcomes := make([]outcome, len(inputs))
+	indexes := make(chan int)
+
+	maxInFlight := config.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = config.Workers
+	}
+	slots := make(chan struct{}, maxInFlight)
+	release := func() { <-slots }
+
+	var wg sync.WaitGroup
+	for range config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				outcomes[i] = withTimeout(config.Timeout, release, func() (string, error) {
+					return fn(inputs[i])
+				})
+				done(i)
+			}
+		}()
+	}
+
+feed:
+	for i := range inputs {
+		// Acquire a slot before handing out work, so the producer blocks
+		// while MaxInFlight files are still being processed.
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			break feed
+		}
+
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			release()
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return outcomes
+}
+
+// withTimeout runs fn and gives up waiting for it after timeout, calling
+// release once fn has actually returned. Decoders cannot be interrupted, so
+// an abandoned call keeps running in the background until it returns, but
+// the worker is freed for the next file.
+func withTimeout(timeout time.Duration, release func(), fn func() (string, error)) outcome {
+	if timeout <= 0 {
+		defer release()
+		value, err := fn()
+		return outcome{value: value, err: err}
+	}
+
+	done := make(chan outcome, 1)
+	go func() {
+		defer release()
+		value, err := fn()
+		done <- outcome{value: value, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result := <-done:
+		return result
+	case <-timer.C:
+		return outcome{err: ErrTimeout}
+	}
+}
+
+// distance returns the number of differing bits between two hexadecimal
+// hashes.
+func distance(a, b string) (int, error) {
+	ha, err := perceptualhash.ParseHash(a)
+	if err != nil {
+		return 0, err
+	}
+	hb, err := perceptualhash.ParseHash(b)
+	if err != nil {
+		return 0, err
+	}
+	return ha.Distance(hb), nil
+}
+
+// cluster links items whose hashes are within threshold of each other and
+// returns the groups that contain more than one path.
+func cluster(items []Item, threshold int) [][]Item {
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := 0; i < len(items); i++ {
+		for j := i + 1; j < len(items); j++ {
+			d, err := distance(items[i].Hash, items[j].Hash)
+			if err != nil || d > threshold {
+				continue
+			}
+			parent[find(i)] = find(j)
+		}
+	}
+
+	groups := map[int][]Item{}
+	var roots []int
+	for i, item := range items {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], item)
+	}
+
+	var clusters [][]Item
+	for _, root := range roots {
+		group := groups[root]
+		if len(group) > 1 || len(group[0].Paths) > 1 {
+			clusters = append(clusters, group)
+		}
+	}
+	return clusters
+}
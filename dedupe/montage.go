@@ -0,0 +1,143 @@
+package dedupe
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/insomnius/tools/thumbnail"
+)
+
+// MontageConfig holds options for Montage.
+type MontageConfig struct {
+	// Columns is the number of thumbnails per row.
+	Columns int
+	// Tile is the width and height each thumbnail is fitted into.
+	Tile int
+}
+
+var defaultMontageConfig = MontageConfig{
+	Columns: 4,
+	Tile:    192,
+}
+
+// Layout of a montage cell, in pixels.
+const (
+	montagePadding = 8
+	montageLabel   = 32
+)
+
+var (
+	montageBackground  = color.RGBA{0x20, 0x20, 0x20, 0xff}
+	montageText        = color.RGBA{0xee, 0xee, 0xee, 0xff}
+	montageExact       = color.RGBA{0x7c, 0xc4, 0x7c, 0xff}
+	montagePlaceholder = color.RGBA{0x60, 0x30, 0x30, 0xff}
+)
+
+// Montage renders a cluster as a contact sheet: a grid with a thumbnail of
+// every path, labeled with its file name and its hash distance to the first
+// item of the cluster. Exact copies are labeled as such. Files that cannot
+// be decoded are shown as a placeholder.
+// It optionally accepts a custom configuration.
+func Montage(cluster []Item, configs ...MontageConfig) *image.RGBA {
+	config := defaultMontageConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	columns := max(config.Columns, 1)
+
+	type cell struct {
+		path  string
+		label string
+		exact bool
+	}
+	var cells []cell
+	for i, item := range cluster {
+		label := "reference"
+		if i > 0 {
+			d, err := distance(cluster[0].Hash, item.Hash)
+			if err != nil {
+				label = "distance ?"
+			} else {
+				label = fmt.Sprintf("distance %d", d)
+			}
+		}
+		for j, path := range item.Paths {
+			if j == 0 {
+				cells = append(cells, cell{path: path, label: label})
+			} else {
+				cells = append(cells, cell{path: path, label: "exact copy", exact: true})
+			}
+		}
+	}
+
+	rows := (len(cells) + columns - 1) / columns
+	cellWidth := config.Tile + montagePadding
+	cellHeight := config.Tile + montageLabel + montagePadding
+	sheet := image.NewRGBA(image.Rect(0, 0, columns*cellWidth+montagePadding, rows*cellHeight+montagePadding))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(montageBackground), image.Point{}, draw.Src)
+
+	for i, c := range cells {
+		x := montagePadding + i%columns*cellWidth
+		y := montagePadding + i/columns*cellHeight
+		tile := image.Rect(x, y, x+config.Tile, y+config.Tile)
+
+		thumb, err := loadThumbnail(c.path, config.Tile)
+		if err != nil {
+			draw.Draw(sheet, tile, image.NewUniform(montagePlaceholder), image.Point{}, draw.Src)
+			c.label = "unreadable"
+		} else {
+			// Center the thumbnail in its tile.
+			size := thumb.Bounds().Size()
+			offset := tile.Min.Add(tile.Size().Sub(size).Div(2))
+			draw.Draw(sheet, image.Rectangle{Min: offset, Max: offset.Add(size)}, thumb, thumb.Bounds().Min, draw.Src)
+		}
+
+		labelColor := montageText
+		if c.exact {
+			labelColor = montageExact
+		}
+		drawLabel(sheet, x, y+config.Tile+14, config.Tile, filepath.Base(c.path), montageText)
+		drawLabel(sheet, x, y+config.Tile+28, config.Tile, c.label, labelColor)
+	}
+	return sheet
+}
+
+// loadThumbnail decodes the image at path and fits it into a size x size
+// square.
+func loadThumbnail(path string, size int) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return thumbnail.Generate(img, thumbnail.Config{Width: size, Height: size}), nil
+}
+
+// drawLabel writes text with its baseline at y, truncated to width pixels.
+func drawLabel(dst draw.Image, x, y, width int, text string, c color.Color) {
+	face := basicfont.Face7x13
+	if maxRunes := width / face.Advance; len([]rune(text)) > maxRunes {
+		runes := []rune(text)
+		text = string(runes[:max(maxRunes-3, 0)]) + "..."
+	}
+	drawer := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	drawer.DrawString(text)
+}
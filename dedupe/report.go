@@ -0,0 +1,136 @@
+package dedupe
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/insomnius/tools/thumbnail"
+)
+
+// ReportConfig holds options for WriteReport.
+type ReportConfig struct {
+	// Title heads the report.
+	Title string
+	// Thumbnail is the width and height each thumbnail is fitted into.
+	Thumbnail int
+	// Quality is the JPEG quality of the thumbnails, from 1 to 100.
+	Quality int
+	// MaxBytes caps the total size of the embedded thumbnails, so the
+	// report stays small enough to email. Once it is reached, the remaining
+	// files are listed without a thumbnail. Zero means no limit.
+	MaxBytes int
+}
+
+var defaultReportConfig = ReportConfig{
+	Title:     "Duplicate images",
+	Thumbnail: 160,
+	Quality:   70,
+	MaxBytes:  10 << 20,
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #202020; color: #eee; }
+section { margin-bottom: 2em; }
+.files { display: flex; flex-wrap: wrap; gap: 1em; }
+figure { margin: 0; width: {{.Tile}}px; }
+figure img, .missing { width: {{.Tile}}px; height: {{.Tile}}px; object-fit: contain; background: #303030; }
+.missing { display: flex; align-items: center; justify-content: center; color: #999; }
+figcaption { font-size: small; word-break: break-all; }
+.exact { color: #7cc47c; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{len .Clusters}} clusters{{if .Omitted}}; {{.Omitted}} thumbnails left out to keep the report small{{end}}.</p>
+{{range $i, $cluster := .Clusters}}<section>
+<h2>Cluster {{inc $i}}</h2>
+<div class="files">
+{{range $cluster}}<figure>
+{{if .Thumbnail}}<img src="{{.Thumbnail}}" alt="">{{else}}<div class="missing">no preview</div>{{end}}
+<figcaption><span{{if .Exact}} class="exact"{{end}}>{{.Label}}</span><br>{{.Path}}</figcaption>
+</figure>
+{{end}}</div>
+</section>
+{{end}}</body>
+</html>
+`))
+
+// reportFile is a file shown in the report.
+type reportFile struct {
+	Path      string
+	Label     string
+	Exact     bool
+	Thumbnail template.URL
+}
+
+// WriteReport writes the clusters of result as a single self-contained HTML
+// page, with a thumbnail of every file embedded as a data URI next to its
+// path and its hash distance to the first item of the cluster. Unlike a
+// list of paths, it can be emailed or attached to a ticket and reviewed by
+// people without access to the files.
+// It optionally accepts a custom configuration.
+func WriteReport(w io.Writer, result Result, configs ...ReportConfig) error {
+	config := defaultReportConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	thumbConfig := thumbnail.Config{
+		Width:   config.Thumbnail,
+		Height:  config.Thumbnail,
+		Filter:  thumbnail.CatmullRom,
+		Format:  "jpeg",
+		Quality: config.Quality,
+	}
+
+	var clusters [][]reportFile
+	embedded, omitted := 0, 0
+	for _, cluster := range result.Clusters {
+		var files []reportFile
+		for i, item := range cluster {
+			label := "reference"
+			if i > 0 {
+				d, err := distance(cluster[0].Hash, item.Hash)
+				if err != nil {
+					label = "distance ?"
+				} else {
+					label = fmt.Sprintf("distance %d", d)
+				}
+			}
+			for j, path := range item.Paths {
+				file := reportFile{Path: path, Label: label}
+				if j > 0 {
+					file.Label, file.Exact = "exact copy", true
+				}
+
+				if config.MaxBytes > 0 && embedded >= config.MaxBytes {
+					omitted++
+				} else {
+					var buf bytes.Buffer
+					if err := thumbnail.FromPath(path, &buf, thumbConfig); err == nil {
+						embedded += buf.Len()
+						file.Thumbnail = template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+					}
+				}
+				files = append(files, file)
+			}
+		}
+		clusters = append(clusters, files)
+	}
+
+	return reportTemplate.Execute(w, map[string]any{
+		"Title":    config.Title,
+		"Tile":     config.Thumbnail,
+		"Clusters": clusters,
+		"Omitted":  omitted,
+	})
+}
@@ -0,0 +1,202 @@
+// Package drift monitors published copies of canonical images, such as
+// those served by CDNs and partners, and reports when their perceptual hash
+// drifts from the canonical one, catching silent recompression, resizing or
+// tampering.
+package drift
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/insomnius/tools/internal/fetch"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Config holds options for a Monitor.
+type Config struct {
+	// Threshold is the largest Hamming distance from the canonical hash
+	// that is not reported as drift.
+	Threshold int
+	// Interval is the time between checks of Run.
+	Interval time.Duration
+	// Concurrency is the number of copies fetched at once.
+	Concurrency int
+	// Timeout bounds each request, including reading the body. Zero means
+	// no limit.
+	Timeout time.Duration
+	// MaxBytes is the largest image fetched. Zero means no limit.
+	MaxBytes int64
+	// UserAgent identifies the monitor to the hosts it fetches from.
+	UserAgent string
+	// Client sends the requests. Nil means http.DefaultClient.
+	Client *http.Client
+	// Hasher computes the perceptual hashes, which must match those of the
+	// canonical images. Nil means the default configuration.
+	Hasher *perceptualhash.DCTHasher
+}
+
+var defaultConfig = Config{
+	Threshold:   6,
+	Interval:    time.Hour,
+	Concurrency: 4,
+	Timeout:     30 * time.Second,
+	MaxBytes:    32 << 20,
+	UserAgent:   "insomnius-tools-drift",
+}
+
+var (
+	// ErrTooLarge is reported for copies larger than Config.MaxBytes.
+	ErrTooLarge = fetch.ErrTooLarge
+	// ErrStatus is reported for responses with an unsuccessful status.
+	ErrStatus = fetch.ErrStatus
+)
+
+// Watch is a canonical image and the URLs of its published copies.
+type Watch struct {
+	ID string
+	// Hash is the perceptual hash of the canonical image.
+	Hash perceptualhash.Hash
+	URLs []string
+}
+
+// Report is the outcome of checking one published copy.
+type Report struct {
+	ID  string
+	URL string
+	// Hash is the hash of the copy and Distance its Hamming distance from
+	// the canonical hash.
+	Hash     perceptualhash.Hash
+	Distance int
+	// Drifted reports a distance above Config.Threshold.
+	Drifted bool
+	// Changed reports that the bytes served differ from those of the
+	// previous check of the URL, even if the hash did not drift.
+	Changed bool
+	// Err reports a copy that could not be fetched or hashed.
+	Err     error
+	Checked time.Time
+}
+
+// Monitor periodically checks the copies of a set of watched images. It is
+// safe for concurrent use.
+type Monitor struct {
+	config  Config
+	watches []Watch
+
+	mu sync.Mutex
+	// digests holds the SHA-256 digest of the last copy fetched from every
+	// URL.
+	digests map[string][sha256.Size]byte
+}
+
+// New returns a monitor of watches.
+// It optionally accepts a custom configuration.
+func New(watches []Watch, configs ...Config) *Monitor {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.Hasher == nil {
+		config.Hasher = new(perceptualhash.DCTHasher)
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultConfig.Interval
+	}
+	return &Monitor{config: config, watches: watches, digests: map[string][sha256.Size]byte{}}
+}
+
+// Check fetches and hashes every copy once and returns a report for each,
+// in the order of the watches and their URLs.
+func (m *Monitor) Check(ctx context.Context) []Report {
+	var reports []Report
+	for _, w := range m.watches {
+		for _, u := range w.URLs {
+			reports = append(reports, Report{ID: w.ID, URL: u})
+		}
+	}
+	canonical := map[string]perceptualhash.Hash{}
+	for _, w := range m.watches {
+		canonical[w.ID] = w.Hash
+	}
+
+	var wg sync.WaitGroup
+	work := make(chan *Report)
+	for range max(m.config.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				m.check(ctx, r, canonical[r.ID])
+			}
+		}()
+	}
+	for i := range reports {
+		work <- &reports[i]
+	}
+	close(work)
+	wg.Wait()
+	return reports
+}
+
+// Run calls Check right away and then every Config.Interval until ctx is
+// done, passing the reports to fn.
+func (m *Monitor) Run(ctx context.Context, fn func([]Report)) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() == nil {
+			fn(m.Check(ctx))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check fills in r for the copy at r.URL.
+func (m *Monitor) check(ctx context.Context, r *Report, canonical perceptualhash.Hash) {
+	r.Checked = time.Now()
+	data, err := m.fetch(ctx, r.URL)
+	if err != nil {
+		r.Err = err
+		return
+	}
+
+	digest := sha256.Sum256(data)
+	m.mu.Lock()
+	previous, seen := m.digests[r.URL]
+	m.digests[r.URL] = digest
+	m.mu.Unlock()
+	r.Changed = seen && previous != digest
+
+	hash, err := m.config.Hasher.FromBytes(data)
+	if err == nil {
+		r.Hash, err = perceptualhash.ParseHash(hash)
+	}
+	if err != nil {
+		r.Err = err
+		return
+	}
+	r.Distance = canonical.Distance(r.Hash)
+	r.Drifted = r.Distance > m.config.Threshold
+}
+
+// fetch downloads the copy at url.
+func (m *Monitor) fetch(ctx context.Context, url string) ([]byte, error) {
+	return fetch.Get(ctx, fetch.Request{
+		Client:    m.config.Client,
+		URL:       url,
+		UserAgent: m.config.UserAgent,
+		Timeout:   m.config.Timeout,
+		MaxBytes:  m.config.MaxBytes,
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/insomnius/tools/perceptualhash"
 )
@@ -18,19 +17,10 @@ func main() {
 
 	var imageHashes []ImageHash
 
-	err := filepath.Walk("./sample", func(path string, info os.FileInfo, err error) error {
+	// Walk the sample folder for JPEG and PNG files
+	for path, err := range new(perceptualhash.DCTHasher).ImagePaths("./sample") {
 		if err != nil {
-			return err
-		}
-
-		// Skip directories and non-image files
-		if info.IsDir() {
-			return nil
-		}
-
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
-			return nil
+			log.Fatal(err)
 		}
 
 		// Create debug folder if needed
@@ -55,10 +45,15 @@ func main() {
 		}
 
 		// Generate hash
-		hash, err := perceptualhash.FromPath(path, conf)
+		hasher, err := perceptualhash.New(perceptualhash.WithConfig(conf))
+		if err != nil {
+			fmt.Printf("Error configuring %s: %v\n", path, err)
+			continue
+		}
+		hash, err := hasher.FromPath(path)
 		if err != nil {
 			fmt.Printf("Error processing %s: %v\n", path, err)
-			return nil // Continue with next file
+			continue
 		}
 
 		// Write result to file and stdout
@@ -69,12 +64,6 @@ func main() {
 			Path: path,
 			Hash: hash,
 		})
-
-		return nil
-	})
-	if err != nil {
-		log.Fatal(err)
-		return
 	}
 
 	var originalImageHash ImageHash
@@ -93,12 +82,19 @@ func main() {
 		if ih.Path == "sample/cat.png" {
 			continue
 		}
-		distance, err := perceptualhash.CompareHashes(originalImageHash.Hash, ih.Hash)
+		original, err := perceptualhash.ParseHash(originalImageHash.Hash)
+		if err != nil {
+			log.Fatal(err)
+		}
+		candidate, err := perceptualhash.ParseHash(ih.Hash)
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Printf("Distance between %s and %s: %d\n", originalImageHash.Path, ih.Path, distance)
-		if distance < 10 {
+		distance := original.Distance(candidate)
+		fmt.Printf("Distance between %s and %s: %d bits\n", originalImageHash.Path, ih.Path, distance)
+		// Resized and recompressed copies stay within DefaultThreshold of the
+		// 64 bits, while unrelated images differ in about half of them.
+		if distance <= perceptualhash.DefaultThreshold {
 			fmt.Printf("Similar image found: %s\n", ih.Path)
 		}
 		fmt.Println("-------------------------")
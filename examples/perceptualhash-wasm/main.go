@@ -0,0 +1,40 @@
+//go:build js && wasm
+
+// Command perceptualhash-wasm exposes perceptual hashing to JavaScript, so
+// images can be hashed in the browser before they are uploaded.
+//
+// Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o phash.wasm ./examples/perceptualhash-wasm
+//
+// and load it with wasm_exec.js from $(go env GOROOT)/lib/wasm. It defines a
+// global perceptualHash(bytes) function taking a Uint8Array holding a JPEG
+// or PNG file and returning an object with either a hash or an error field.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+func main() {
+	hasher := new(perceptualhash.DCTHasher)
+	js.Global().Set("perceptualHash", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) != 1 {
+			return map[string]any{"error": "perceptualHash expects one Uint8Array"}
+		}
+
+		data := make([]byte, args[0].Get("length").Int())
+		js.CopyBytesToGo(data, args[0])
+
+		hash, err := hasher.FromBytes(data)
+		if err != nil {
+			return map[string]any{"error": err.Error()}
+		}
+		return map[string]any{"hash": hash}
+	}))
+
+	// Keep the exported function alive.
+	select {}
+}
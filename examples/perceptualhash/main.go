@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"log"
-	"math/bits"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,21 +15,6 @@ type ImageHash struct {
 	Hash string
 }
 
-func hammingDistance(hash1, hash2 string) int {
-	// Skip if lengths don't match
-	if len(hash1) != len(hash2) {
-		return -1
-	}
-
-	// Count differing bits
-	distance := 0
-	for i := 0; i < len(hash1); i++ {
-		// XOR the bytes and count the bits
-		distance += bits.OnesCount8(hash1[i] ^ hash2[i])
-	}
-	return distance
-}
-
 func main() {
 	// Path to the folder containing images
 	imagesFolder := "./images"
@@ -46,19 +30,9 @@ func main() {
 	var imageHashes []ImageHash
 
 	// Walk through the images folder
-	err = filepath.Walk(imagesFolder, func(path string, info os.FileInfo, err error) error {
+	for path, err := range new(perceptualhash.DCTHasher).ImagePaths(imagesFolder) {
 		if err != nil {
-			return err
-		}
-
-		// Skip directories and non-image files
-		if info.IsDir() {
-			return nil
-		}
-
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
-			return nil
+			log.Fatal("Error walking through directory:", err)
 		}
 
 		// Create debug folder if needed
@@ -83,10 +57,15 @@ func main() {
 		}
 
 		// Generate hash
-		hash, err := perceptualhash.FromPath(path, conf)
+		hasher, err := perceptualhash.New(perceptualhash.WithConfig(conf))
+		if err != nil {
+			fmt.Printf("Error configuring %s: %v\n", path, err)
+			continue
+		}
+		hash, err := hasher.FromPath(path)
 		if err != nil {
 			fmt.Printf("Error processing %s: %v\n", path, err)
-			return nil // Continue with next file
+			continue
 		}
 
 		// Write result to file and stdout
@@ -99,12 +78,6 @@ func main() {
 			Path: path,
 			Hash: hash,
 		})
-
-		return nil
-	})
-
-	if err != nil {
-		log.Fatal("Error walking through directory:", err)
 	}
 
 	fmt.Println("Hashing complete. Results saved to hashes.txt")
@@ -120,20 +93,23 @@ func calculateConfusionMatrix(imageHashes []ImageHash) {
 	// Confusion matrix values
 	var truePositives, falsePositives, trueNegatives, falseNegatives int
 
+	// Compute the Hamming distances between all pairs of images at once
+	hashes := make([]perceptualhash.Hash, len(imageHashes))
+	for i, imageHash := range imageHashes {
+		hash, err := perceptualhash.ParseHash(imageHash.Hash)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hashes[i] = hash
+	}
+	distances := perceptualhash.DistanceMatrix(hashes)
+
 	// Compare each pair of images
 	for i := 0; i < len(imageHashes); i++ {
 		for j := i + 1; j < len(imageHashes); j++ {
-			hash1 := imageHashes[i].Hash
-			hash2 := imageHashes[j].Hash
 			path1 := imageHashes[i].Path
 			path2 := imageHashes[j].Path
-
-			// Compute Hamming distance between hashes
-			distance := hammingDistance(hash1, hash2)
-			if distance < 0 {
-				fmt.Printf("Cannot compare hashes of different lengths: %s and %s\n", path1, path2)
-				continue
-			}
+			distance := distances[i][j]
 
 			// Determine if the images should be similar based on their names
 			// This is a simple heuristic; adjust according to your dataset
@@ -0,0 +1,274 @@
+// Package exif extracts the EXIF metadata most useful for deduplication
+// heuristics: capture time, camera, GPS position, and orientation.
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/insomnius/tools/internal/tiff"
+)
+
+// EXIF tags read by this package.
+const (
+	tagMake               = 0x010f
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+const timeLayout = "2006:01:02 15:04:05"
+
+var ErrNoExif = errors.New("no EXIF metadata found")
+
+// Metadata holds the extracted EXIF fields. Missing fields are left at their
+// zero value.
+type Metadata struct {
+	Make  string
+	Model string
+	// CaptureTime is when the photo was taken. EXIF records local wall-clock
+	// time; without an offset tag it is returned as if it were UTC.
+	CaptureTime time.Time
+	// Orientation is the EXIF orientation from 1 (upright) to 8, or 0 if
+	// absent.
+	Orientation int
+	// GPS is nil when the image has no position.
+	GPS *GPS
+}
+
+// GPS is a position in decimal degrees and meters above sea level.
+type GPS struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+}
+
+// FromPath reads the EXIF metadata of the JPEG, PNG or TIFF file at filePath.
+func FromPath(filePath string) (Metadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer f.Close()
+
+	return Decode(f)
+}
+
+// Decode reads the EXIF metadata of a JPEG, PNG or TIFF stream.
+func Decode(r io.Reader) (Metadata, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(8)
+	if err != nil {
+		return Metadata{}, ErrNoExif
+	}
+
+	var payload []byte
+	switch {
+	case head[0] == 0xff && head[1] == 0xd8:
+		payload, err = jpegPayload(br)
+	case string(head) == "\x89PNG\r\n\x1a\n":
+		payload, err = pngPayload(br)
+	case string(head[:4]) == "II*\x00" || string(head[:4]) == "MM\x00*":
+		payload, err = io.ReadAll(br)
+	default:
+		return Metadata{}, ErrNoExif
+	}
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return parse(payload)
+}
+
+// jpegPayload returns the TIFF structure from the APP1 Exif segment.
+func jpegPayload(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(2); err != nil {
+		return nil, err
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, ErrNoExif
+		}
+		if marker[0] != 0xff {
+			return nil, ErrNoExif
+		}
+		// Start of scan or end of image: no metadata follows.
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return nil, ErrNoExif
+		}
+
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, ErrNoExif
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, ErrNoExif
+		}
+		if marker[1] == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// pngPayload returns the TIFF structure from the eXIf chunk.
+func pngPayload(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(8); err != nil {
+		return nil, err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, ErrNoExif
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+
+		switch string(header[4:]) {
+		case "eXIf":
+			// The chunk is read incrementally rather than allocated from
+			// the declared length, which malformed files can set to 4 GiB.
+			data, err := io.ReadAll(io.LimitReader(r, length))
+			if err != nil || int64(len(data)) != length {
+				return nil, ErrNoExif
+			}
+			return data, nil
+		case "IDAT", "IEND":
+			// eXIf must precede the image data.
+			return nil, ErrNoExif
+		}
+
+		// Skip the chunk data and CRC.
+		if _, err := io.CopyN(io.Discard, r, length+4); err != nil {
+			return nil, ErrNoExif
+		}
+	}
+}
+
+// parse extracts Metadata from a TIFF-structured EXIF payload.
+func parse(payload []byte) (Metadata, error) {
+	t, err := tiff.Parse(payload)
+	if err != nil {
+		return Metadata{}, err
+	}
+	ifd0, err := t.Directory(t.First)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var meta Metadata
+	if f, ok := ifd0[tagMake]; ok {
+		meta.Make = tiff.String(f)
+	}
+	if f, ok := ifd0[tagModel]; ok {
+		meta.Model = tiff.String(f)
+	}
+	if f, ok := ifd0[tagOrientation]; ok {
+		if v, ok := t.Uint(f, 0); ok && v >= 1 && v <= 8 {
+			meta.Orientation = int(v)
+		}
+	}
+
+	dateTime, offsetTime := "", ""
+	if f, ok := ifd0[tagDateTime]; ok {
+		dateTime = tiff.String(f)
+	}
+	if f, ok := ifd0[tagExifIFD]; ok {
+		if pointer, ok := t.Uint(f, 0); ok {
+			if exifIFD, err := t.Directory(pointer); err == nil {
+				if f, ok := exifIFD[tagDateTimeOriginal]; ok {
+					dateTime = tiff.String(f)
+				}
+				if f, ok := exifIFD[tagOffsetTimeOriginal]; ok {
+					offsetTime = tiff.String(f)
+				}
+			}
+		}
+	}
+	meta.CaptureTime = parseTime(dateTime, offsetTime)
+
+	if f, ok := ifd0[tagGPSIFD]; ok {
+		if pointer, ok := t.Uint(f, 0); ok {
+			if gpsIFD, err := t.Directory(pointer); err == nil {
+				meta.GPS = parseGPS(t, gpsIFD)
+			}
+		}
+	}
+
+	return meta, nil
+}
+
+// parseTime parses an EXIF date and optional "+hh:mm" offset.
+func parseTime(dateTime, offset string) time.Time {
+	if dateTime == "" {
+		return time.Time{}
+	}
+	if offset != "" {
+		if t, err := time.Parse(timeLayout+"-07:00", dateTime+offset); err == nil {
+			return t
+		}
+	}
+	t, err := time.Parse(timeLayout, dateTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseGPS converts the GPS IFD to decimal degrees.
+func parseGPS(t *tiff.File, ifd map[uint16]tiff.Field) *GPS {
+	degrees := func(tag uint16) (float64, bool) {
+		f, ok := ifd[tag]
+		if !ok {
+			return 0, false
+		}
+		d, ok1 := t.Rational(f, 0)
+		m, ok2 := t.Rational(f, 1)
+		s, ok3 := t.Rational(f, 2)
+		if !ok1 || !ok2 || !ok3 {
+			return 0, false
+		}
+		return d + m/60 + s/3600, true
+	}
+
+	latitude, ok1 := degrees(tagGPSLatitude)
+	longitude, ok2 := degrees(tagGPSLongitude)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	if f, ok := ifd[tagGPSLatitudeRef]; ok && tiff.String(f) == "S" {
+		latitude = -latitude
+	}
+	if f, ok := ifd[tagGPSLongitudeRef]; ok && tiff.String(f) == "W" {
+		longitude = -longitude
+	}
+
+	gps := &GPS{Latitude: latitude, Longitude: longitude}
+	if f, ok := ifd[tagGPSAltitude]; ok {
+		gps.Altitude, _ = t.Rational(f, 0)
+		if ref, ok := ifd[tagGPSAltitudeRef]; ok {
+			if v, ok := t.Uint(ref, 0); ok && v == 1 {
+				gps.Altitude = -gps.Altitude
+			}
+		}
+	}
+	return gps
+}
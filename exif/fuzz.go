@@ -0,0 +1,18 @@
+package exif
+
+import (
+	"bytes"
+	"io"
+)
+
+// FuzzDecode parses data as metadata and strips it, as a fuzz target for
+// testing.F or go-fuzz. Malformed input must only produce errors, so any
+// panic is a bug. Following the go-fuzz convention, it returns 1 for inputs
+// whose metadata was decoded and 0 otherwise.
+func FuzzDecode(data []byte) int {
+	Strip(io.Discard, bytes.NewReader(data))
+	if _, err := Decode(bytes.NewReader(data)); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,19 @@
+package exif_test
+
+import (
+	"testing"
+
+	"github.com/insomnius/tools/exif"
+)
+
+func FuzzDecode(f *testing.F) {
+	tiff := "II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00\x00\x00\x00\x00"
+	app1 := "Exif\x00\x00" + tiff
+	f.Add([]byte("\xff\xd8\xff\xe1\x00\x22" + app1 + "\xff\xd9"))
+	f.Add([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x1aeXIf" + tiff + "\x00\x00\x00\x00"))
+	f.Add([]byte(tiff))
+	f.Add([]byte("\x89PNG\r\n\x1a\n\xff\xff\xff\xf0eXIf"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		exif.FuzzDecode(data)
+	})
+}
@@ -0,0 +1,250 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/insomnius/tools/internal/tiff"
+)
+
+// StripConfig holds options for Strip.
+type StripConfig struct {
+	// KeepICC keeps embedded color profiles, which hold no personal data
+	// and are needed to display colors correctly.
+	KeepICC bool
+	// KeepOrientation replaces the EXIF metadata of rotated images with a
+	// minimal block holding only the orientation, so they still display
+	// upright.
+	KeepOrientation bool
+}
+
+var defaultStripConfig = StripConfig{
+	KeepICC:         true,
+	KeepOrientation: true,
+}
+
+var (
+	ErrUnsupportedFormat = errors.New("image format is not supported")
+	errInvalidImage      = errors.New("invalid image structure")
+)
+
+// Strip copies the JPEG or PNG image in r to w without its metadata: EXIF,
+// XMP, IPTC, comments, text chunks and, unless kept, color profiles. The
+// image data itself is copied unchanged, so nothing is recompressed.
+// It optionally accepts a custom configuration.
+func Strip(w io.Writer, r io.Reader, configs ...StripConfig) error {
+	config := defaultStripConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	br := bufio.NewReader(r)
+	head, err := br.Peek(8)
+	if err != nil {
+		return ErrUnsupportedFormat
+	}
+	switch {
+	case head[0] == 0xff && head[1] == 0xd8:
+		return stripJPEG(w, br, config)
+	case string(head) == "\x89PNG\r\n\x1a\n":
+		return stripPNG(w, br, config)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
+// stripJPEG copies the segments of a JPEG stream up to the start of scan,
+// dropping metadata, then copies the rest verbatim.
+func stripJPEG(w io.Writer, r *bufio.Reader, config StripConfig) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(soi[:]); err != nil {
+		return err
+	}
+
+	orientation := 0
+	wroteOrientation := false
+	for {
+		// Markers may be preceded by any number of fill bytes.
+		b, err := r.ReadByte()
+		if err != nil {
+			return errInvalidImage
+		}
+		if b != 0xff {
+			return errInvalidImage
+		}
+		marker := byte(0xff)
+		for marker == 0xff {
+			if marker, err = r.ReadByte(); err != nil {
+				return errInvalidImage
+			}
+		}
+
+		// Temporary and restart markers have no length.
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 {
+			if _, err := w.Write([]byte{0xff, marker}); err != nil {
+				return err
+			}
+			continue
+		}
+		// End of image without a scan.
+		if marker == 0xd9 {
+			_, err := w.Write([]byte{0xff, marker})
+			return err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return errInvalidImage
+		}
+		n := int(binary.BigEndian.Uint16(length[:])) - 2
+		if n < 0 {
+			return errInvalidImage
+		}
+		segment := make([]byte, n)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return errInvalidImage
+		}
+
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			if meta, err := parse(segment[6:]); err == nil {
+				orientation = meta.Orientation
+			}
+		}
+
+		// The minimal EXIF block goes right after the JFIF header, if any,
+		// and before everything else.
+		if !wroteOrientation && marker != 0xe0 && config.KeepOrientation && orientation > 1 {
+			if err := writeJPEGSegment(w, 0xe1, append([]byte("Exif\x00\x00"), orientationTIFF(orientation)...)); err != nil {
+				return err
+			}
+			wroteOrientation = true
+		}
+		if !keepJPEGSegment(marker, segment, config) {
+			continue
+		}
+		if err := writeJPEGSegment(w, marker, segment); err != nil {
+			return err
+		}
+
+		// Start of scan: the entropy-coded data and trailing markers hold
+		// no metadata.
+		if marker == 0xda {
+			_, err := io.Copy(w, r)
+			return err
+		}
+	}
+}
+
+// keepJPEGSegment reports whether a segment is image data rather than
+// metadata. The JFIF and Adobe application segments affect decoding and
+// are kept.
+func keepJPEGSegment(marker byte, segment []byte, config StripConfig) bool {
+	switch {
+	case marker == 0xe0:
+		return bytes.HasPrefix(segment, []byte("JFIF\x00"))
+	case marker == 0xe2:
+		return config.KeepICC && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00"))
+	case marker == 0xee:
+		return bytes.HasPrefix(segment, []byte("Adobe"))
+	case marker >= 0xe1 && marker <= 0xef, marker == 0xfe:
+		return false
+	default:
+		return true
+	}
+}
+
+func writeJPEGSegment(w io.Writer, marker byte, segment []byte) error {
+	header := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(segment)
+	return err
+}
+
+// stripPNG copies the chunks of a PNG stream, dropping metadata chunks.
+func stripPNG(w io.Writer, r *bufio.Reader, config StripConfig) error {
+	var signature [8]byte
+	if _, err := io.ReadFull(r, signature[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(signature[:]); err != nil {
+		return err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return errInvalidImage
+		}
+		// The chunk data and CRC are read incrementally rather than
+		// allocated from the declared length, which malformed files can set
+		// to 4 GiB.
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		data, err := io.ReadAll(io.LimitReader(r, length+4))
+		if err != nil || int64(len(data)) != length+4 {
+			return errInvalidImage
+		}
+
+		kind := string(header[4:])
+		switch kind {
+		case "tEXt", "zTXt", "iTXt", "tIME":
+			continue
+		case "iCCP":
+			if !config.KeepICC {
+				continue
+			}
+		case "eXIf":
+			meta, err := parse(data[:length])
+			if err != nil || !config.KeepOrientation || meta.Orientation <= 1 {
+				continue
+			}
+			if err := writePNGChunk(w, "eXIf", orientationTIFF(meta.Orientation)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if kind == "IEND" {
+			return nil
+		}
+	}
+}
+
+func writePNGChunk(w io.Writer, kind string, data []byte) error {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	_, err := w.Write(chunk)
+	return err
+}
+
+// orientationTIFF returns a little-endian TIFF structure whose only IFD
+// holds the orientation tag.
+func orientationTIFF(orientation int) []byte {
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, tagOrientation)
+	data = binary.LittleEndian.AppendUint16(data, tiff.Short)
+	data = binary.LittleEndian.AppendUint32(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, uint16(orientation))
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	// No next IFD.
+	return binary.LittleEndian.AppendUint32(data, 0)
+}
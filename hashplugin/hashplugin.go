@@ -0,0 +1,241 @@
+// Package hashplugin runs image hash algorithms out of process, so models
+// such as ML embeddings can be used next to the built-in hashes without
+// being linked into the Go binary.
+//
+// A plugin is an executable speaking JSON lines over its standard input and
+// output. On start it writes a handshake naming the algorithm and the number
+// of meaningful low bits of its hashes, at most 64:
+//
+//	{"name": "clip", "bits": 64}
+//
+// It then answers every request, in order, with the hash in hexadecimal or
+// an error message:
+//
+//	{"id": 1, "image": "<base64 PNG>"}
+//	{"id": 1, "hash": "8f3a5c0012d4e6b7"}
+//	{"id": 2, "image": "<base64 PNG>"}
+//	{"id": 2, "error": "no face found"}
+//
+// Embeddings are reduced to 64 bits by the plugin, e.g. with the signs of
+// random projections, so that Hamming distances approximate their
+// similarity. The plugin exits when its standard input is closed.
+package hashplugin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/insomnius/tools/imgresize"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Config holds options for a plugin.
+type Config struct {
+	// Timeout bounds the handshake and every request. A plugin exceeding it
+	// is killed. Zero means no limit.
+	Timeout time.Duration
+	// MaxSize is the largest width or height of the images sent to the
+	// plugin. Larger images are shrunk first, keeping their aspect ratio.
+	// Zero sends images as they are.
+	MaxSize int
+	// Stderr receives the standard error of the plugin. Nil discards it.
+	Stderr io.Writer
+}
+
+var defaultConfig = Config{
+	Timeout: 30 * time.Second,
+	MaxSize: 512,
+}
+
+var (
+	// ErrProtocol is returned when a plugin writes malformed output, exits
+	// or times out. The plugin is killed and later calls return the same
+	// error.
+	ErrProtocol = errors.New("plugin protocol violation")
+	// ErrPlugin wraps the error messages reported by a plugin.
+	ErrPlugin = errors.New("plugin could not hash the image")
+	// ErrClosed is returned by a plugin after Close.
+	ErrClosed = errors.New("plugin is closed")
+)
+
+// Hasher is a running plugin. It implements perceptualhash.Hasher and can be
+// registered with perceptualhash.Register. It is safe for concurrent use;
+// requests are sent to the plugin one at a time.
+type Hasher struct {
+	config Config
+	name   string
+	bits   int
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *json.Decoder
+	nextID uint64
+	// err is the error that stopped the plugin, if any.
+	err error
+}
+
+// handshake is the first line written by a plugin.
+type handshake struct {
+	Name string `json:"name"`
+	Bits int    `json:"bits"`
+}
+
+type request struct {
+	ID    uint64 `json:"id"`
+	Image []byte `json:"image"`
+}
+
+type response struct {
+	ID    uint64 `json:"id"`
+	Hash  string `json:"hash"`
+	Error string `json:"error"`
+}
+
+// Start runs the plugin command with args and reads its handshake.
+// It optionally accepts a custom configuration.
+func Start(command string, args []string, configs ...Config) (*Hasher, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = config.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	h := &Hasher{
+		config: config,
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: json.NewDecoder(bufio.NewReader(stdout)),
+	}
+	var hs handshake
+	if err := h.exchange(nil, &hs); err != nil {
+		return nil, h.fail(err)
+	}
+	if hs.Name == "" || hs.Bits <= 0 || hs.Bits > 64 {
+		return nil, h.fail(fmt.Errorf("%w: handshake needs a name and 1 to 64 bits", ErrProtocol))
+	}
+	h.name, h.bits = hs.Name, hs.Bits
+	return h, nil
+}
+
+// Name returns the algorithm name from the handshake.
+func (h *Hasher) Name() string { return h.name }
+
+// Bits returns the number of meaningful bits from the handshake.
+func (h *Hasher) Bits() int { return h.bits }
+
+// Hash sends img to the plugin as PNG and returns the hash it answers.
+func (h *Hasher) Hash(img image.Image) (perceptualhash.Hash, error) {
+	if size := h.config.MaxSize; size > 0 {
+		bounds := img.Bounds()
+		if width, height := bounds.Dx(), bounds.Dy(); width > size || height > size {
+			if width >= height {
+				width, height = size, max(height*size/width, 1)
+			} else {
+				width, height = max(width*size/height, 1), size
+			}
+			img = imgresize.Resize(img, width, height)
+		}
+	}
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return 0, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		return 0, h.err
+	}
+
+	h.nextID++
+	line, err := json.Marshal(request{ID: h.nextID, Image: buf.Bytes()})
+	if err != nil {
+		return 0, err
+	}
+	var resp response
+	if err := h.exchange(append(line, '\n'), &resp); err != nil {
+		return 0, h.fail(err)
+	}
+	if resp.ID != h.nextID {
+		return 0, h.fail(fmt.Errorf("%w: response %d to request %d", ErrProtocol, resp.ID, h.nextID))
+	}
+	if resp.Error != "" {
+		return 0, fmt.Errorf("%w: %s", ErrPlugin, resp.Error)
+	}
+	hash, err := perceptualhash.ParseHash(resp.Hash)
+	if err != nil {
+		return 0, h.fail(fmt.Errorf("%w: %v", ErrProtocol, err))
+	}
+	return hash, nil
+}
+
+// Close closes the standard input of the plugin and waits for it to exit,
+// killing it after Config.Timeout.
+func (h *Hasher) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		// The plugin was already stopped.
+		return nil
+	}
+	h.err = ErrClosed
+
+	h.stdin.Close()
+	if h.config.Timeout > 0 {
+		timer := time.AfterFunc(h.config.Timeout, func() { h.cmd.Process.Kill() })
+		defer timer.Stop()
+	}
+	return h.cmd.Wait()
+}
+
+// exchange writes line, if any, to the plugin input and decodes the next
+// line of its output into v, killing the plugin if both take longer than
+// Config.Timeout, such as when it stops reading a request larger than the
+// pipe buffer.
+func (h *Hasher) exchange(line []byte, v any) error {
+	if h.config.Timeout > 0 {
+		timer := time.AfterFunc(h.config.Timeout, func() { h.cmd.Process.Kill() })
+		defer timer.Stop()
+	}
+	if _, err := h.stdin.Write(line); err != nil {
+		return fmt.Errorf("%w: %v", ErrProtocol, err)
+	}
+	if err := h.stdout.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrProtocol, err)
+	}
+	return nil
+}
+
+// fail kills the plugin after err and returns err, which later calls
+// return too.
+func (h *Hasher) fail(err error) error {
+	h.err = err
+	h.stdin.Close()
+	h.cmd.Process.Kill()
+	h.cmd.Wait()
+	return err
+}
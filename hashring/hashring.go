@@ -0,0 +1,164 @@
+// Package hashring provides a consistent hashing ring, for partitioning
+// keys such as image IDs or digests deterministically among horizontally
+// scaled hashing and indexing workers. Adding or removing a worker only
+// moves the keys of its share of the ring, about 1/n of them.
+package hashring
+
+import (
+	"cmp"
+	"errors"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Config holds options for a Ring.
+type Config struct {
+	// Replicas is the number of points each member has on the ring. More
+	// points spread keys more evenly at the cost of memory.
+	Replicas int
+}
+
+var defaultConfig = Config{
+	Replicas: 128,
+}
+
+// ErrInvalidConfig is returned by New when Replicas is not positive.
+var ErrInvalidConfig = errors.New("replicas must be positive")
+
+// point is a position on the ring owned by a member.
+type point struct {
+	hash   uint64
+	member string
+}
+
+// Ring maps keys to members. Rings with the same members and Replicas map
+// every key to the same member, in any process. It is safe for concurrent
+// use.
+type Ring struct {
+	mu       sync.RWMutex
+	replicas int
+	points   []point
+	members  map[string]bool
+}
+
+// New returns an empty Ring.
+// It optionally accepts a custom configuration.
+func New(configs ...Config) (*Ring, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	if config.Replicas <= 0 {
+		return nil, ErrInvalidConfig
+	}
+	return &Ring{replicas: config.Replicas, members: map[string]bool{}}, nil
+}
+
+// Add adds members to the ring. Members already on it are ignored.
+func (r *Ring) Add(members ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, member := range members {
+		if r.members[member] {
+			continue
+		}
+		r.members[member] = true
+		for i := range r.replicas {
+			r.points = append(r.points, point{hashKey(member + "#" + strconv.Itoa(i)), member})
+		}
+	}
+	r.sort()
+}
+
+// Remove removes member from the ring and reports whether it was on it.
+func (r *Ring) Remove(member string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.members[member] {
+		return false
+	}
+	delete(r.members, member)
+	r.points = slices.DeleteFunc(r.points, func(p point) bool { return p.member == member })
+	return true
+}
+
+// Members returns the members of the ring, sorted.
+func (r *Ring) Members() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := make([]string, 0, len(r.members))
+	for member := range r.members {
+		members = append(members, member)
+	}
+	slices.Sort(members)
+	return members
+}
+
+// Get returns the member owning key, or false if the ring is empty.
+func (r *Ring) Get(key string) (string, bool) {
+	members := r.GetN(key, 1)
+	if len(members) == 0 {
+		return "", false
+	}
+	return members[0], true
+}
+
+// GetN returns up to n distinct members for key, the owner first, then the
+// members that take over its keys if it leaves. They are the replicas of
+// the key when it is stored more than once.
+func (r *Ring) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n = min(n, len(r.members))
+	if n <= 0 {
+		return nil
+	}
+
+	h := hashKey(key)
+	start, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+
+	members := make([]string, 0, n)
+	for i := range r.points {
+		member := r.points[(start+i)%len(r.points)].member
+		if !slices.Contains(members, member) {
+			members = append(members, member)
+			if len(members) == n {
+				break
+			}
+		}
+	}
+	return members
+}
+
+// sort orders the points by hash, breaking the rare ties by member so the
+// order does not depend on the order members were added in.
+func (r *Ring) sort() {
+	slices.SortFunc(r.points, func(a, b point) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.member, b.member))
+	})
+}
+
+// hashKey hashes a key or point name to a position on the ring.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+
+	// FNV barely mixes the last bytes into the high bits, which would
+	// cluster the points of one member.
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+	sum *= 0xc4ceb9fe1a85ec53
+	sum ^= sum >> 33
+	return sum
+}
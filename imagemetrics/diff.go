@@ -0,0 +1,41 @@
+package imagemetrics
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// DiffImage returns a heatmap of where a and b differ structurally, after
+// resizing them to a common size. Each pixel maps the local dissimilarity
+// (1 - SSIM) onto a black-red-yellow-white ramp, so identical regions are
+// black and the strongest differences are white. Empty inputs yield an
+// empty image.
+func DiffImage(a, b image.Image) image.Image {
+	pa, pb, err := commonGray(a, b)
+	if err != nil {
+		return image.NewRGBA(image.Rectangle{})
+	}
+
+	ssim := ssimMap(pa, pb)
+	heatmap := image.NewRGBA(image.Rect(0, 0, ssim.width, ssim.height))
+	for y := 0; y < ssim.height; y++ {
+		for x := 0; x < ssim.width; x++ {
+			level := min(max(1-ssim.at(x, y), 0), 1)
+			heatmap.SetRGBA(x, y, heatColor(level))
+		}
+	}
+	return heatmap
+}
+
+// heatColor maps a level in [0, 1] onto a black-red-yellow-white ramp.
+func heatColor(level float64) color.RGBA {
+	switch {
+	case level < 1.0/3:
+		return color.RGBA{uint8(math.Round(level * 3 * 255)), 0, 0, 255}
+	case level < 2.0/3:
+		return color.RGBA{255, uint8(math.Round((level - 1.0/3) * 3 * 255)), 0, 255}
+	default:
+		return color.RGBA{255, 255, uint8(math.Round((level - 2.0/3) * 3 * 255)), 255}
+	}
+}
@@ -0,0 +1,61 @@
+// Package imagemetrics provides full-reference similarity metrics between
+// two images, for cases where a continuous score is needed rather than a
+// hash distance.
+package imagemetrics
+
+import (
+	"errors"
+	"image"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+var ErrEmptyImage = errors.New("image has no pixels")
+
+// plane is a single channel of intensities in the range [0, 255].
+type plane struct {
+	width, height int
+	pix           []float64
+}
+
+func (p plane) at(x, y int) float64 {
+	return p.pix[y*p.width+x]
+}
+
+// commonGray converts a and b to grayscale planes of the same size. The
+// larger image, by area, is resized to the dimensions of the smaller one.
+func commonGray(a, b image.Image) (plane, plane, error) {
+	size, err := commonSize(a, b)
+	if err != nil {
+		return plane{}, plane{}, err
+	}
+
+	return toGray(a, size), toGray(b, size), nil
+}
+
+// commonSize returns the dimensions of the smaller of a and b, by area.
+func commonSize(a, b image.Image) (image.Point, error) {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Empty() || bb.Empty() {
+		return image.Point{}, ErrEmptyImage
+	}
+
+	size := ab.Size()
+	if bb.Dx()*bb.Dy() < size.X*size.Y {
+		size = bb.Size()
+	}
+	return size, nil
+}
+
+// toGray resizes img to size and returns its luma plane.
+func toGray(img image.Image, size image.Point) plane {
+	gray := imgresize.Gray(img, size.X, size.Y)
+
+	p := plane{width: size.X, height: size.Y, pix: make([]float64, len(gray.Pix))}
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			p.pix[y*size.X+x] = float64(gray.Pix[y*gray.Stride+x])
+		}
+	}
+	return p
+}
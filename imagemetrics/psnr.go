@@ -0,0 +1,51 @@
+package imagemetrics
+
+import (
+	"image"
+	"math"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// MSE returns the mean squared error between a and b over the red, green
+// and blue channels, on a 0-255 scale. Images of different sizes are resized
+// to a common size first.
+func MSE(a, b image.Image) (float64, error) {
+	size, err := commonSize(a, b)
+	if err != nil {
+		return 0, err
+	}
+	ra, rb := toRGBA(a, size), toRGBA(b, size)
+
+	var sum float64
+	for y := 0; y < size.Y; y++ {
+		rowA := ra.Pix[y*ra.Stride : y*ra.Stride+size.X*4]
+		rowB := rb.Pix[y*rb.Stride : y*rb.Stride+size.X*4]
+		for i := 0; i < len(rowA); i += 4 {
+			for c := range 3 {
+				d := float64(rowA[i+c]) - float64(rowB[i+c])
+				sum += d * d
+			}
+		}
+	}
+	return sum / float64(size.X*size.Y*3), nil
+}
+
+// PSNR returns the peak signal-to-noise ratio between a and b in decibels.
+// Identical images yield +Inf. Images of different sizes are resized to a
+// common size first.
+func PSNR(a, b image.Image) (float64, error) {
+	mse, err := MSE(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if mse == 0 {
+		return math.Inf(1), nil
+	}
+	return 10 * math.Log10(255*255/mse), nil
+}
+
+// toRGBA resizes img to size as an RGBA image.
+func toRGBA(img image.Image, size image.Point) *image.RGBA {
+	return imgresize.Resize(img, size.X, size.Y)
+}
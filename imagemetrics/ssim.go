@@ -0,0 +1,113 @@
+package imagemetrics
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// ssimWindow and ssimSigma describe the Gaussian window from Wang et
+	// al., "Image Quality Assessment: From Error Visibility to Structural
+	// Similarity" (2004).
+	ssimWindow = 11
+	ssimSigma  = 1.5
+
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// SSIM returns the mean structural similarity index between a and b, where
+// 1 means identical. Images of different sizes are resized to a common size
+// first.
+func SSIM(a, b image.Image) (float64, error) {
+	pa, pb, err := commonGray(a, b)
+	if err != nil {
+		return 0, err
+	}
+
+	ssim := ssimMap(pa, pb)
+	var sum float64
+	for _, value := range ssim.pix {
+		sum += value
+	}
+	return sum / float64(len(ssim.pix)), nil
+}
+
+// ssimMap returns the local SSIM at every pixel of two equally sized planes.
+func ssimMap(a, b plane) plane {
+	kernel := gaussianKernel(min(ssimWindow, a.width, a.height))
+
+	product := func(p, q plane) plane {
+		out := plane{width: p.width, height: p.height, pix: make([]float64, len(p.pix))}
+		for i := range out.pix {
+			out.pix[i] = p.pix[i] * q.pix[i]
+		}
+		return out
+	}
+
+	muA := blur(a, kernel)
+	muB := blur(b, kernel)
+	sigmaAA := blur(product(a, a), kernel)
+	sigmaBB := blur(product(b, b), kernel)
+	sigmaAB := blur(product(a, b), kernel)
+
+	out := plane{width: a.width, height: a.height, pix: make([]float64, len(a.pix))}
+	for i := range out.pix {
+		ma, mb := muA.pix[i], muB.pix[i]
+		varA := sigmaAA.pix[i] - ma*ma
+		varB := sigmaBB.pix[i] - mb*mb
+		cov := sigmaAB.pix[i] - ma*mb
+
+		out.pix[i] = ((2*ma*mb + ssimC1) * (2*cov + ssimC2)) /
+			((ma*ma + mb*mb + ssimC1) * (varA + varB + ssimC2))
+	}
+	return out
+}
+
+// gaussianKernel returns a normalized one-dimensional Gaussian kernel.
+func gaussianKernel(size int) []float64 {
+	kernel := make([]float64, size)
+	center := float64(size-1) / 2
+
+	var sum float64
+	for i := range kernel {
+		d := float64(i) - center
+		kernel[i] = math.Exp(-d * d / (2 * ssimSigma * ssimSigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// blur convolves p with the separable kernel, clamping at the borders.
+func blur(p plane, kernel []float64) plane {
+	radius := len(kernel) / 2
+	clamp := func(v, limit int) int {
+		return min(max(v, 0), limit-1)
+	}
+
+	tmp := plane{width: p.width, height: p.height, pix: make([]float64, len(p.pix))}
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			var sum float64
+			for k, weight := range kernel {
+				sum += weight * p.at(clamp(x+k-radius, p.width), y)
+			}
+			tmp.pix[y*p.width+x] = sum
+		}
+	}
+
+	out := plane{width: p.width, height: p.height, pix: make([]float64, len(p.pix))}
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			var sum float64
+			for k, weight := range kernel {
+				sum += weight * tmp.at(x, clamp(y+k-radius, p.height))
+			}
+			out.pix[y*p.width+x] = sum
+		}
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+// Package imgresize resizes images with a choice of filters and aspect ratio
+// handling. It is shared by the hashing, thumbnail and metrics packages so
+// they all resample the same way.
+package imgresize
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Filter selects the resampling quality.
+type Filter int
+
+const (
+	// CatmullRom gives the sharpest results and is the slowest.
+	CatmullRom Filter = iota
+	// BiLinear gives smooth results at moderate cost.
+	BiLinear
+	// ApproxBiLinear is fast with medium quality.
+	ApproxBiLinear
+	// NearestNeighbor is fastest and looks blocky when upscaling.
+	NearestNeighbor
+	// Box averages the source pixels covered by each destination pixel. It
+	// is fast and alias-free for large reductions.
+	Box
+)
+
+// Mode selects how the aspect ratio is handled when it differs between the
+// image and the requested size.
+type Mode int
+
+const (
+	// Stretch resizes to exactly the requested size, distorting the image.
+	Stretch Mode = iota
+	// Fit resizes to the largest size within the requested one that keeps
+	// the aspect ratio, so the result may be smaller in one dimension.
+	Fit
+	// Fill resizes to exactly the requested size, keeping the aspect ratio
+	// by cropping the center of the image.
+	Fill
+)
+
+// Config holds resizing options.
+type Config struct {
+	Filter Filter
+	Mode   Mode
+	// NoUpscale keeps the size of the image, or of its cropped part in Fill
+	// mode, when resizing would enlarge it in either dimension.
+	NoUpscale bool
+	// Source is the part of the image to resize. The zero value means the
+	// whole image.
+	Source image.Rectangle
+}
+
+var defaultConfig = Config{
+	Filter: CatmullRom,
+	Mode:   Stretch,
+}
+
+var box = &draw.Kernel{
+	Support: 0.5,
+	At: func(t float64) float64 {
+		return 1
+	},
+}
+
+// Interpolator returns the x/image interpolator implementing f.
+func (f Filter) Interpolator() draw.Interpolator {
+	switch f {
+	case BiLinear:
+		return draw.BiLinear
+	case ApproxBiLinear:
+		return draw.ApproxBiLinear
+	case NearestNeighbor:
+		return draw.NearestNeighbor
+	case Box:
+		return box
+	default:
+		return draw.CatmullRom
+	}
+}
+
+// Resize returns img resized to width x height as an RGBA image, keeping
+// transparency.
+// It optionally accepts a custom configuration.
+func Resize(img image.Image, width, height int, configs ...Config) *image.RGBA {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	size, source := plan(img.Bounds(), width, height, config)
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+	scale(dst, img, source, config.Filter, draw.Src)
+	return dst
+}
+
+// Gray returns img resized to width x height as a grayscale image, with
+// transparent areas composited over black. The pixels are stored without
+// padding, Stride equal to the width, so they can be processed as one flat
+// slice.
+// It optionally accepts a custom configuration.
+func Gray(img image.Image, width, height int, configs ...Config) *image.Gray {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	size, source := plan(img.Bounds(), width, height, config)
+	dst := image.NewGray(image.Rectangle{Max: size})
+	scale(dst, img, source, config.Filter, draw.Over)
+	return dst
+}
+
+// scale draws the source rectangle of img over all of dst.
+func scale(dst draw.Image, img image.Image, source image.Rectangle, filter Filter, op draw.Op) {
+	if source.Size() == dst.Bounds().Size() {
+		draw.Draw(dst, dst.Bounds(), img, source.Min, op)
+		return
+	}
+	filter.Interpolator().Scale(dst, dst.Bounds(), img, source, op, nil)
+}
+
+// plan returns the output size and the source rectangle to resize for the
+// requested size.
+func plan(bounds image.Rectangle, width, height int, config Config) (image.Point, image.Rectangle) {
+	source := bounds
+	if !config.Source.Empty() {
+		source = config.Source.Intersect(bounds)
+	}
+	width, height = max(width, 1), max(height, 1)
+	src := source.Size()
+	if src.X <= 0 || src.Y <= 0 {
+		return image.Pt(width, height), source
+	}
+
+	size := image.Pt(width, height)
+	switch config.Mode {
+	case Fit:
+		if src.X*height > src.Y*width {
+			size = image.Pt(width, max(1, src.Y*width/src.X))
+		} else {
+			size = image.Pt(max(1, src.X*height/src.Y), height)
+		}
+	case Fill:
+		// Crop the source to the requested aspect ratio.
+		if src.X*height > src.Y*width {
+			w := max(1, src.Y*width/height)
+			source.Min.X += (src.X - w) / 2
+			source.Max.X = source.Min.X + w
+		} else {
+			h := max(1, src.X*height/width)
+			source.Min.Y += (src.Y - h) / 2
+			source.Max.Y = source.Min.Y + h
+		}
+	}
+
+	if config.NoUpscale && (size.X > source.Dx() || size.Y > source.Dy()) {
+		size = source.Size()
+	}
+	return size, source
+}
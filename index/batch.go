@@ -0,0 +1,134 @@
+package index
+
+import "sync"
+
+// Duplicate is a batch entry that was within the dedupe radius of an entry
+// already in the index.
+type Duplicate struct {
+	Entry Entry
+	// Existing is the closest indexed entry it matched.
+	Existing Match
+}
+
+// BatchResult summarizes an AddBatch call.
+type BatchResult struct {
+	// Inserted counts the entries added to the index.
+	Inserted int
+	// Duplicates lists the entries matching an existing entry. They are
+	// skipped unless Config.KeepDuplicates is set.
+	Duplicates []Duplicate
+}
+
+// AddBatch inserts entries under a single lock. If dedupeRadius is not
+// negative, entries within that many bits of an indexed entry, including
+// one added earlier in the same batch, are reported as duplicates. Matches
+// against an entry with the same ID do not count, so re-adding an entry
+// still replaces it.
+func (ix *Index) AddBatch(entries []Entry, dedupeRadius int) BatchResult {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	var result BatchResult
+	for _, e := range entries {
+		if dedupeRadius >= 0 {
+			if existing, ok := ix.closest(e, dedupeRadius); ok {
+				result.Duplicates = append(result.Duplicates, Duplicate{Entry: e, Existing: existing})
+				if !ix.config.KeepDuplicates {
+					continue
+				}
+			}
+		}
+
+		ix.replace(e)
+		result.Inserted++
+	}
+	return result
+}
+
+// AddBatch inserts entries like Index.AddBatch. Without deduplication the
+// shards are filled in parallel.
+func (s *Sharded) AddBatch(entries []Entry, dedupeRadius int) BatchResult {
+	if dedupeRadius >= 0 {
+		var result BatchResult
+		for _, e := range entries {
+			if existing, ok := firstOther(s.Query(e.Hash, dedupeRadius), e.ID); ok {
+				result.Duplicates = append(result.Duplicates, Duplicate{Entry: e, Existing: existing})
+				if !s.config.KeepDuplicates {
+					continue
+				}
+			}
+			s.Add(e)
+			result.Inserted++
+		}
+		return result
+	}
+
+	// As with sequential Adds, only the last entry with a given ID is kept,
+	// so the entries are resolved in input order before fanning out.
+	last := make(map[string]int, len(entries))
+	for i, e := range entries {
+		last[e.ID] = i
+	}
+	groups := make([][]Entry, len(s.shards))
+	for i, e := range entries {
+		if last[e.ID] != i {
+			continue
+		}
+		shard := s.shardOf(e.Hash)
+		groups[shard] = append(groups[shard], e)
+	}
+
+	var wg sync.WaitGroup
+	for shard, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.shards[shard].AddBatch(group, -1)
+		}()
+	}
+	wg.Wait()
+
+	for shard, group := range groups {
+		for _, e := range group {
+			s.mu.Lock()
+			previous, ok := s.owners[e.ID]
+			s.owners[e.ID] = shard
+			s.mu.Unlock()
+
+			if ok && previous != shard {
+				s.shards[previous].Remove(e.ID)
+			}
+		}
+	}
+	return BatchResult{Inserted: len(entries)}
+}
+
+// closest returns the closest live entry within radius of e that has a
+// different ID. The caller holds the lock.
+func (ix *Index) closest(e Entry, radius int) (Match, bool) {
+	var best Match
+	found := false
+	ix.search(e.Hash, radius, func(candidate Entry, distance int) {
+		if candidate.ID == e.ID {
+			return
+		}
+		if !found || distance < best.Distance || (distance == best.Distance && candidate.ID < best.ID) {
+			best = Match{Entry: candidate, Distance: distance}
+			found = true
+		}
+	})
+	return best, found
+}
+
+// firstOther returns the first match whose ID differs from id.
+func firstOther(matches []Match, id string) (Match, bool) {
+	for _, m := range matches {
+		if m.ID != id {
+			return m, true
+		}
+	}
+	return Match{}, false
+}
@@ -0,0 +1,39 @@
+package index_test
+
+import (
+	"testing"
+
+	"github.com/insomnius/tools/index"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+func TestShardedAddBatchDuplicateIDAcrossShards(t *testing.T) {
+	first := perceptualhash.Hash(0xff00_0000_0000_0000)
+	second := perceptualhash.Hash(0x0000_0000_0000_00ff)
+	// The later copy of a goes to a lower shard, which a per-shard
+	// reconciliation visits first.
+
+	for _, existing := range []bool{false, true} {
+		s := index.NewSharded(index.Config{ShardBits: 4})
+		if existing {
+			s.Add(index.Entry{ID: "a", Hash: first})
+		}
+		s.AddBatch([]index.Entry{
+			{ID: "a", Hash: first},
+			{ID: "b", Hash: first},
+			{ID: "a", Hash: second},
+		}, -1)
+
+		if got := s.Len(); got != 2 {
+			t.Errorf("existing=%v: Len = %d, want 2", existing, got)
+		}
+		for _, m := range s.Query(first, 0) {
+			if m.ID == "a" {
+				t.Errorf("existing=%v: stale copy of a left at %v", existing, first)
+			}
+		}
+		if matches := s.Query(second, 0); len(matches) != 1 || matches[0].ID != "a" {
+			t.Errorf("existing=%v: Query(second) = %v, want a", existing, matches)
+		}
+	}
+}
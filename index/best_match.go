@@ -0,0 +1,20 @@
+package index
+
+import "github.com/insomnius/tools/perceptualhash"
+
+// BestMatch scans candidates for the entry closest to query and returns it
+// with its distance, or false if none is within threshold bits. Ties go to
+// the earliest candidate. It needs no index, which suits one-off
+// comparisons against small sets.
+func BestMatch(query perceptualhash.Hash, candidates []Entry, threshold int) (Entry, int, bool) {
+	best, bestDistance := -1, threshold+1
+	for i, candidate := range candidates {
+		if distance := query.Distance(candidate.Hash); distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	if best < 0 {
+		return Entry{}, 0, false
+	}
+	return candidates[best], bestDistance, true
+}
@@ -0,0 +1,132 @@
+package index
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// node is a BK-tree node. Every child lies at distance dist from its parent,
+// so by the triangle inequality a search for radius r around a hash at
+// distance d from the parent only needs children with |dist - d| <= r.
+//
+// Removed entries stay in the tree as tombstones to keep it valid.
+type node struct {
+	entry    Entry
+	dist     int
+	removed  bool
+	children []*node
+}
+
+// replace inserts e, burying any entry with the same ID and applying the
+// default TTL. The caller holds the write lock.
+func (ix *Index) replace(e Entry) {
+	if e.Expires.IsZero() && ix.config.TTL > 0 {
+		e.Expires = time.Now().Add(ix.config.TTL)
+	}
+	if old, ok := ix.nodes[e.ID]; ok {
+		delete(ix.nodes, e.ID)
+		ix.bury(old)
+	}
+	ix.nodes[e.ID] = ix.insert(e)
+}
+
+// insert adds e to the tree and returns its node. The caller holds the
+// write lock.
+func (ix *Index) insert(e Entry) *node {
+	n := &node{entry: e}
+	if ix.root == nil {
+		ix.root = n
+		return n
+	}
+
+	parent := ix.root
+	for {
+		n.dist = parent.entry.Hash.Distance(e.Hash)
+		next := parent.child(n.dist)
+		if next == nil {
+			parent.children = append(parent.children, n)
+			return n
+		}
+		parent = next
+	}
+}
+
+// bury marks n as removed and compacts the tree if needed. The caller
+// holds the write lock and has already dropped n from ix.nodes.
+func (ix *Index) bury(n *node) {
+	n.removed = true
+	ix.tombstones++
+	ix.compact()
+}
+
+// compact rebuilds the tree once tombstones outnumber live entries, so
+// their memory is reclaimed. The caller holds the write lock.
+func (ix *Index) compact() {
+	if ix.tombstones <= len(ix.nodes) {
+		return
+	}
+
+	ix.root = nil
+	ix.tombstones = 0
+	for id, old := range ix.nodes {
+		ix.nodes[id] = ix.insert(old.entry)
+	}
+}
+
+// child returns the child at distance dist, or nil.
+func (n *node) child(dist int) *node {
+	for _, c := range n.children {
+		if c.dist == dist {
+			return c
+		}
+	}
+	return nil
+}
+
+// search calls fn for every live, unexpired entry within radius of h. The
+// caller holds the read lock.
+func (ix *Index) search(h perceptualhash.Hash, radius int, fn func(e Entry, distance int)) {
+	ix.queries.Add(1)
+	if ix.root == nil {
+		return
+	}
+
+	now := time.Now()
+	var visited, matched uint64
+	defer func() {
+		ix.visited.Add(visited)
+		ix.matches.Add(matched)
+	}()
+
+	stack := []*node{ix.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		visited++
+
+		d := n.entry.Hash.Distance(h)
+		if d <= radius && !n.removed && !n.entry.expired(now) {
+			matched++
+			fn(n.entry, d)
+		}
+		for _, c := range n.children {
+			if c.dist >= d-radius && c.dist <= d+radius {
+				stack = append(stack, c)
+			}
+		}
+	}
+}
+
+// sortMatches orders matches by distance, then color distance, then ID.
+func sortMatches(matches []Match) {
+	slices.SortFunc(matches, func(a, b Match) int {
+		return cmp.Or(
+			cmp.Compare(a.Distance, b.Distance),
+			cmp.Compare(a.ColorDistance, b.ColorDistance),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+}
@@ -0,0 +1,118 @@
+package index
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Bounded is an index that stays within a memory budget by evicting the
+// least recently matched entries, for deployments with limited RAM. Adding
+// an entry counts as a match. It is safe for concurrent use.
+type Bounded struct {
+	index   *Index
+	budget  int64
+	onEvict func(Entry)
+
+	mu       sync.Mutex
+	lru      *list.List
+	elements map[string]*list.Element
+	used     int64
+}
+
+// NewBounded returns an empty memory-bounded index.
+// It optionally accepts a custom configuration.
+func NewBounded(configs ...Config) *Bounded {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	return &Bounded{
+		index:    New(config),
+		budget:   config.MemoryBudget,
+		onEvict:  config.OnEvict,
+		lru:      list.New(),
+		elements: map[string]*list.Element{},
+	}
+}
+
+// Add inserts e, replacing any entry with the same ID, and evicts the least
+// recently matched entries while the index is over budget.
+func (b *Bounded) Add(e Entry) {
+	b.mu.Lock()
+	if element, ok := b.elements[e.ID]; ok {
+		b.used -= entrySize(element.Value.(Entry))
+		element.Value = e
+		b.lru.MoveToFront(element)
+	} else {
+		b.elements[e.ID] = b.lru.PushFront(e)
+	}
+	b.used += entrySize(e)
+	b.index.Add(e)
+
+	var evicted []Entry
+	for b.used > b.budget && b.lru.Len() > 1 {
+		oldest := b.lru.Remove(b.lru.Back()).(Entry)
+		delete(b.elements, oldest.ID)
+		b.used -= entrySize(oldest)
+		b.index.Remove(oldest.ID)
+		evicted = append(evicted, oldest)
+	}
+	b.mu.Unlock()
+
+	if b.onEvict != nil {
+		for _, e := range evicted {
+			b.onEvict(e)
+		}
+	}
+}
+
+// Remove deletes the entry with the given ID and reports whether it existed.
+func (b *Bounded) Remove(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	element, ok := b.elements[id]
+	if !ok {
+		return false
+	}
+	b.lru.Remove(element)
+	delete(b.elements, id)
+	b.used -= entrySize(element.Value.(Entry))
+	return b.index.Remove(id)
+}
+
+// Len returns the number of entries in the index.
+func (b *Bounded) Len() int {
+	return b.index.Len()
+}
+
+// Query returns the entries whose hash is within radius bits of h, closest
+// first, and marks them as recently matched.
+func (b *Bounded) Query(h perceptualhash.Hash, radius int) []Match {
+	matches := b.index.Query(h, radius)
+	b.touch(matches)
+	return matches
+}
+
+// QueryColor is like Query but additionally requires the color hashes to be
+// within Config.ColorRadius bits.
+func (b *Bounded) QueryColor(h, color perceptualhash.Hash, radius int) []Match {
+	matches := b.index.QueryColor(h, color, radius)
+	b.touch(matches)
+	return matches
+}
+
+// touch moves matched entries to the front of the LRU list.
+func (b *Bounded) touch(matches []Match) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, m := range matches {
+		// The entry may have been evicted since the query.
+		if element, ok := b.elements[m.ID]; ok {
+			b.lru.MoveToFront(element)
+		}
+	}
+}
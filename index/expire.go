@@ -0,0 +1,86 @@
+package index
+
+import (
+	"context"
+	"time"
+)
+
+// Sweeper is implemented by every index type.
+type Sweeper interface {
+	// Sweep removes expired entries and returns how many were removed.
+	Sweep() int
+}
+
+// SweepEvery calls s.Sweep every interval until ctx is done, so ephemeral
+// entries are dropped without explicit deletes.
+func SweepEvery(ctx context.Context, s Sweeper, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
+
+// Sweep removes expired entries and returns how many were removed.
+func (ix *Index) Sweep() int {
+	return len(ix.sweep(time.Now()))
+}
+
+// Sweep removes expired entries and returns how many were removed.
+func (s *Sharded) Sweep() int {
+	now := time.Now()
+	removed := 0
+	for shard, index := range s.shards {
+		expired := index.sweep(now)
+		removed += len(expired)
+
+		s.mu.Lock()
+		for _, e := range expired {
+			if s.owners[e.ID] == shard {
+				delete(s.owners, e.ID)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return removed
+}
+
+// Sweep removes expired entries and returns how many were removed.
+func (b *Bounded) Sweep() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	expired := b.index.sweep(time.Now())
+	for _, e := range expired {
+		if element, ok := b.elements[e.ID]; ok {
+			b.lru.Remove(element)
+			delete(b.elements, e.ID)
+			b.used -= entrySize(element.Value.(Entry))
+		}
+	}
+	return len(expired)
+}
+
+// sweep removes the entries expired at now and returns them.
+func (ix *Index) sweep(now time.Time) []Entry {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	var expired []Entry
+	for id, n := range ix.nodes {
+		if n.entry.expired(now) {
+			delete(ix.nodes, id)
+			n.removed = true
+			ix.tombstones++
+			expired = append(expired, n.entry)
+		}
+	}
+	ix.compact()
+	return expired
+}
@@ -0,0 +1,38 @@
+package index
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+func FuzzParseTable(f *testing.F) {
+	for _, bands := range []int{1, 4, 8} {
+		var buf bytes.Buffer
+		entries := []Entry{
+			{ID: "a", Hash: 0x2d52af2450a2552a},
+			{ID: "b", Hash: 0x2d52af2450a2552b},
+			{ID: "long identifier", Hash: 0xffff0000ffff0000},
+		}
+		if err := WriteTable(&buf, entries, Config{Bands: bands}); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+		f.Add(buf.Bytes()[:buf.Len()-3])
+		f.Add(corruptOrder(buf.Bytes()))
+	}
+	f.Add([]byte("PHTB\x01\x00\x04\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		table, err := parseTable(data)
+		if err != nil {
+			return
+		}
+		// Queries must not fail on tables that do not pass Verify either.
+		_ = table.Verify()
+		for _, h := range []perceptualhash.Hash{0, 0x2d52af2450a2552a, 1<<64 - 1} {
+			table.Query(h, 2)
+			table.Query(h, 64)
+		}
+	})
+}
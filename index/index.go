@@ -0,0 +1,161 @@
+// Package index stores perceptual hashes for fast near-duplicate lookups.
+package index
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Entry is an indexed item.
+type Entry struct {
+	// ID identifies the item, e.g. a path or a database key. Adding an entry
+	// with an existing ID replaces it.
+	ID   string
+	Hash perceptualhash.Hash
+	// Color is the item's perceptualhash.ColorHash. It is only consulted by
+	// QueryColor and may be left zero otherwise.
+	Color perceptualhash.Hash
+	// Expires is when the entry ages out of the index. Queries ignore
+	// expired entries and Sweep removes them. The zero value means
+	// Config.TTL after adding, or never if that is zero too.
+	Expires time.Time
+}
+
+// expired reports whether e has expired at now.
+func (e Entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// Match is an entry found by a query.
+type Match struct {
+	Entry
+	// Distance is the Hamming distance between the query and entry hashes.
+	Distance int
+	// ColorDistance is the Hamming distance between the color hashes. It is
+	// only set by QueryColor.
+	ColorDistance int
+}
+
+// Config holds options for an index.
+type Config struct {
+	// ColorRadius is the maximum color hash distance accepted by QueryColor.
+	ColorRadius int
+	// ShardBits is the number of leading hash bits that select the shard of
+	// an entry in a Sharded index, giving 1<<ShardBits shards.
+	ShardBits int
+	// MemoryBudget is the approximate number of bytes a Bounded index may
+	// use before evicting entries.
+	MemoryBudget int64
+	// OnEvict, if set, receives every entry a Bounded index evicts, e.g. to
+	// spill it to a persistent store. It is called without locks held.
+	OnEvict func(Entry)
+	// KeepDuplicates makes AddBatch insert duplicates anyway, only flagging
+	// them in its result.
+	KeepDuplicates bool
+	// TTL is the lifetime of entries added without an expiry time. Zero
+	// means they never expire.
+	TTL time.Duration
+	// Bands is the number of band tables WriteTable stores: 1, 2, 4 or 8.
+	// Table queries within fewer bits than bands are lookups; more bands
+	// take more space.
+	Bands int
+}
+
+var defaultConfig = Config{
+	ColorRadius:  6,
+	ShardBits:    8,
+	MemoryBudget: 64 << 20,
+	Bands:        4,
+}
+
+// Index is a BK-tree of perceptual hashes. It is safe for concurrent use.
+type Index struct {
+	config Config
+
+	mu         sync.RWMutex
+	root       *node
+	nodes      map[string]*node
+	tombstones int
+
+	queries atomic.Uint64
+	matches atomic.Uint64
+	visited atomic.Uint64
+}
+
+// New returns an empty index.
+// It optionally accepts a custom configuration.
+func New(configs ...Config) *Index {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	return &Index{config: config, nodes: map[string]*node{}}
+}
+
+// Add inserts e, replacing any entry with the same ID.
+func (ix *Index) Add(e Entry) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.replace(e)
+}
+
+// Remove deletes the entry with the given ID and reports whether it existed.
+func (ix *Index) Remove(id string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	n, ok := ix.nodes[id]
+	if !ok {
+		return false
+	}
+	delete(ix.nodes, id)
+	ix.bury(n)
+	return true
+}
+
+// Len returns the number of entries in the index, including expired ones
+// that have not been swept yet.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.nodes)
+}
+
+// Query returns the entries whose hash is within radius bits of h, closest
+// first.
+func (ix *Index) Query(h perceptualhash.Hash, radius int) []Match {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var matches []Match
+	ix.search(h, radius, func(e Entry, distance int) {
+		matches = append(matches, Match{Entry: e, Distance: distance})
+	})
+	sortMatches(matches)
+	return matches
+}
+
+// QueryColor is like Query but additionally requires the color hashes to be
+// within Config.ColorRadius bits. Requiring both rules out near-monochrome
+// images that only differ in color, such as product shots in different
+// colorways, which the grayscale hash alone considers identical.
+func (ix *Index) QueryColor(h, color perceptualhash.Hash, radius int) []Match {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var matches []Match
+	ix.search(h, radius, func(e Entry, distance int) {
+		colorDistance := e.Color.Distance(color)
+		if colorDistance > ix.config.ColorRadius {
+			return
+		}
+		matches = append(matches, Match{Entry: e, Distance: distance, ColorDistance: colorDistance})
+	})
+	sortMatches(matches)
+	return matches
+}
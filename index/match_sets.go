@@ -0,0 +1,92 @@
+package index
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// maxSetBands bounds the number of bands MatchSets splits hashes into.
+// Beyond it bands are so narrow that nearly every entry is a candidate and
+// a plain scan is faster.
+const maxSetBands = 8
+
+// Pair is a match between an entry of each set passed to MatchSets.
+type Pair struct {
+	A, B     Entry
+	Distance int
+}
+
+// MatchSets returns every pair of an entry of a and an entry of b whose
+// hashes are within threshold bits, closest first, with ties broken by the
+// IDs of A and B. It suits comparing an import batch against a catalog:
+// the hashes are split into threshold+1 bands and b is indexed by each, so
+// that by the pigeonhole principle only entries agreeing with an entry of
+// a on a whole band are compared, rather than all |a|·|b| pairs. Large
+// thresholds fall back to comparing all pairs. Expiry times are ignored.
+func MatchSets(a, b []Entry, threshold int) []Pair {
+	if threshold < 0 || len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+
+	var pairs []Pair
+	bands := threshold + 1
+	if bands > maxSetBands {
+		for _, x := range a {
+			for _, y := range b {
+				if distance := x.Hash.Distance(y.Hash); distance <= threshold {
+					pairs = append(pairs, Pair{A: x, B: y, Distance: distance})
+				}
+			}
+		}
+		sortPairs(pairs)
+		return pairs
+	}
+
+	tables := make([]map[uint64][]int32, bands)
+	for band := range tables {
+		tables[band] = make(map[uint64][]int32)
+		for j, y := range b {
+			key := bandKey(y.Hash, band, bands)
+			tables[band][key] = append(tables[band][key], int32(j))
+		}
+	}
+
+	for _, x := range a {
+		for band, table := range tables {
+			for _, j := range table[bandKey(x.Hash, band, bands)] {
+				y := b[j]
+				if agreesBefore(x.Hash, y.Hash, band, bands) {
+					continue
+				}
+				if distance := x.Hash.Distance(y.Hash); distance <= threshold {
+					pairs = append(pairs, Pair{A: x, B: y, Distance: distance})
+				}
+			}
+		}
+	}
+	sortPairs(pairs)
+	return pairs
+}
+
+// agreesBefore reports whether x and y agree on a band before band, and
+// were therefore already compared.
+func agreesBefore(x, y perceptualhash.Hash, band, bands int) bool {
+	for earlier := range band {
+		if bandKey(x, earlier, bands) == bandKey(y, earlier, bands) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortPairs(pairs []Pair) {
+	slices.SortFunc(pairs, func(p, q Pair) int {
+		return cmp.Or(
+			cmp.Compare(p.Distance, q.Distance),
+			cmp.Compare(p.A.ID, q.A.ID),
+			cmp.Compare(p.B.ID, q.B.ID),
+		)
+	})
+}
@@ -0,0 +1,65 @@
+package index
+
+import (
+	"context"
+	"io"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// QueryImage decodes and hashes the image read from r and returns its hash
+// along with the entries within radius bits of it.
+func (ix *Index) QueryImage(ctx context.Context, r io.Reader, radius int) (perceptualhash.Hash, []Match, error) {
+	h, err := hashImage(ctx, r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return h, ix.Query(h, radius), nil
+}
+
+// QueryImage decodes and hashes the image read from r and returns its hash
+// along with the entries within radius bits of it.
+func (s *Sharded) QueryImage(ctx context.Context, r io.Reader, radius int) (perceptualhash.Hash, []Match, error) {
+	h, err := hashImage(ctx, r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return h, s.Query(h, radius), nil
+}
+
+// QueryImage decodes and hashes the image read from r and returns its hash
+// along with the entries within radius bits of it.
+func (b *Bounded) QueryImage(ctx context.Context, r io.Reader, radius int) (perceptualhash.Hash, []Match, error) {
+	h, err := hashImage(ctx, r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return h, b.Query(h, radius), nil
+}
+
+// hashImage computes the perceptual hash of the image read from r, giving
+// up as soon as ctx is done.
+func hashImage(ctx context.Context, r io.Reader) (perceptualhash.Hash, error) {
+	hash, err := new(perceptualhash.DCTHasher).FromReader(contextReader{ctx: ctx, r: r})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return 0, ctxErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return perceptualhash.ParseHash(hash)
+}
+
+// contextReader fails reads once its context is done, so a slow upload stops
+// being decoded when the request is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
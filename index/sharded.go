@@ -0,0 +1,138 @@
+package index
+
+import (
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Sharded is an index split into shards by hash prefix, each with its own
+// lock, for holding tens of millions of entries. Inserts only contend within
+// a shard and queries fan out in parallel to the shards that can hold
+// matches. It is safe for concurrent use.
+type Sharded struct {
+	config  Config
+	bits    int
+	shards  []*Index
+	queries atomic.Uint64
+
+	mu     sync.Mutex
+	owners map[string]int
+}
+
+// NewSharded returns an empty sharded index.
+// It optionally accepts a custom configuration.
+func NewSharded(configs ...Config) *Sharded {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	shardBits := min(max(config.ShardBits, 0), 16)
+
+	shards := make([]*Index, 1<<shardBits)
+	for i := range shards {
+		shards[i] = New(config)
+	}
+	return &Sharded{config: config, bits: shardBits, shards: shards, owners: map[string]int{}}
+}
+
+// Add inserts e, replacing any entry with the same ID.
+func (s *Sharded) Add(e Entry) {
+	shard := s.shardOf(e.Hash)
+	s.shards[shard].Add(e)
+
+	// Record the new owner only after inserting, so that of several
+	// concurrent Adds of one ID the last to get here wins everywhere.
+	s.mu.Lock()
+	previous, ok := s.owners[e.ID]
+	s.owners[e.ID] = shard
+	s.mu.Unlock()
+
+	if ok && previous != shard {
+		s.shards[previous].Remove(e.ID)
+	}
+}
+
+// Remove deletes the entry with the given ID and reports whether it existed.
+func (s *Sharded) Remove(id string) bool {
+	s.mu.Lock()
+	shard, ok := s.owners[id]
+	delete(s.owners, id)
+	s.mu.Unlock()
+
+	return ok && s.shards[shard].Remove(id)
+}
+
+// Len returns the number of entries in the index.
+func (s *Sharded) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.owners)
+}
+
+// Query returns the entries whose hash is within radius bits of h, closest
+// first.
+func (s *Sharded) Query(h perceptualhash.Hash, radius int) []Match {
+	return s.fanOut(h, radius, func(shard *Index) []Match {
+		return shard.Query(h, radius)
+	})
+}
+
+// QueryColor is like Query but additionally requires the color hashes to be
+// within Config.ColorRadius bits.
+func (s *Sharded) QueryColor(h, color perceptualhash.Hash, radius int) []Match {
+	return s.fanOut(h, radius, func(shard *Index) []Match {
+		return shard.QueryColor(h, color, radius)
+	})
+}
+
+// shardOf returns the shard holding hashes with the prefix of h.
+func (s *Sharded) shardOf(h perceptualhash.Hash) int {
+	if s.bits == 0 {
+		return 0
+	}
+	return int(uint64(h) >> (64 - s.bits))
+}
+
+// fanOut runs query in parallel on every shard whose prefix is within radius
+// bits of the prefix of h, as no other shard can hold a match, and merges
+// the results.
+func (s *Sharded) fanOut(h perceptualhash.Hash, radius int, query func(*Index) []Match) []Match {
+	s.queries.Add(1)
+	prefix := s.shardOf(h)
+	var candidates []int
+	for shard := range s.shards {
+		if bits.OnesCount(uint(shard^prefix)) <= radius {
+			candidates = append(candidates, shard)
+		}
+	}
+
+	results := make([][]Match, len(candidates))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(len(candidates), runtime.GOMAXPROCS(0)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = query(s.shards[candidates[i]])
+			}
+		}()
+	}
+	for i := range candidates {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var matches []Match
+	for _, result := range results {
+		matches = append(matches, result...)
+	}
+	sortMatches(matches)
+	return matches
+}
@@ -0,0 +1,91 @@
+package index
+
+// Stats describes the health of an index.
+type Stats struct {
+	// Entries is the number of live entries.
+	Entries int
+	// Tombstones is the number of removed entries still held by the tree.
+	Tombstones int
+	// MemoryBytes approximates the memory held by the index.
+	MemoryBytes int64
+	// Depths holds the number of tree nodes at each depth, root first. A
+	// long tail means the tree is unbalanced and queries visit many nodes.
+	Depths []int
+	// Shards holds the number of entries per shard of a Sharded index.
+	Shards []int
+	// Queries counts the searches run since the index was created.
+	Queries uint64
+	// Matches counts the entries returned by those searches.
+	Matches uint64
+	// Visited counts the tree nodes examined by those searches. Visited
+	// divided by Queries approaching Entries means the index degenerates
+	// into a linear scan, e.g. because the radius is too large.
+	Visited uint64
+}
+
+// entryOverhead approximates the bytes an entry takes besides its ID: the
+// tree node, map slots and, in a Bounded index, its LRU element.
+const entryOverhead = 200
+
+// Stats returns statistics about the index. It walks the whole tree, so it
+// takes time proportional to the number of entries.
+func (ix *Index) Stats() Stats {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	stats := Stats{
+		Entries:    len(ix.nodes),
+		Tombstones: ix.tombstones,
+		Queries:    ix.queries.Load(),
+		Matches:    ix.matches.Load(),
+		Visited:    ix.visited.Load(),
+	}
+	if ix.root == nil {
+		return stats
+	}
+
+	level := []*node{ix.root}
+	for len(level) > 0 {
+		stats.Depths = append(stats.Depths, len(level))
+		var next []*node
+		for _, n := range level {
+			stats.MemoryBytes += entrySize(n.entry)
+			next = append(next, n.children...)
+		}
+		level = next
+	}
+	return stats
+}
+
+// Stats returns statistics about the index, summed over its shards. Queries
+// counts fanned-out queries once, while Matches and Visited cover every
+// shard searched.
+func (s *Sharded) Stats() Stats {
+	stats := Stats{Queries: s.queries.Load()}
+	for _, shard := range s.shards {
+		shardStats := shard.Stats()
+		stats.Entries += shardStats.Entries
+		stats.Tombstones += shardStats.Tombstones
+		stats.MemoryBytes += shardStats.MemoryBytes
+		stats.Matches += shardStats.Matches
+		stats.Visited += shardStats.Visited
+		stats.Shards = append(stats.Shards, shardStats.Entries)
+		for depth, count := range shardStats.Depths {
+			if depth == len(stats.Depths) {
+				stats.Depths = append(stats.Depths, 0)
+			}
+			stats.Depths[depth] += count
+		}
+	}
+	return stats
+}
+
+// Stats returns statistics about the index.
+func (b *Bounded) Stats() Stats {
+	return b.index.Stats()
+}
+
+// entrySize approximates the memory held by e.
+func entrySize(e Entry) int64 {
+	return entryOverhead + int64(len(e.ID))
+}
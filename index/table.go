@@ -0,0 +1,320 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/insomnius/tools/internal/mmap"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// The table format, little-endian throughout:
+//
+//	header   "PHTB", version uint16, bands uint16, count uint64, blob size uint64, reserved uint64
+//	hashes   count uint64 hashes, by entry
+//	ids      count+1 uint64 offsets into the blob, by entry
+//	bands    per band, count uint32 entry numbers sorted by the band's bits
+//	blob     the IDs, concatenated
+const (
+	tableMagic   = "PHTB"
+	tableVersion = 1
+	tableHeader  = 32
+)
+
+var (
+	// ErrInvalidTable is returned for files that are not well-formed
+	// tables.
+	ErrInvalidTable = errors.New("invalid index table")
+	// ErrInvalidConfig is returned for Config.Bands values other than 1, 2,
+	// 4 and 8.
+	ErrInvalidConfig = errors.New("invalid index config")
+)
+
+// WriteTable writes entries to w in a compact read-only format that
+// OpenTable memory-maps, for indexes rebuilt offline and served immutably.
+// The hashes are stored in Config.Bands tables, each sorted by one slice of
+// the hash bits, so queries within fewer bits than there are bands only
+// look up exact slice matches. Of entries sharing an ID, the last is kept;
+// colors and expiry times are not stored.
+// It optionally accepts a custom configuration.
+func WriteTable(w io.Writer, entries []Entry, configs ...Config) error {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Bands != 1 && config.Bands != 2 && config.Bands != 4 && config.Bands != 8 {
+		return fmt.Errorf("%w: Bands must be 1, 2, 4 or 8, not %d", ErrInvalidConfig, config.Bands)
+	}
+
+	byID := map[string]Entry{}
+	for _, e := range entries {
+		byID[e.ID] = e
+	}
+	ids := make([]string, 0, len(byID))
+	blobSize := 0
+	for id := range byID {
+		ids = append(ids, id)
+		blobSize += len(id)
+	}
+	slices.Sort(ids)
+	if uint64(len(ids)) > 1<<32-1 {
+		return fmt.Errorf("%w: too many entries", ErrInvalidTable)
+	}
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, tableHeader)
+	copy(header, tableMagic)
+	binary.LittleEndian.PutUint16(header[4:], tableVersion)
+	binary.LittleEndian.PutUint16(header[6:], uint16(config.Bands))
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(ids)))
+	binary.LittleEndian.PutUint64(header[16:], uint64(blobSize))
+	bw.Write(header)
+
+	var buf [8]byte
+	hashes := make([]perceptualhash.Hash, len(ids))
+	for i, id := range ids {
+		hashes[i] = byID[id].Hash
+		binary.LittleEndian.PutUint64(buf[:], uint64(hashes[i]))
+		bw.Write(buf[:])
+	}
+	offset := uint64(0)
+	for _, id := range ids {
+		binary.LittleEndian.PutUint64(buf[:], offset)
+		bw.Write(buf[:])
+		offset += uint64(len(id))
+	}
+	binary.LittleEndian.PutUint64(buf[:], offset)
+	bw.Write(buf[:])
+
+	order := make([]uint32, len(ids))
+	for band := range config.Bands {
+		for i := range order {
+			order[i] = uint32(i)
+		}
+		slices.SortStableFunc(order, func(a, b uint32) int {
+			ka, kb := bandKey(hashes[a], band, config.Bands), bandKey(hashes[b], band, config.Bands)
+			switch {
+			case ka < kb:
+				return -1
+			case ka > kb:
+				return 1
+			}
+			return 0
+		})
+		for _, i := range order {
+			binary.LittleEndian.PutUint32(buf[:4], i)
+			bw.Write(buf[:4])
+		}
+	}
+	for _, id := range ids {
+		bw.WriteString(id)
+	}
+	return bw.Flush()
+}
+
+// bandKey returns the bits of h in band of bands, which split the 64 bits
+// as evenly as possible.
+func bandKey(h perceptualhash.Hash, band, bands int) uint64 {
+	lo, hi := band*64/bands, (band+1)*64/bands
+	key := uint64(h) >> lo
+	if hi-lo < 64 {
+		key &= 1<<(hi-lo) - 1
+	}
+	return key
+}
+
+// Table is a read-only index in the format written by WriteTable, queried
+// in place with next to no heap allocations. It is safe for concurrent
+// use, except for Close.
+type Table struct {
+	data    []byte
+	release func() error
+	bands   int
+	count   int
+	// Offsets of the sections in data.
+	hashes, ids, order, blob int
+}
+
+// OpenTable memory-maps the table file at path, so large tables load
+// instantly and share the page cache between processes. The file must not
+// be modified while the table is open. Where memory mapping is unavailable
+// the file is read instead.
+//
+// Only the header and the section sizes are checked, which takes constant
+// time. Queries skip entries that a corrupt table points outside of; call
+// Verify to check every entry of a table from an untrusted source.
+func OpenTable(path string) (*Table, error) {
+	data, release, err := mmap.Map(path)
+	if errors.Is(err, mmap.ErrUnsupported) {
+		data, err = os.ReadFile(path)
+		release = func() error { return nil }
+	}
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseTable(data)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t.release = release
+	return t, nil
+}
+
+// parseTable checks the header of data and the sizes of its sections.
+func parseTable(data []byte) (*Table, error) {
+	if len(data) < tableHeader || string(data[:4]) != tableMagic {
+		return nil, ErrInvalidTable
+	}
+	if version := binary.LittleEndian.Uint16(data[4:]); version != tableVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidTable, version)
+	}
+	bands := int(binary.LittleEndian.Uint16(data[6:]))
+	count := binary.LittleEndian.Uint64(data[8:])
+	blobSize := binary.LittleEndian.Uint64(data[16:])
+	if bands != 1 && bands != 2 && bands != 4 && bands != 8 || count > 1<<32-1 {
+		return nil, ErrInvalidTable
+	}
+
+	// The sections are sized in uint64, which cannot overflow for at most
+	// 2^32-1 entries, before any of them is read.
+	sections := tableHeader + 8*count + 8*(count+1) + 4*count*uint64(bands)
+	if sections > uint64(len(data)) || uint64(len(data))-sections != blobSize {
+		return nil, ErrInvalidTable
+	}
+
+	t := &Table{data: data, bands: bands, count: int(count)}
+	t.hashes = tableHeader
+	t.ids = t.hashes + 8*t.count
+	t.order = t.ids + 8*(t.count+1)
+	t.blob = t.order + 4*t.count*bands
+	return t, nil
+}
+
+// Verify checks every entry of the table: that the IDs lie within the blob
+// in order and that the band tables only hold valid entry numbers. It takes
+// time proportional to the number of entries times Config.Bands.
+func (t *Table) Verify() error {
+	if t.idOffset(t.count) != uint64(len(t.data)-t.blob) {
+		return ErrInvalidTable
+	}
+	for i := range t.count {
+		if t.idOffset(i) > t.idOffset(i+1) {
+			return fmt.Errorf("%w: entry %d", ErrInvalidTable, i)
+		}
+	}
+	for band := range t.bands {
+		for j := range t.count {
+			if _, ok := t.entryAt(band, j); !ok {
+				return fmt.Errorf("%w: band %d, position %d", ErrInvalidTable, band, j)
+			}
+		}
+	}
+	return nil
+}
+
+// Len returns the number of entries in the table.
+func (t *Table) Len() int {
+	return t.count
+}
+
+// Query returns the entries whose hash is within radius bits of h, closest
+// first. Radii below the number of bands look up exact band matches, since
+// by the pigeonhole principle every match agrees with h on at least one
+// band; larger radii scan every hash.
+func (t *Table) Query(h perceptualhash.Hash, radius int) []Match {
+	var matches []Match
+	add := func(i, distance int) {
+		if m, ok := t.match(i, distance); ok {
+			matches = append(matches, m)
+		}
+	}
+	if radius >= t.bands {
+		for i := range t.count {
+			if distance := t.hash(i).Distance(h); distance <= radius {
+				add(i, distance)
+			}
+		}
+		sortMatches(matches)
+		return matches
+	}
+
+	for band := range t.bands {
+		key := bandKey(h, band, t.bands)
+		start := sort.Search(t.count, func(j int) bool {
+			i, ok := t.entryAt(band, j)
+			return !ok || bandKey(t.hash(i), band, t.bands) >= key
+		})
+		for j := start; j < t.count; j++ {
+			i, ok := t.entryAt(band, j)
+			if !ok {
+				continue
+			}
+			candidate := t.hash(i)
+			if bandKey(candidate, band, t.bands) != key {
+				break
+			}
+			if t.matchedEarlier(candidate, h, band) {
+				continue
+			}
+			if distance := candidate.Distance(h); distance <= radius {
+				add(i, distance)
+			}
+		}
+	}
+	sortMatches(matches)
+	return matches
+}
+
+// matchedEarlier reports whether candidate agrees with h on a band before
+// band, and was therefore already considered.
+func (t *Table) matchedEarlier(candidate, h perceptualhash.Hash, band int) bool {
+	for earlier := range band {
+		if bandKey(candidate, earlier, t.bands) == bandKey(h, earlier, t.bands) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close unmaps the table. It must not be queried afterwards.
+func (t *Table) Close() error {
+	if t.release == nil {
+		return nil
+	}
+	err := t.release()
+	t.release, t.data = nil, nil
+	return err
+}
+
+func (t *Table) hash(i int) perceptualhash.Hash {
+	return perceptualhash.Hash(binary.LittleEndian.Uint64(t.data[t.hashes+8*i:]))
+}
+
+func (t *Table) idOffset(i int) uint64 {
+	return binary.LittleEndian.Uint64(t.data[t.ids+8*i:])
+}
+
+// entryAt returns the entry number at position j of the table of band, and
+// false if a corrupt table holds an invalid one.
+func (t *Table) entryAt(band, j int) (int, bool) {
+	i := binary.LittleEndian.Uint32(t.data[t.order+4*(band*t.count+j):])
+	return int(i), uint64(i) < uint64(t.count)
+}
+
+// match returns entry i as a match, and false if a corrupt table places
+// its ID outside the blob.
+func (t *Table) match(i, distance int) (Match, bool) {
+	start, end := t.idOffset(i), t.idOffset(i+1)
+	if start > end || end > uint64(len(t.data)-t.blob) {
+		return Match{}, false
+	}
+	id := string(t.data[t.blob+int(start) : t.blob+int(end)])
+	return Match{Entry: Entry{ID: id, Hash: t.hash(i)}, Distance: distance}, true
+}
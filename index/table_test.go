@@ -0,0 +1,51 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// corruptOrder returns a copy of a valid table whose first band table
+// refers to an entry that does not exist.
+func corruptOrder(data []byte) []byte {
+	data = bytes.Clone(data)
+	table, err := parseTable(data)
+	if err != nil {
+		panic(err)
+	}
+	binary.LittleEndian.PutUint32(data[table.order:], 1<<31)
+	return data
+}
+
+func TestTableVerify(t *testing.T) {
+	var buf bytes.Buffer
+	entries := []Entry{
+		{ID: "a", Hash: 0x2d52af2450a2552a},
+		{ID: "b", Hash: 0x2d52af2450a2552b},
+	}
+	if err := WriteTable(&buf, entries, Config{Bands: 4}); err != nil {
+		t.Fatal(err)
+	}
+	table, err := parseTable(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Verify(); err != nil {
+		t.Fatalf("Verify() = %v on a valid table", err)
+	}
+
+	table, err = parseTable(corruptOrder(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parseTable() = %v, want the corruption to be left to Verify", err)
+	}
+	if err := table.Verify(); !errors.Is(err, ErrInvalidTable) {
+		t.Fatalf("Verify() = %v, want ErrInvalidTable", err)
+	}
+	// The corrupt position is skipped; the entry it hid may be lost, but
+	// the rest of the table still answers.
+	if matches := table.Query(0x2d52af2450a2552b, 0); len(matches) != 1 || matches[0].ID != "b" {
+		t.Errorf("Query() = %v, want entry b", matches)
+	}
+}
@@ -0,0 +1,102 @@
+// Package fetch downloads images over HTTP for the packages that watch or
+// crawl published copies, with a timeout and a size limit.
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrTooLarge is returned for bodies larger than Request.MaxBytes.
+	ErrTooLarge = errors.New("image exceeds the size limit")
+	// ErrStatus is wrapped by StatusError.
+	ErrStatus = errors.New("unexpected HTTP status")
+)
+
+// StatusError is returned for responses other than 200 OK.
+type StatusError struct {
+	Code   int
+	Status string
+	// RetryAfter is the wait the server asked for in a Retry-After header
+	// given in seconds, or zero.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrStatus, e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrStatus
+}
+
+// Request describes a GET request.
+type Request struct {
+	// Client sends the request. Nil means http.DefaultClient.
+	Client    *http.Client
+	URL       string
+	UserAgent string
+	// Timeout bounds the request, including reading the body. Zero means no
+	// limit.
+	Timeout time.Duration
+	// MaxBytes is the largest body read. Zero means no limit.
+	MaxBytes int64
+}
+
+// Get makes the request and returns the body of a 200 OK response.
+func Get(ctx context.Context, r Request) ([]byte, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.UserAgent != "" {
+		req.Header.Set("User-Agent", r.UserAgent)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := &StatusError{Code: resp.StatusCode, Status: resp.Status}
+		if seconds, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && seconds > 0 {
+			err.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, err
+	}
+
+	limit := r.MaxBytes
+	if limit <= 0 {
+		limit = math.MaxInt64 - 1
+	}
+	if resp.ContentLength > limit {
+		return nil, ErrTooLarge
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(resp.Body, limit+1)); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) > limit {
+		return nil, ErrTooLarge
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,9 @@
+// Package mmap maps files into memory read-only, for the packages that read
+// large files in place.
+package mmap
+
+import "errors"
+
+// ErrUnsupported is returned by Map on platforms and for files it cannot
+// map, which callers then read instead.
+var ErrUnsupported = errors.New("memory mapping is not supported")
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package mmap
+
+// Map reports that memory mapping is unavailable.
+func Map(string) ([]byte, func() error, error) {
+	return nil, nil, ErrUnsupported
+}
@@ -0,0 +1,189 @@
+// Package tiff reads the image file directories of TIFF structured data,
+// such as EXIF payloads and RAW camera files, checking every offset against
+// the data so corrupt files cannot read out of bounds.
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Field types.
+const (
+	Byte      = 1
+	ASCII     = 2
+	Short     = 3
+	Long      = 4
+	Rational  = 5
+	SByte     = 6
+	Undefined = 7
+	SShort    = 8
+	SLong     = 9
+	SRational = 10
+	Float     = 11
+	Double    = 12
+	IFD       = 13
+)
+
+// typeSizes holds the size in bytes of the values of each field type.
+var typeSizes = map[uint16]uint64{
+	Byte:      1,
+	ASCII:     1,
+	Short:     2,
+	Long:      4,
+	Rational:  8,
+	SByte:     1,
+	Undefined: 1,
+	SShort:    2,
+	SLong:     4,
+	SRational: 8,
+	Float:     4,
+	Double:    8,
+	IFD:       4,
+}
+
+// ErrInvalid is returned for data without a TIFF header and for
+// directories that lie outside the data.
+var ErrInvalid = errors.New("invalid TIFF structure")
+
+// File is TIFF structured data.
+type File struct {
+	Data  []byte
+	Order binary.ByteOrder
+	// First is the offset of the first image file directory.
+	First uint32
+}
+
+// Field is an entry of an image file directory.
+type Field struct {
+	Type  uint16
+	Count uint32
+	// Value holds the bytes of the values.
+	Value []byte
+}
+
+// Parse reads the header of TIFF structured data.
+func Parse(data []byte) (*File, error) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte("MM\x00*")):
+		order = binary.BigEndian
+	default:
+		return nil, ErrInvalid
+	}
+	if len(data) < 8 {
+		return nil, ErrInvalid
+	}
+	return &File{Data: data, Order: order, First: order.Uint32(data[4:])}, nil
+}
+
+// Directory returns the fields of the image file directory at offset, by
+// tag. Fields of unknown types, or whose values lie outside the data, are
+// left out.
+func (f *File) Directory(offset uint32) (map[uint16]Field, error) {
+	n, ok := f.entries(offset)
+	if !ok {
+		return nil, ErrInvalid
+	}
+
+	fields := make(map[uint16]Field, n)
+	for i := range n {
+		entry := f.Data[uint64(offset)+2+12*i:][:12]
+		typ := f.Order.Uint16(entry[2:])
+		count := f.Order.Uint32(entry[4:])
+		size, ok := typeSizes[typ]
+		if !ok {
+			continue
+		}
+
+		length := size * uint64(count)
+		value := entry[8:12]
+		if length > 4 {
+			start := uint64(f.Order.Uint32(value))
+			if start+length > uint64(len(f.Data)) {
+				continue
+			}
+			value = f.Data[start:]
+		}
+		fields[f.Order.Uint16(entry)] = Field{Type: typ, Count: count, Value: value[:length]}
+	}
+	return fields, nil
+}
+
+// Directories returns the offsets of the chain of image file directories
+// starting at First, one per page, stopping at the first one outside the
+// data, at a cycle or after limit directories.
+func (f *File) Directories(limit int) []uint32 {
+	var directories []uint32
+	seen := map[uint32]bool{}
+	offset := f.First
+	for offset != 0 && !seen[offset] && len(directories) < limit {
+		n, ok := f.entries(offset)
+		if !ok {
+			break
+		}
+		end := uint64(offset) + 2 + 12*n + 4
+		if end > uint64(len(f.Data)) {
+			break
+		}
+		seen[offset] = true
+		directories = append(directories, offset)
+		offset = f.Order.Uint32(f.Data[end-4:])
+	}
+	return directories
+}
+
+// entries returns the number of entries of the directory at offset, and
+// false if they do not all lie within the data.
+func (f *File) entries(offset uint32) (uint64, bool) {
+	if uint64(offset)+2 > uint64(len(f.Data)) {
+		return 0, false
+	}
+	n := uint64(f.Order.Uint16(f.Data[offset:]))
+	return n, uint64(offset)+2+12*n <= uint64(len(f.Data))
+}
+
+// Uint returns value i of an unsigned integer field.
+func (f *File) Uint(field Field, i int) (uint32, bool) {
+	if i < 0 || uint64(i) >= uint64(field.Count) {
+		return 0, false
+	}
+	switch field.Type {
+	case Byte, Undefined:
+		return uint32(field.Value[i]), true
+	case Short:
+		return uint32(f.Order.Uint16(field.Value[i*2:])), true
+	case Long, SLong, IFD:
+		return f.Order.Uint32(field.Value[i*4:]), true
+	}
+	return 0, false
+}
+
+// Rational returns value i of a rational field as a float.
+func (f *File) Rational(field Field, i int) (float64, bool) {
+	if i < 0 || uint64(i) >= uint64(field.Count) || field.Type != Rational && field.Type != SRational {
+		return 0, false
+	}
+
+	num, den := f.Order.Uint32(field.Value[i*8:]), f.Order.Uint32(field.Value[i*8+4:])
+	if den == 0 {
+		return 0, false
+	}
+	if field.Type == SRational {
+		return float64(int32(num)) / float64(int32(den)), true
+	}
+	return float64(num) / float64(den), true
+}
+
+// String returns the value of an ASCII field without trailing NULs and
+// spaces.
+func String(field Field) string {
+	value := field.Value
+	for len(value) > 0 && (value[len(value)-1] == 0 || value[len(value)-1] == ' ') {
+		value = value[:len(value)-1]
+	}
+	return string(value)
+}
@@ -0,0 +1,37 @@
+package manifest_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/insomnius/tools/manifest"
+)
+
+func FuzzRead(f *testing.F) {
+	digest := strings.Repeat("ab", 32)
+	f.Add(digest + "  2d52af2450a2552a  1234  photos/a.jpg\n")
+	f.Add(digest + "  -  0  notes.txt\n" + digest + "  0  12  b  c.png\n")
+	f.Add("short  -  1  x\n")
+	f.Add(digest + "  -  nan  x\n")
+	f.Fuzz(func(t *testing.T, data string) {
+		entries, err := manifest.Read(strings.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		// Read entries survive a round trip through Write.
+		var buf bytes.Buffer
+		if err := manifest.Write(&buf, entries); err != nil {
+			return
+		}
+		again, err := manifest.Read(&buf)
+		if err != nil {
+			t.Fatalf("reading written manifest: %v", err)
+		}
+		if len(entries) > 0 && !reflect.DeepEqual(again, entries) {
+			t.Errorf("round trip changed entries:\n%v\n%v", entries, again)
+		}
+	})
+}
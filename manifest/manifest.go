@@ -0,0 +1,155 @@
+// Package manifest generates and verifies manifests of image directories,
+// listing the SHA-256 digest and the perceptual hash of every file, both
+// computed in a single traversal. The digests detect corruption and exact
+// copies, the perceptual hashes similar images.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+var (
+	// ErrInvalidLine is returned by Read for lines not written by Write.
+	ErrInvalidLine = errors.New("invalid manifest line")
+	// ErrChecksumMismatch is reported by Verify for files whose contents
+	// changed since the manifest was generated.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// Entry describes a file of a manifest.
+type Entry struct {
+	// Path is relative to the root of the manifest, slash-separated.
+	Path string
+	Size int64
+	// SHA256 is the hex encoded SHA-256 digest of the file.
+	SHA256 string
+	// Hash is the perceptual hash of the file, or empty if it is not an
+	// image that can be hashed.
+	Hash string
+	// Err is set by Generate for files that could not be read or hashed. It
+	// is not written to manifests.
+	Err error
+}
+
+// Problem is a file that failed verification.
+type Problem struct {
+	Path string
+	Err  error
+}
+
+// Generate walks root and returns an entry for every file selected by the
+// configuration, sorted by path. Files that could be read but not hashed
+// still get their digest; errors are recorded in Entry.Err. The returned
+// error is set only if the walk itself failed.
+// The perceptual hashes and the file selection are configured by opts, as
+// for perceptualhash.New.
+func Generate(ctx context.Context, root string, opts ...perceptualhash.Option) ([]Entry, error) {
+	h, err := perceptualhash.New(append(slices.Clip(opts), perceptualhash.WithChecksum())...)
+	if err != nil {
+		return nil, err
+	}
+
+	results, errc := h.HashDirStream(ctx, root)
+	var entries []Entry
+	for result := range results {
+		rel, err := filepath.Rel(root, result.Path)
+		if err != nil {
+			rel = result.Path
+		}
+		entries = append(entries, Entry{
+			Path:   filepath.ToSlash(rel),
+			Size:   result.Image.Size,
+			SHA256: result.SHA256,
+			Hash:   result.Hash,
+			Err:    result.Err,
+		})
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.Path, b.Path) })
+	return entries, nil
+}
+
+// Write writes entries as a manifest, one line per file holding its digest,
+// perceptual hash, size and path, separated by two spaces, with "-" for a
+// missing perceptual hash. Entries without a digest are skipped.
+func Write(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		if e.SHA256 == "" {
+			continue
+		}
+		if strings.ContainsAny(e.Path, "\r\n") {
+			return fmt.Errorf("%w: path %q contains a line break", ErrInvalidLine, e.Path)
+		}
+		hash := e.Hash
+		if hash == "" {
+			hash = "-"
+		}
+		fmt.Fprintf(bw, "%s  %s  %d  %s\n", e.SHA256, hash, e.Size, e.Path)
+	}
+	return bw.Flush()
+}
+
+// Read reads a manifest written by Write.
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.SplitN(scanner.Text(), "  ", 4)
+		if len(fields) != 4 || len(fields[0]) != 2*sha256.Size || fields[3] == "" {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidLine, line)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidLine, line, err)
+		}
+
+		e := Entry{Path: fields[3], Size: size, SHA256: fields[0], Hash: fields[1]}
+		if e.Hash == "-" {
+			e.Hash = ""
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Verify checks the files of entries under root against their size and
+// digest, stopping early if ctx is done. It returns the files that are
+// missing, unreadable or changed, the latter with ErrChecksumMismatch.
+func Verify(ctx context.Context, root string, entries []Entry) ([]Problem, error) {
+	var problems []Problem
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return problems, err
+		}
+
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(e.Path)))
+		if err != nil {
+			problems = append(problems, Problem{Path: e.Path, Err: err})
+			continue
+		}
+		sum := sha256.Sum256(data)
+		want, err := hex.DecodeString(e.SHA256)
+		if err != nil || int64(len(data)) != e.Size || !bytes.Equal(sum[:], want) {
+			problems = append(problems, Problem{Path: e.Path, Err: ErrChecksumMismatch})
+		}
+	}
+	return problems, nil
+}
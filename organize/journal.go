@@ -0,0 +1,119 @@
+package organize
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Journal records the operations performed on a set of duplicates, so they
+// can be reviewed and reverted with Undo.
+type Journal struct {
+	Created time.Time
+	Moves   []Move
+	Links   []Link
+}
+
+var ErrNoBackup = errors.New("replaced file was not backed up")
+
+// WriteJournal writes j to path as JSON, failing if path already exists so
+// an earlier journal is never lost. Relative paths are made absolute, so the
+// journal can be undone from any working directory.
+func WriteJournal(path string, j Journal) error {
+	j.Moves = slices.Clone(j.Moves)
+	for i, move := range j.Moves {
+		j.Moves[i].From, j.Moves[i].To = absPath(move.From), absPath(move.To)
+	}
+	j.Links = slices.Clone(j.Links)
+	for i, link := range j.Links {
+		j.Links[i].Path, j.Links[i].Target = absPath(link.Path), absPath(link.Target)
+		if link.Backup != "" {
+			j.Links[i].Backup = absPath(link.Backup)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(j)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// absPath returns the absolute form of path, or path itself if the working
+// directory is unknown.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// ReadJournal reads a journal written by WriteJournal.
+func ReadJournal(path string) (Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Journal{}, err
+	}
+
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return Journal{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return j, nil
+}
+
+// Undo reverts the operations recorded in j, most recent first: moved files
+// are moved back, and links are replaced by their backups again. Existing
+// files are never replaced, and links are only removed if they still point
+// to their target. Links without a backup cannot be reverted and are
+// reported with ErrNoBackup. Undo continues past failures and returns them
+// all joined.
+func Undo(j Journal) error {
+	var errs []error
+	for _, link := range slices.Backward(j.Links) {
+		if err := undoLink(link); err != nil {
+			errs = append(errs, fmt.Errorf("restoring %s: %w", link.Path, err))
+		}
+	}
+	for _, move := range slices.Backward(j.Moves) {
+		if err := moveFile(move.To, move.From); err != nil {
+			errs = append(errs, fmt.Errorf("restoring %s: %w", move.From, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// undoLink replaces link.Path with its backup.
+func undoLink(link Link) error {
+	if link.Backup == "" {
+		return ErrNoBackup
+	}
+
+	info, err := os.Stat(link.Path)
+	if err != nil {
+		return err
+	}
+	target, err := os.Stat(link.Target)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, target) {
+		return fmt.Errorf("%s is no longer a link to %s", link.Path, link.Target)
+	}
+
+	if err := os.Remove(link.Path); err != nil {
+		return err
+	}
+	return moveFile(link.Backup, link.Path)
+}
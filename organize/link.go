@@ -0,0 +1,124 @@
+package organize
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// LinkMode selects how duplicates are replaced by links to the kept copy.
+type LinkMode int
+
+const (
+	// Hardlink replaces duplicates with hard links, which only works within
+	// one filesystem.
+	Hardlink LinkMode = iota
+	// Symlink replaces duplicates with relative symbolic links.
+	Symlink
+	// HardlinkOrSymlink uses a hard link where possible and falls back to a
+	// symbolic link across filesystems.
+	HardlinkOrSymlink
+)
+
+// Link is a duplicate that was replaced by a link to the kept copy.
+type Link struct {
+	Path     string
+	Target   string
+	Symbolic bool
+	// Backup is where the replaced file was moved, empty if it was deleted.
+	Backup string
+}
+
+// ReplaceWithLinks replaces every removed file with a link to the kept copy
+// of its cluster, reclaiming space while leaving directory structures
+// intact. Each replacement is atomic: the link is created under a temporary
+// name and renamed over the duplicate. With Config.BackupDir, the duplicate
+// is moved there first; without it, the duplicate is deleted and the
+// replacement cannot be undone. It stops at the first failure, returning the links
+// completed so far.
+// It optionally accepts a custom configuration; only Root, BackupDir and
+// DryRun apply.
+func ReplaceWithLinks(decisions []Decision, mode LinkMode, configs ...Config) ([]Link, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	var links []Link
+	for _, decision := range decisions {
+		for _, path := range decision.Remove {
+			var backup string
+			if config.BackupDir != "" {
+				var err error
+				if backup, err = relocate(path, config.BackupDir, config); err != nil {
+					return links, err
+				}
+			}
+			if config.DryRun {
+				links = append(links, Link{Path: path, Target: decision.Keep, Symbolic: mode == Symlink, Backup: backup})
+				continue
+			}
+
+			link, err := replaceWithLink(path, decision.Keep, mode, backup)
+			if err != nil {
+				return links, err
+			}
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// replaceWithLink replaces path with a link to target, first moving path to
+// backup if it is not empty.
+func replaceWithLink(path, target string, mode LinkMode, backup string) (Link, error) {
+	temp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.link-%d", filepath.Base(path), os.Getpid()))
+
+	symbolic := mode == Symlink
+	if !symbolic {
+		err := os.Link(target, temp)
+		if err != nil && mode == HardlinkOrSymlink && errors.Is(err, syscall.EXDEV) {
+			symbolic = true
+		} else if err != nil {
+			return Link{}, err
+		}
+	}
+	if symbolic {
+		if err := os.Symlink(symlinkTarget(path, target), temp); err != nil {
+			return Link{}, err
+		}
+	}
+
+	if backup != "" {
+		if err := moveFile(path, backup); err != nil {
+			os.Remove(temp)
+			return Link{}, err
+		}
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		if backup != "" {
+			moveFile(backup, path)
+		}
+		return Link{}, err
+	}
+	return Link{Path: path, Target: target, Symbolic: symbolic, Backup: backup}, nil
+}
+
+// symlinkTarget returns target relative to the directory of path, so links
+// keep working when the whole tree is moved.
+func symlinkTarget(path, target string) string {
+	absPath, err1 := filepath.Abs(path)
+	absTarget, err2 := filepath.Abs(target)
+	if err1 != nil || err2 != nil {
+		return target
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(absPath), absTarget)
+	if err != nil {
+		return absTarget
+	}
+	return rel
+}
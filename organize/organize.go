@@ -0,0 +1,237 @@
+// Package organize acts on duplicate clusters: it picks the copy to keep in
+// each cluster and moves the others out of the way.
+package organize
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Candidate describes one file of a duplicate cluster.
+type Candidate struct {
+	Path   string
+	Width  int
+	Height int
+	Size   int64
+}
+
+// Policy returns the index of the candidate to keep.
+type Policy func(candidates []Candidate) int
+
+// LargestResolution keeps the copy with the most pixels, breaking ties by
+// file size and then by path order.
+func LargestResolution(candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates[1:] {
+		b := candidates[best]
+		pixels, bestPixels := c.Width*c.Height, b.Width*b.Height
+		if pixels > bestPixels || (pixels == bestPixels && c.Size > b.Size) {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// LargestFile keeps the largest file, breaking ties by path order.
+func LargestFile(candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates[1:] {
+		if c.Size > candidates[best].Size {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// Config holds options for organizing duplicates.
+type Config struct {
+	// Root is the directory the clustered paths live under. Relative paths
+	// below Root are preserved inside QuarantineDir.
+	Root string
+	// QuarantineDir receives the files that are not kept.
+	QuarantineDir string
+	// Policy picks the copy to keep in each cluster.
+	Policy Policy
+	// BackupDir, if set, receives the files replaced by ReplaceWithLinks,
+	// at their path relative to Root, instead of deleting them, so Undo can
+	// restore them.
+	BackupDir string
+	// DryRun makes Quarantine and ReplaceWithLinks return the operations
+	// they would perform without touching any file.
+	DryRun bool
+}
+
+var defaultConfig = Config{
+	Root:          ".",
+	QuarantineDir: "quarantine",
+	Policy:        LargestResolution,
+}
+
+// Decision records which copy of a cluster is kept.
+type Decision struct {
+	Keep   string
+	Remove []string
+}
+
+// Move is a file relocation performed by Quarantine.
+type Move struct {
+	From string
+	To   string
+}
+
+var ErrOutsideRoot = errors.New("path is outside the root directory")
+
+// Decide applies the policy to every cluster of paths.
+// It optionally accepts a custom configuration.
+func Decide(clusters [][]string, configs ...Config) ([]Decision, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Policy == nil {
+		config.Policy = LargestResolution
+	}
+
+	decisions := make([]Decision, 0, len(clusters))
+	for _, cluster := range clusters {
+		if len(cluster) < 2 {
+			continue
+		}
+
+		candidates := make([]Candidate, len(cluster))
+		for i, path := range cluster {
+			candidate, err := describe(path)
+			if err != nil {
+				return nil, err
+			}
+			candidates[i] = candidate
+		}
+
+		keep := config.Policy(candidates)
+		decision := Decision{Keep: cluster[keep]}
+		for i, path := range cluster {
+			if i != keep {
+				decision.Remove = append(decision.Remove, path)
+			}
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
+
+// describe stats path and reads its image dimensions without decoding the
+// pixels. Files that are not decodable images get zero dimensions.
+func describe(path string) (Candidate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Candidate{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Candidate{}, err
+	}
+
+	candidate := Candidate{Path: path, Size: info.Size()}
+	if imageConfig, _, err := image.DecodeConfig(f); err == nil {
+		candidate.Width, candidate.Height = imageConfig.Width, imageConfig.Height
+	}
+	return candidate, nil
+}
+
+// Quarantine moves every removed file into the quarantine directory,
+// preserving its path relative to the root, and returns the moves made,
+// which can be recorded in a Journal.
+// It stops at the first failure, returning the moves completed so far.
+// It optionally accepts a custom configuration.
+func Quarantine(decisions []Decision, configs ...Config) ([]Move, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	var moves []Move
+	for _, decision := range decisions {
+		for _, path := range decision.Remove {
+			target, err := relocate(path, config.QuarantineDir, config)
+			if err != nil {
+				return moves, err
+			}
+			if config.DryRun {
+				moves = append(moves, Move{From: path, To: target})
+				continue
+			}
+			if err := moveFile(path, target); err != nil {
+				return moves, err
+			}
+			moves = append(moves, Move{From: path, To: target})
+		}
+	}
+	return moves, nil
+}
+
+// relocate maps path below the root to the same relative location in dir.
+func relocate(path, dir string, config Config) (string, error) {
+	rel, err := filepath.Rel(config.Root, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, path)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+// moveFile renames from to to, creating parent directories and falling back
+// to copy and delete across filesystems. Existing files are never replaced.
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%s: %w", to, os.ErrExist)
+	}
+
+	err := os.Rename(from, to)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyFile(from, to); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	return dst.Close()
+}
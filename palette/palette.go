@@ -0,0 +1,196 @@
+// Package palette extracts the dominant colors of an image, for display in
+// reports and as a cheap filter before comparing images in full.
+package palette
+
+import (
+	"cmp"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// sampleSize is the side of the grid images are reduced to before
+// extracting colors.
+const sampleSize = 64
+
+// oversplit is the number of median cut boxes per requested color.
+const oversplit = 4
+
+var ErrEmptyImage = errors.New("image has no opaque pixels")
+
+// Color is a dominant color and the share of the image it covers.
+type Color struct {
+	color.RGBA
+	// Proportion is the fraction of opaque pixels closest to this color.
+	Proportion float64
+}
+
+// Extract returns up to n dominant colors of img, most common first, found
+// by median cut. Mostly transparent pixels are ignored.
+func Extract(img image.Image, n int) ([]Color, error) {
+	if img.Bounds().Empty() {
+		return nil, ErrEmptyImage
+	}
+	small := imgresize.Resize(img, sampleSize, sampleSize, imgresize.Config{Filter: imgresize.ApproxBiLinear})
+
+	var pixels [][3]uint8
+	for i := 0; i < len(small.Pix); i += 4 {
+		if small.Pix[i+3] < 0x80 {
+			continue
+		}
+		// Undo the alpha premultiplication of image.RGBA.
+		a := uint32(small.Pix[i+3])
+		pixels = append(pixels, [3]uint8{
+			uint8(uint32(small.Pix[i]) * 0xff / a),
+			uint8(uint32(small.Pix[i+1]) * 0xff / a),
+			uint8(uint32(small.Pix[i+2]) * 0xff / a),
+		})
+	}
+	if len(pixels) == 0 {
+		return nil, ErrEmptyImage
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	// Median cut: repeatedly split the box with the widest channel range at
+	// its median along that channel. Noise makes large uniform areas split
+	// into near-identical colors, so cut into more boxes than needed and
+	// then merge the closest colors until n remain.
+	boxes := [][][3]uint8{pixels}
+	for len(boxes) < n*oversplit {
+		widest, channel, widestRange := -1, 0, 0
+		for i, box := range boxes {
+			c, r := widestChannel(box)
+			if len(box) > 1 && r > widestRange {
+				widest, channel, widestRange = i, c, r
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		box := boxes[widest]
+		slices.SortFunc(box, func(a, b [3]uint8) int {
+			return cmp.Compare(a[channel], b[channel])
+		})
+		boxes[widest] = box[:len(box)/2]
+		boxes = append(boxes, box[len(box)/2:])
+	}
+
+	clusters := make([]cluster, len(boxes))
+	for i, box := range boxes {
+		for _, p := range box {
+			for c := range 3 {
+				clusters[i].sum[c] += float64(p[c])
+			}
+		}
+		clusters[i].count = len(box)
+	}
+	for len(clusters) > n {
+		a, b := closestPair(clusters)
+		for c := range 3 {
+			clusters[a].sum[c] += clusters[b].sum[c]
+		}
+		clusters[a].count += clusters[b].count
+		clusters = slices.Delete(clusters, b, b+1)
+	}
+
+	colors := make([]Color, len(clusters))
+	for i, cl := range clusters {
+		colors[i] = Color{RGBA: cl.color(), Proportion: float64(cl.count) / float64(len(pixels))}
+	}
+	slices.SortStableFunc(colors, func(a, b Color) int {
+		return cmp.Compare(b.Proportion, a.Proportion)
+	})
+	return colors, nil
+}
+
+// cluster is a set of pixels merged into one palette color.
+type cluster struct {
+	sum   [3]float64
+	count int
+}
+
+// color returns the mean color of cl.
+func (cl cluster) color() color.RGBA {
+	n := float64(cl.count)
+	return color.RGBA{
+		R: uint8(cl.sum[0]/n + 0.5),
+		G: uint8(cl.sum[1]/n + 0.5),
+		B: uint8(cl.sum[2]/n + 0.5),
+		A: 0xff,
+	}
+}
+
+// closestPair returns the indexes, in increasing order, of the two clusters
+// with the closest mean colors.
+func closestPair(clusters []cluster) (int, int) {
+	bestA, bestB, best := 0, 1, math.Inf(1)
+	for i := range clusters {
+		for j := i + 1; j < len(clusters); j++ {
+			if d := rgbDistance(clusters[i].color(), clusters[j].color()); d < best {
+				bestA, bestB, best = i, j, d
+			}
+		}
+	}
+	return bestA, bestB
+}
+
+// widestChannel returns the channel with the largest range of values in
+// pixels, and that range.
+func widestChannel(pixels [][3]uint8) (int, int) {
+	lo := [3]uint8{255, 255, 255}
+	var hi [3]uint8
+	for _, p := range pixels {
+		for c := range 3 {
+			lo[c] = min(lo[c], p[c])
+			hi[c] = max(hi[c], p[c])
+		}
+	}
+	channel := 0
+	for c := 1; c < 3; c++ {
+		if hi[c]-lo[c] > hi[channel]-lo[channel] {
+			channel = c
+		}
+	}
+	return channel, int(hi[channel] - lo[channel])
+}
+
+// Distance compares two palettes, returning the average distance in RGB
+// space from each color of one palette to the closest color of the other,
+// weighted by proportion and taken in both directions. It ranges from 0 for
+// identical palettes to about 441 for black against white, and is cheap
+// enough to discard obviously different images before comparing hashes.
+func Distance(a, b []Color) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	return (directed(a, b) + directed(b, a)) / 2
+}
+
+// directed returns the proportion-weighted average distance from each color
+// of a to its closest color in b.
+func directed(a, b []Color) float64 {
+	var total, weight float64
+	for _, ca := range a {
+		closest := math.Inf(1)
+		for _, cb := range b {
+			closest = min(closest, rgbDistance(ca.RGBA, cb.RGBA))
+		}
+		total += ca.Proportion * closest
+		weight += ca.Proportion
+	}
+	return total / weight
+}
+
+func rgbDistance(a, b color.RGBA) float64 {
+	dr := float64(a.R) - float64(b.R)
+	dg := float64(a.G) - float64(b.G)
+	db := float64(a.B) - float64(b.B)
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
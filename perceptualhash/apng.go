@@ -0,0 +1,312 @@
+package perceptualhash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"time"
+)
+
+// Frame is the hash of one frame of an animated image, or of one page of a
+// multi-page document.
+type Frame struct {
+	// Index is the position of the frame or page, from 0.
+	Index int
+	Hash  string
+	Err   error
+	// Delay is how long an animation frame is displayed.
+	Delay time.Duration
+}
+
+// ErrInvalidAPNG is returned for animated PNG files whose animation chunks
+// are malformed.
+var ErrInvalidAPNG = errors.New("invalid animated PNG")
+
+// maxAPNGPixels bounds the canvas animated PNG frames are composited on, so
+// forged dimensions cannot exhaust memory. It allows 64 megapixels, 256 MiB
+// in RGBA.
+const maxAPNGPixels = 1 << 26
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// APNG frame disposal and blending operations, from the fcTL chunk.
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendSource       = 0
+)
+
+// apngFrame is a frame of an animated PNG: its fcTL control chunk and the
+// compressed image data of its IDAT or fdAT chunks.
+type apngFrame struct {
+	width, height int
+	x, y          int
+	delay         time.Duration
+	dispose       byte
+	blendSource   bool
+	data          [][]byte
+}
+
+// FramesFromPath hashes every frame of the animated PNG or every page of
+// the TIFF file at filePath.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FramesFromPath.
+func FramesFromPath(filePath string, configs ...Config) ([]Frame, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return nil, err
+	}
+	return h.FramesFromPath(filePath)
+}
+
+// FramesFromReader is like FramesFromPath but reads the image from r.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FramesFromReader.
+func FramesFromReader(r io.Reader, configs ...Config) ([]Frame, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return nil, err
+	}
+	return h.FramesFromReader(r)
+}
+
+// FramesFromPath hashes every frame of the animated PNG at filePath, each
+// as displayed, composited over the frames before it. The hash computed by
+// FromPath is that of the default image, which viewers without animation
+// support show and which is usually the first frame. For multi-page TIFF
+// files, such as scanned documents, it hashes every page, with per-page
+// errors in Frame.Err. Still images yield a single frame with the hash of
+// FromPath. Debug artifacts are not written.
+func (h *DCTHasher) FramesFromPath(filePath string) ([]Frame, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return h.FramesFromReader(f)
+}
+
+// FramesFromReader is like FramesFromPath but reads the image from r.
+func (h *DCTHasher) FramesFromReader(r io.Reader) ([]Frame, error) {
+	config := h.config
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if frameCount(data) > 1 && !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return tiffPageFrames(data, h), nil
+	}
+	if frameCount(data) <= 1 {
+		hash, err := h.FromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Frame{{Hash: hash}}, nil
+	}
+
+	header, shared, frames, err := parseAPNG(data)
+	if err != nil {
+		return nil, err
+	}
+	width := int(int32(binary.BigEndian.Uint32(header[0:4])))
+	height := int(int32(binary.BigEndian.Uint32(header[4:8])))
+	// As in image/png, sizes beyond 31 bits are negative here, so the pixel
+	// count cannot overflow before it is compared with the limit.
+	if width < 0 || height < 0 || int64(width)*int64(height) > maxAPNGPixels {
+		return nil, fmt.Errorf("%w: %dx%d canvas is too large", ErrInvalidAPNG, uint32(width), uint32(height))
+	}
+	if width < workingSize || height < workingSize {
+		return nil, ErrImageTooSmall
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	var previous *image.RGBA
+	hashes := make([]Frame, len(frames))
+	for i, frame := range frames {
+		hashes[i] = Frame{Index: i, Delay: frame.delay}
+
+		region := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		if !region.In(canvas.Rect) {
+			return nil, fmt.Errorf("%w: frame %d exceeds the image", ErrInvalidAPNG, i)
+		}
+		img, err := decodeAPNGFrame(header, shared, frame)
+		if err != nil {
+			hashes[i].Err = err
+			continue
+		}
+		if frame.dispose == apngDisposePrevious {
+			previous = image.NewRGBA(canvas.Rect)
+			copy(previous.Pix, canvas.Pix)
+		}
+		op := draw.Over
+		if frame.blendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, region, img, img.Bounds().Min, op)
+
+		hash, _, err := hashGray(preprocessImage(canvas, config), config)
+		if err != nil {
+			hashes[i].Err = err
+		} else {
+			hashes[i].Hash = fmt.Sprintf("%016x", hash)
+		}
+
+		switch frame.dispose {
+		case apngDisposeBackground:
+			draw.Draw(canvas, region, image.Transparent, image.Point{}, draw.Src)
+		case apngDisposePrevious:
+			if i == 0 {
+				draw.Draw(canvas, region, image.Transparent, image.Point{}, draw.Src)
+			} else {
+				canvas = previous
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// frameCount returns the number of animation frames declared by the acTL
+// chunk of a PNG file or the number of pages of a TIFF file, 1 for still
+// PNG files and 0 for other data.
+func frameCount(data []byte) int {
+	if directories, _ := tiffDirectories(data); directories != nil {
+		if rawFormat(data) != "" {
+			return 1
+		}
+		return len(directories)
+	}
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return 0
+	}
+	count := 1
+	eachChunk(data, func(kind string, body []byte) bool {
+		switch kind {
+		case "acTL":
+			if len(body) >= 4 {
+				count = int(binary.BigEndian.Uint32(body))
+			}
+			return false
+		case "IDAT":
+			// acTL must precede the image data.
+			return false
+		}
+		return true
+	})
+	return count
+}
+
+// eachChunk calls fn with the type and body of every chunk of a PNG file,
+// until fn returns false or the data ends.
+func eachChunk(data []byte, fn func(kind string, body []byte) bool) {
+	data = data[len(pngSignature):]
+	for len(data) >= 12 {
+		length := binary.BigEndian.Uint32(data)
+		if uint64(length)+12 > uint64(len(data)) {
+			return
+		}
+		if !fn(string(data[4:8]), data[8:8+length]) {
+			return
+		}
+		data = data[12+length:]
+	}
+}
+
+// parseAPNG splits an animated PNG into the IHDR body, the chunks every
+// frame needs for decoding, such as the palette, and the frames.
+func parseAPNG(data []byte) (header []byte, shared [][]byte, frames []apngFrame, err error) {
+	var current *apngFrame
+	eachChunk(data, func(kind string, body []byte) bool {
+		switch kind {
+		case "IHDR":
+			header = body
+		case "PLTE", "tRNS", "iCCP":
+			shared = append(shared, chunk(kind, body))
+		case "fcTL":
+			if len(body) < 26 {
+				err = fmt.Errorf("%w: short fcTL chunk", ErrInvalidAPNG)
+				return false
+			}
+			numerator := time.Duration(binary.BigEndian.Uint16(body[20:22]))
+			denominator := time.Duration(binary.BigEndian.Uint16(body[22:24]))
+			if denominator == 0 {
+				denominator = 100
+			}
+			frames = append(frames, apngFrame{
+				width:       int(binary.BigEndian.Uint32(body[4:8])),
+				height:      int(binary.BigEndian.Uint32(body[8:12])),
+				x:           int(binary.BigEndian.Uint32(body[12:16])),
+				y:           int(binary.BigEndian.Uint32(body[16:20])),
+				delay:       numerator * time.Second / denominator,
+				dispose:     body[24],
+				blendSource: body[25] == apngBlendSource,
+			})
+			current = &frames[len(frames)-1]
+		case "IDAT":
+			// The default image is only the first frame if an fcTL chunk
+			// precedes it.
+			if current != nil {
+				current.data = append(current.data, body)
+			}
+		case "fdAT":
+			if current == nil || len(body) < 4 {
+				err = fmt.Errorf("%w: fdAT chunk without frame control", ErrInvalidAPNG)
+				return false
+			}
+			current.data = append(current.data, body[4:])
+		}
+		return true
+	})
+	if err == nil && len(header) < 13 {
+		err = fmt.Errorf("%w: missing IHDR chunk", ErrInvalidAPNG)
+	}
+	return header, shared, frames, err
+}
+
+// decodeAPNGFrame decodes the image data of a frame, by wrapping it into a
+// still PNG file of the frame's size.
+func decodeAPNGFrame(header []byte, shared [][]byte, frame apngFrame) (image.Image, error) {
+	if frame.width <= 0 || frame.height <= 0 || len(frame.data) == 0 {
+		return nil, fmt.Errorf("%w: empty frame", ErrInvalidAPNG)
+	}
+
+	frameHeader := bytes.Clone(header)
+	binary.BigEndian.PutUint32(frameHeader[0:4], uint32(frame.width))
+	binary.BigEndian.PutUint32(frameHeader[4:8], uint32(frame.height))
+
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+	buf.Write(chunk("IHDR", frameHeader))
+	for _, c := range shared {
+		buf.Write(c)
+	}
+	for _, data := range frame.data {
+		buf.Write(chunk("IDAT", data))
+	}
+	buf.Write(chunk("IEND", nil))
+
+	img, _, err := decodeData(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// chunk encodes a PNG chunk.
+func chunk(kind string, body []byte) []byte {
+	encoded := make([]byte, 0, len(body)+12)
+	encoded = binary.BigEndian.AppendUint32(encoded, uint32(len(body)))
+	encoded = append(encoded, kind...)
+	encoded = append(encoded, body...)
+	return binary.BigEndian.AppendUint32(encoded, crc32.ChecksumIEEE(encoded[4:]))
+}
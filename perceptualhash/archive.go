@@ -0,0 +1,249 @@
+package perceptualhash
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupportedArchive is returned by IterArchive and ArchiveFiles for
+// files that are not zip or tar archives.
+var ErrUnsupportedArchive = errors.New("archive format is not supported")
+
+// ErrEntryTooLarge is returned when reading an archive entry larger than
+// Config.Pipeline.MaxEntrySize.
+var ErrEntryTooLarge = errors.New("archive entry is too large")
+
+// DefaultMaxEntrySize is the largest archive entry read when
+// Config.Pipeline.MaxEntrySize is zero.
+const DefaultMaxEntrySize = 256 << 20
+
+// IterArchive lazily yields the hash of every image file in the archive at
+// archivePath.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.IterArchive.
+func IterArchive(ctx context.Context, archivePath string, configs ...Config) iter.Seq[Result] {
+	h, err := newHasher(configs)
+	if err != nil {
+		return failedIter(archivePath, err)
+	}
+	return h.IterArchive(ctx, archivePath)
+}
+
+// ArchiveFiles lazily yields the image files IterArchive would hash.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.ArchiveFiles.
+func ArchiveFiles(archivePath string, configs ...Config) iter.Seq2[ArchiveFile, error] {
+	h, err := newHasher(configs)
+	if err != nil {
+		return func(yield func(ArchiveFile, error) bool) {
+			yield(ArchiveFile{}, err)
+		}
+	}
+	return h.ArchiveFiles(archivePath)
+}
+
+// IterArchive lazily yields the hash of every image file in the zip, tar or
+// gzip-compressed tar archive at archivePath, in archive order, without
+// extracting it. The format is chosen by the extension: .zip, .tar, .tar.gz
+// or .tgz. Entries are selected as by ImagePaths, matching their path within
+// the archive, and reported with that path joined to archivePath, as in
+// "backup.zip/2023/IMG_0001.jpg".
+//
+// Errors for individual entries are reported in Result.Err and the
+// iteration continues; an unreadable archive ends it with a result for
+// archivePath. Breaking out of the loop stops reading the archive. Debug
+// artifacts are not written.
+func (h *DCTHasher) IterArchive(ctx context.Context, archivePath string) iter.Seq[Result] {
+	config := h.config
+	return func(yield func(Result) bool) {
+		for file, err := range h.ArchiveFiles(archivePath) {
+			if err != nil {
+				yield(Result{Path: archivePath, Err: err})
+				return
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				yield(Result{Path: archivePath, Err: ctxErr})
+				return
+			}
+
+			load := func(string, Config) ([]byte, func(), error) {
+				data, err := file.Read()
+				return data, func() {}, err
+			}
+			if !yield(timedHash(file.Path, load, config)) {
+				return
+			}
+		}
+	}
+}
+
+// ArchiveFile is an image file in an archive, yielded by ArchiveFiles.
+type ArchiveFile struct {
+	// Path is the path of the file within the archive joined to the path of
+	// the archive.
+	Path string
+	// Read returns the contents of the file. It is only valid until the next
+	// file is yielded.
+	Read func() ([]byte, error)
+}
+
+// ArchiveFiles lazily yields the image files IterArchive would hash, in
+// archive order, without reading their contents until asked. An unreadable
+// or unsupported archive ends the iteration with an error. Reading an entry
+// larger than Config.Pipeline.MaxEntrySize fails with ErrEntryTooLarge.
+func (h *DCTHasher) ArchiveFiles(archivePath string) iter.Seq2[ArchiveFile, error] {
+	config := h.config
+	return func(yield func(ArchiveFile, error) bool) {
+		limit := config.Pipeline.MaxEntrySize
+		if limit == 0 {
+			limit = DefaultMaxEntrySize
+		}
+
+		var entries iter.Seq2[archiveEntry, error]
+		switch name := strings.ToLower(archivePath); {
+		case strings.HasSuffix(name, ".zip"):
+			entries = zipEntries(archivePath, limit)
+		case strings.HasSuffix(name, ".tar"):
+			entries = tarEntries(archivePath, false, limit)
+		case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+			entries = tarEntries(archivePath, true, limit)
+		default:
+			yield(ArchiveFile{}, ErrUnsupportedArchive)
+			return
+		}
+
+		selector := newSelector(config)
+		for entry, err := range entries {
+			if err != nil {
+				yield(ArchiveFile{}, err)
+				return
+			}
+			name := path.Clean(strings.TrimPrefix(entry.name, "/"))
+			if !selector.entry(name) {
+				continue
+			}
+			file := ArchiveFile{Path: filepath.Join(archivePath, filepath.FromSlash(name)), Read: entry.read}
+			if !yield(file, nil) {
+				return
+			}
+		}
+	}
+}
+
+// archiveEntry is a regular file in an archive.
+type archiveEntry struct {
+	name string
+	// read returns the contents of the entry. It is only valid until the
+	// next entry is yielded.
+	read func() ([]byte, error)
+}
+
+// zipEntries yields the regular files of the zip archive at archivePath,
+// whose contents are read up to limit bytes.
+func zipEntries(archivePath string, limit int64) iter.Seq2[archiveEntry, error] {
+	return func(yield func(archiveEntry, error) bool) {
+		r, err := zip.OpenReader(archivePath)
+		if err != nil {
+			yield(archiveEntry{}, err)
+			return
+		}
+		defer r.Close()
+
+		for _, f := range r.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			read := func() ([]byte, error) {
+				if f.UncompressedSize64 > uint64(limit) {
+					return nil, fmt.Errorf("%w: %d bytes", ErrEntryTooLarge, f.UncompressedSize64)
+				}
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return readEntry(rc, limit)
+			}
+			if !yield(archiveEntry{name: f.Name, read: read}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// tarEntries yields the regular files of the tar archive at archivePath,
+// which is gzip-compressed if compressed is set, and whose contents are read
+// up to limit bytes. The archive is read as a stream, so entries must be read
+// in order.
+func tarEntries(archivePath string, compressed bool, limit int64) iter.Seq2[archiveEntry, error] {
+	return func(yield func(archiveEntry, error) bool) {
+		f, err := os.Open(archivePath)
+		if err != nil {
+			yield(archiveEntry{}, err)
+			return
+		}
+		defer f.Close()
+
+		var r io.Reader = f
+		if compressed {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				yield(archiveEntry{}, err)
+				return
+			}
+			defer gz.Close()
+			r = gz
+		}
+
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(archiveEntry{}, err)
+				return
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			size := header.Size
+			read := func() ([]byte, error) {
+				if size > limit {
+					return nil, fmt.Errorf("%w: %d bytes", ErrEntryTooLarge, size)
+				}
+				return readEntry(tr, limit)
+			}
+			if !yield(archiveEntry{name: header.Name, read: read}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// readEntry reads an archive entry of at most limit bytes. The size recorded
+// in the archive is checked before reading, but a corrupt or hostile archive
+// can understate it, so the read itself is bounded too.
+func readEntry(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrEntryTooLarge, limit)
+	}
+	return data, nil
+}
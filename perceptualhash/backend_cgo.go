@@ -0,0 +1,146 @@
+//go:build phash_cgo && cgo
+
+package perceptualhash
+
+/*
+#cgo CFLAGS: -O2
+#cgo LDFLAGS: -ljpeg
+
+#include <setjmp.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <jpeglib.h>
+
+struct phash_error {
+	struct jpeg_error_mgr pub;
+	jmp_buf jump;
+	char message[JMSG_LENGTH_MAX];
+};
+
+static void phash_error_exit(j_common_ptr cinfo) {
+	struct phash_error *err = (struct phash_error *)cinfo->err;
+	(*cinfo->err->format_message)(cinfo, err->message);
+	longjmp(err->jump, 1);
+}
+
+// phash_emit_message treats corrupt data warnings as errors, matching
+// image/jpeg, and silences trace messages.
+static void phash_emit_message(j_common_ptr cinfo, int level) {
+	if (level < 0) {
+		phash_error_exit(cinfo);
+	}
+}
+
+// phash_decode_jpeg decodes data into a malloc'ed buffer of 8-bit grayscale
+// or RGB pixels. It returns NULL with an empty message for CMYK images,
+// which are left to the Go decoder, and NULL with a message on errors.
+static unsigned char *phash_decode_jpeg(const unsigned char *data, unsigned long size,
+		int *width, int *height, int *components, char *message) {
+	struct jpeg_decompress_struct cinfo;
+	struct phash_error err;
+	unsigned char *volatile pixels = NULL;
+
+	message[0] = '\0';
+	cinfo.err = jpeg_std_error(&err.pub);
+	err.pub.error_exit = phash_error_exit;
+	err.pub.emit_message = phash_emit_message;
+	if (setjmp(err.jump)) {
+		snprintf(message, JMSG_LENGTH_MAX, "%s", err.message);
+		jpeg_destroy_decompress(&cinfo);
+		free(pixels);
+		return NULL;
+	}
+
+	jpeg_create_decompress(&cinfo);
+	jpeg_mem_src(&cinfo, data, size);
+	jpeg_read_header(&cinfo, TRUE);
+	if (cinfo.jpeg_color_space == JCS_CMYK || cinfo.jpeg_color_space == JCS_YCCK) {
+		jpeg_destroy_decompress(&cinfo);
+		return NULL;
+	}
+	cinfo.out_color_space = cinfo.num_components == 1 ? JCS_GRAYSCALE : JCS_RGB;
+	jpeg_start_decompress(&cinfo);
+
+	size_t stride = (size_t)cinfo.output_width * cinfo.output_components;
+	pixels = malloc(stride * cinfo.output_height);
+	if (pixels == NULL) {
+		snprintf(message, JMSG_LENGTH_MAX, "out of memory");
+		jpeg_destroy_decompress(&cinfo);
+		return NULL;
+	}
+	while (cinfo.output_scanline < cinfo.output_height) {
+		JSAMPROW row = pixels + cinfo.output_scanline * stride;
+		jpeg_read_scanlines(&cinfo, &row, 1);
+	}
+
+	*width = cinfo.output_width;
+	*height = cinfo.output_height;
+	*components = cinfo.output_components;
+	jpeg_finish_decompress(&cinfo);
+	jpeg_destroy_decompress(&cinfo);
+	return pixels;
+}
+
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"unsafe"
+)
+
+// backend describes the implementation compiled in, as reported by Backend.
+const backend = "cgo: libjpeg-turbo decoding"
+
+// jpegDecoder names the JPEG decoder for CacheKey, since libjpeg-turbo and
+// image/jpeg may decode the same file to hashes a bit or two apart.
+const jpegDecoder = "libjpeg-turbo"
+
+// decodeJPEG decodes a JPEG image with libjpeg-turbo. CMYK images, which
+// libjpeg-turbo cannot convert to RGB, fall back to the standard library.
+//
+// libjpeg-turbo rounds slightly differently from image/jpeg, so a few hashes
+// may differ by a bit or two from those of a pure-Go build.
+func decodeJPEG(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var width, height, components C.int
+	message := (*C.char)(C.malloc(C.JMSG_LENGTH_MAX))
+	defer C.free(unsafe.Pointer(message))
+
+	pixels := C.phash_decode_jpeg((*C.uchar)(unsafe.Pointer(&data[0])), C.ulong(len(data)), &width, &height, &components, message)
+	if pixels == nil {
+		if *message != 0 {
+			return nil, errors.New("jpeg: " + C.GoString(message))
+		}
+		return jpeg.Decode(bytes.NewReader(data))
+	}
+	defer C.free(unsafe.Pointer(pixels))
+
+	w, h := int(width), int(height)
+	if components == 1 {
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		copy(img.Pix, unsafe.Slice((*byte)(unsafe.Pointer(pixels)), w*h))
+		return img, nil
+	}
+
+	rgb := unsafe.Slice((*byte)(unsafe.Pointer(pixels)), w*h*3)
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i, j := 0, 0; i < len(rgb); i, j = i+3, j+4 {
+		img.Pix[j] = rgb[i]
+		img.Pix[j+1] = rgb[i+1]
+		img.Pix[j+2] = rgb[i+2]
+		img.Pix[j+3] = 0xff
+	}
+	return img, nil
+}
@@ -0,0 +1,22 @@
+//go:build !phash_cgo || !cgo
+
+package perceptualhash
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+// backend describes the implementation compiled in, as reported by Backend.
+const backend = "pure Go"
+
+// jpegDecoder names the JPEG decoder for CacheKey. It is empty for the
+// standard library, so keys computed before the phash_cgo tag existed stay
+// valid.
+const jpegDecoder = ""
+
+// decodeJPEG decodes a JPEG image with the standard library.
+func decodeJPEG(r io.Reader) (image.Image, error) {
+	return jpeg.Decode(r)
+}
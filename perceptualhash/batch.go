@@ -0,0 +1,133 @@
+package perceptualhash
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// Accelerator computes the DCT of batches of preprocessed images on a
+// device such as a GPU, through CUDA, OpenCL or a compute shader. It is
+// installed with SetAccelerator and used by HashBatch. The package ships no
+// implementation; it is the extension point for one built outside it.
+type Accelerator interface {
+	// Name describes the device, as reported by Backend.
+	Name() string
+	// FixedDCT returns, for every 32x32 image of batch, the lowest size x
+	// size coefficients of the fixed-point DCT, indexed [u][v]. It must
+	// match the integer arithmetic of FixedPointDCT exactly, which keeps
+	// hashes identical to those computed on the CPU.
+	FixedDCT(batch []*image.Gray, size int) ([][][]int64, error)
+}
+
+var (
+	acceleratorMu sync.RWMutex
+	accelerator   Accelerator
+)
+
+// SetAccelerator installs a for HashBatch. Nil restores the CPU.
+func SetAccelerator(a Accelerator) {
+	acceleratorMu.Lock()
+	defer acceleratorMu.Unlock()
+
+	accelerator = a
+}
+
+// BatchResult is the hash of one image of a batch.
+type BatchResult struct {
+	Hash Hash
+	Err  error
+}
+
+// HashBatch computes the hashes of imgs, with the results in the same
+// order.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.HashBatch.
+func HashBatch(imgs []image.Image, configs ...Config) []BatchResult {
+	h, err := newHasher(configs)
+	if err != nil {
+		results := make([]BatchResult, len(imgs))
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+	return h.HashBatch(imgs)
+}
+
+// HashBatch computes the hashes of imgs, such as the frames of a video,
+// with the results in the same order. Images are preprocessed concurrently.
+// With Config.Transform set to FixedPointDCT and an accelerator installed,
+// the DCT of the whole batch is then computed on it; if it fails, or
+// otherwise, the DCT runs concurrently on the CPU, with the same hashes.
+func (h *DCTHasher) HashBatch(imgs []image.Image) []BatchResult {
+	config := h.config
+	results := make([]BatchResult, len(imgs))
+
+	grays := make([]*image.Gray, len(imgs))
+	parallel(len(imgs), func(i int) {
+		if bounds := imgs[i].Bounds(); bounds.Dx() < workingSize || bounds.Dy() < workingSize {
+			results[i].Err = ErrImageTooSmall
+			return
+		}
+		gray := preprocessImage(imgs[i], config)
+		if stdDev(gray) < minStdDev {
+			results[i].Err = ErrLowEntropyImage
+			return
+		}
+		grays[i] = gray
+	})
+
+	var pending []int
+	for i, gray := range grays {
+		if gray != nil {
+			pending = append(pending, i)
+		}
+	}
+
+	acceleratorMu.RLock()
+	a := accelerator
+	acceleratorMu.RUnlock()
+	if a != nil && config.Transform == FixedPointDCT && len(pending) > 0 {
+		batch := make([]*image.Gray, len(pending))
+		for j, i := range pending {
+			batch[j] = grays[i]
+		}
+		coefficients, err := a.FixedDCT(batch, max(fixedBlock, coefficientExtent(config)))
+		if err == nil && len(coefficients) == len(batch) {
+			for j, i := range pending {
+				results[i].Hash = Hash(generateFixedHash(coefficients[j], config))
+			}
+			return results
+		}
+	}
+
+	parallel(len(pending), func(j int) {
+		i := pending[j]
+		hash, _, err := hashGray(grays[i], config)
+		results[i] = BatchResult{Hash: Hash(hash), Err: err}
+	})
+	return results
+}
+
+// parallel calls fn for every index below n, on up to one goroutine per
+// CPU.
+func parallel(n int, fn func(i int)) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(n, runtime.NumCPU()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
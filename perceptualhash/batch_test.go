@@ -0,0 +1,74 @@
+package perceptualhash
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// fakeAccelerator computes the fixed-point DCT on the CPU, standing in for
+// a device, or fails with err.
+type fakeAccelerator struct {
+	err   error
+	calls int
+}
+
+func (a *fakeAccelerator) Name() string { return "fake" }
+
+func (a *fakeAccelerator) FixedDCT(batch []*image.Gray, size int) ([][][]int64, error) {
+	a.calls++
+	if a.err != nil {
+		return nil, a.err
+	}
+	coefficients := make([][][]int64, len(batch))
+	for i, img := range batch {
+		coefficients[i] = fixedDCT(img, size)
+	}
+	return coefficients, nil
+}
+
+// batchImages returns images of distinct patterns, and one too small to
+// hash.
+func batchImages() []image.Image {
+	var imgs []image.Image
+	for k := range 4 {
+		img := image.NewGray(image.Rect(0, 0, 64, 48))
+		for y := range 48 {
+			for x := range 64 {
+				img.SetGray(x, y, color.Gray{uint8((x*(k+1) + y*(3-k)*2) * 3)})
+			}
+		}
+		imgs = append(imgs, img)
+	}
+	return append(imgs, image.NewGray(image.Rect(0, 0, 8, 8)))
+}
+
+func TestHashBatchAccelerator(t *testing.T) {
+	h, err := New(WithTransform(FixedPointDCT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgs := batchImages()
+	cpu := h.HashBatch(imgs)
+	for i, img := range imgs {
+		want, wantErr := h.Hash(img)
+		if cpu[i].Hash != want || !errors.Is(cpu[i].Err, wantErr) {
+			t.Fatalf("image %d: HashBatch() = %v, Hash() = %v, %v", i, cpu[i], want, wantErr)
+		}
+	}
+
+	for _, a := range []*fakeAccelerator{{}, {err: errors.New("device lost")}} {
+		SetAccelerator(a)
+		results := h.HashBatch(imgs)
+		SetAccelerator(nil)
+		if a.calls != 1 {
+			t.Errorf("accelerator error %v: FixedDCT called %d times, want 1", a.err, a.calls)
+		}
+		for i := range imgs {
+			if results[i] != cpu[i] {
+				t.Errorf("accelerator error %v, image %d: HashBatch() = %v, want %v as on the CPU", a.err, i, results[i], cpu[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package perceptualhash
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cache stores computed hashes, so images whose contents did not change are
+// not decoded and hashed again. Keys are produced by CacheKey and change
+// with the file contents and the configuration. Implementations must be
+// safe for concurrent use; one backed by a network store such as Redis
+// should treat its errors as misses, since hashing does not depend on the
+// cache.
+type Cache interface {
+	// Get returns the hash stored under key, if any.
+	Get(key string) (string, bool)
+	// Set stores hash under key.
+	Set(key, hash string)
+}
+
+// CacheKey returns the cache key of the hash of an image file with the
+// given contents, hashed with config: a hex SHA-256 digest of the contents,
+// of every option that affects the hash and of the JPEG decoder compiled
+// in, so builds with and without the phash_cgo tag can share a cache.
+func CacheKey(data []byte, config Config) string {
+	return cacheKey(data, config, jpegDecoder)
+}
+
+// cacheKey returns CacheKey for the named JPEG decoder.
+func cacheKey(data []byte, config Config, decoder string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "phash/v3 %d %d %d %t %t %v %d\n",
+		config.DCMode, config.Transform, config.Watermark, config.SuppressText,
+		config.SmartCrop, config.Coefficients, config.Order)
+	// Only set, so the keys of hashes computed without it stay valid.
+	if config.CenterWeight != 0 {
+		fmt.Fprintf(h, "center %g\n", config.CenterWeight)
+	}
+	if decoder != "" {
+		fmt.Fprintf(h, "decoder %s\n", decoder)
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checksum returns the hex encoded SHA-256 digest of data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedHash returns the hash of data from config.Pipeline.Cache, computing it with
+// compute and storing it on a miss.
+func cachedHash(data []byte, config Config, compute func() (string, error)) (string, error) {
+	key := CacheKey(data, config)
+	if hash, ok := config.Pipeline.Cache.Get(key); ok {
+		return hash, nil
+	}
+	hash, err := compute()
+	if err != nil {
+		return "", err
+	}
+	config.Pipeline.Cache.Set(key, hash)
+	return hash, nil
+}
+
+// MemoryCache is a Cache holding a bounded number of hashes in memory,
+// evicting the least recently used ones. It is safe for concurrent use.
+type MemoryCache struct {
+	size int
+
+	mu       sync.Mutex
+	lru      *list.List
+	elements map[string]*list.Element
+}
+
+// memoryEntry is an element of the MemoryCache list.
+type memoryEntry struct {
+	key, hash string
+}
+
+// NewMemoryCache returns an empty memory cache holding up to size hashes.
+func NewMemoryCache(size int) *MemoryCache {
+	return &MemoryCache{
+		size:     max(size, 1),
+		lru:      list.New(),
+		elements: map[string]*list.Element{},
+	}
+}
+
+func (c *MemoryCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.elements[key]
+	if !ok {
+		return "", false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(memoryEntry).hash, true
+}
+
+func (c *MemoryCache) Set(key, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.elements[key]; ok {
+		element.Value = memoryEntry{key, hash}
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.elements[key] = c.lru.PushFront(memoryEntry{key, hash})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Remove(c.lru.Back()).(memoryEntry)
+		delete(c.elements, oldest.key)
+	}
+}
+
+// Len returns the number of cached hashes.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// DiskCache is a Cache storing each hash in a small file under a directory,
+// so it persists across runs, such as nightly jobs over a mostly unchanged
+// library. Files are spread over subdirectories named after the first two
+// characters of their key. It never evicts; remove the directory to clear
+// it. It is safe for concurrent use, also by several processes.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a disk cache in dir, creating the directory if
+// needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// path returns the file storing the hash under key, or "" for keys that
+// are not CacheKey digests and would escape the directory.
+func (c *DiskCache) path(key string) string {
+	if len(key) < 3 || strings.ContainsAny(key, `/\.`) {
+		return ""
+	}
+	return filepath.Join(c.dir, key[:2], key[2:])
+}
+
+func (c *DiskCache) Get(key string) (string, bool) {
+	path := c.path(key)
+	if path == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func (c *DiskCache) Set(key, hash string) {
+	path := c.path(key)
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	// Writing to a temporary file and renaming it keeps concurrent readers
+	// from seeing partial entries.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.WriteString(hash)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,16 @@
+package perceptualhash
+
+import "testing"
+
+func TestCacheKeyDecoder(t *testing.T) {
+	data := []byte("image data")
+	// Keys of the standard library decoder must not change, so existing
+	// caches stay valid.
+	const want = "1d4670cf3003b5a622d1f7c51e3fa9e63391d85dc1c948c02f2e4343335f13a5"
+	if got := cacheKey(data, defaultConfig, ""); got != want {
+		t.Errorf("cacheKey() = %s, want %s", got, want)
+	}
+	if cacheKey(data, defaultConfig, "libjpeg-turbo") == cacheKey(data, defaultConfig, "") {
+		t.Error("cacheKey() ignores the JPEG decoder")
+	}
+}
@@ -0,0 +1,86 @@
+package perceptualhash
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// chromaConfig hashes the lowest 8x4 frequencies of a chroma plane, 32 bits,
+// so both planes fit in one Hash.
+var chromaConfig = Config{Coefficients: image.Rect(0, 0, 8, 4), DCMode: DCExcluded}
+
+// ChromaHash computes a 64-bit color signature of img from its chroma
+// planes: the low 32 bits hash the blue-difference (Cb) plane and the high
+// 32 bits the red-difference (Cr) plane, each like the DCT hash hashes
+// brightness. JPEG images decode to an image.YCbCr, whose subsampled planes
+// are hashed directly, without any color conversion; other images are
+// converted. It is cheaper than ColorHash and, unlike it, tracks where
+// colors are. A plane without variation, as in grayscale images, hashes to
+// zero bits.
+func ChromaHash(img image.Image) (Hash, error) {
+	if bounds := img.Bounds(); bounds.Dx() < workingSize || bounds.Dy() < workingSize {
+		return 0, ErrImageTooSmall
+	}
+
+	var cb, cr *image.Gray
+	if ycc, ok := img.(*image.YCbCr); ok {
+		cb = imgresize.Gray(chromaPlane(ycc, ycc.Cb), workingSize, workingSize)
+		cr = imgresize.Gray(chromaPlane(ycc, ycc.Cr), workingSize, workingSize)
+	} else {
+		cb, cr = chromaPlanes(imgresize.Resize(img, workingSize, workingSize))
+	}
+	return chromaPlaneHash(cb) | chromaPlaneHash(cr)<<32, nil
+}
+
+// chromaPlane returns pix, the Cb or Cr samples of img, as a grayscale image
+// covering the subsampled bounds, without copying.
+func chromaPlane(img *image.YCbCr, pix []uint8) *image.Gray {
+	sx, sy := 1, 1
+	switch img.SubsampleRatio {
+	case image.YCbCrSubsampleRatio422:
+		sx = 2
+	case image.YCbCrSubsampleRatio420:
+		sx, sy = 2, 2
+	case image.YCbCrSubsampleRatio440:
+		sy = 2
+	case image.YCbCrSubsampleRatio411:
+		sx = 4
+	case image.YCbCrSubsampleRatio410:
+		sx, sy = 4, 2
+	}
+
+	r := img.Rect
+	bounds := image.Rect(r.Min.X/sx, r.Min.Y/sy, (r.Max.X+sx-1)/sx, (r.Max.Y+sy-1)/sy)
+	return &image.Gray{Pix: pix, Stride: img.CStride, Rect: bounds}
+}
+
+// chromaPlanes converts an RGBA image to its Cb and Cr planes.
+func chromaPlanes(img *image.RGBA) (cb, cr *image.Gray) {
+	cb = image.NewGray(img.Rect)
+	cr = image.NewGray(img.Rect)
+	for i := 0; i < len(img.Pix)/4; i++ {
+		_, cb.Pix[i], cr.Pix[i] = color.RGBToYCbCr(img.Pix[4*i], img.Pix[4*i+1], img.Pix[4*i+2])
+	}
+	return cb, cr
+}
+
+// chromaPlaneHash computes the 32-bit hash of a 32x32 chroma plane.
+func chromaPlaneHash(plane *image.Gray) Hash {
+	if stdDev(plane) < minStdDev {
+		return 0
+	}
+	return Hash(generateHash(dct(grayPixels(plane, nil)), chromaConfig))
+}
+
+// chromaHasher is ChromaHash as a Hasher.
+type chromaHasher struct{}
+
+func (chromaHasher) Hash(img image.Image) (Hash, error) {
+	return ChromaHash(img)
+}
+
+func (chromaHasher) Name() string { return "chromahash" }
+
+func (chromaHasher) Bits() int { return 64 }
@@ -0,0 +1,82 @@
+package perceptualhash
+
+import "image"
+
+// defaultCoefficients is the block of DCT coefficients hashed when
+// Config.Coefficients is empty: the lowest 8x8 frequencies.
+var defaultCoefficients = image.Rect(0, 0, 8, 8)
+
+// coefficient is the position of a DCT coefficient in the DCT matrix, by
+// vertical frequency (row) and horizontal frequency (col).
+type coefficient struct{ row, col int }
+
+// coefficientRegion returns the block of DCT coefficients hashed for config.
+func coefficientRegion(config Config) image.Rectangle {
+	if config.Coefficients.Empty() {
+		return defaultCoefficients
+	}
+	return config.Coefficients
+}
+
+// hashedCoefficients returns the coefficients giving bits 0, 1, ... of the
+// hash for config, and whether bit 0 is reserved for the DC coefficient and
+// never set.
+func hashedCoefficients(config Config) ([]coefficient, bool) {
+	if config.Order == ZigzagOrder {
+		// One more than the hash holds, for DCExcluded.
+		selected := zigzag(65)
+		if config.DCMode == DCExcluded {
+			selected[0] = selected[64]
+			return selected[:64], false
+		}
+		return selected[:64], true
+	}
+
+	region := coefficientRegion(config)
+	selected := make([]coefficient, 0, region.Dx()*region.Dy())
+	for row := region.Min.Y; row < region.Max.Y; row++ {
+		for col := region.Min.X; col < region.Max.X; col++ {
+			selected = append(selected, coefficient{row, col})
+		}
+	}
+
+	// DCMode only concerns blocks including the DC coefficient.
+	if region.Min != (image.Point{}) {
+		return selected, false
+	}
+	if config.DCMode == DCExcluded {
+		selected[0] = coefficient{0, region.Max.X}
+		return selected, false
+	}
+	return selected, true
+}
+
+// coefficientExtent returns the side of the smallest square block at the
+// origin of the DCT matrix holding every coefficient hashed for config.
+func coefficientExtent(config Config) int {
+	selected, _ := hashedCoefficients(config)
+	extent := 0
+	for _, c := range selected {
+		extent = max(extent, c.row+1, c.col+1)
+	}
+	return extent
+}
+
+// zigzag returns the first n coefficients of the DCT matrix in the zigzag
+// scan order of JPEG, walking the anti-diagonals from the DC coefficient
+// and alternating direction: (0,0), (0,1), (1,0), (2,0), (1,1), (0,2)...
+func zigzag(n int) []coefficient {
+	order := make([]coefficient, 0, n)
+	for diagonal := 0; len(order) < n; diagonal++ {
+		for i := 0; i <= diagonal && len(order) < n; i++ {
+			// Odd diagonals run down and to the left, even ones up and to
+			// the right.
+			row := i
+			if diagonal%2 == 0 {
+				row = diagonal - i
+			}
+			order = append(order, coefficient{row, diagonal - row})
+		}
+	}
+	return order
+}
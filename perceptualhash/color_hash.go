@@ -0,0 +1,90 @@
+package perceptualhash
+
+import (
+	"image"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// colorBins is the number of color classes measured by ColorHash: black,
+// gray, and six hue ranges each for faint and saturated colors.
+const colorBins = 14
+
+// colorLevels is the number of bits, and quantization levels, per class.
+const colorLevels = 4
+
+// ColorHash computes a 56-bit color signature of img, complementing the
+// grayscale perceptual hash, which cannot tell colorways apart.
+//
+// Each color class stores the share of pixels it holds as 0 to 4 set bits,
+// so the Hamming distance between two color hashes is the total difference in
+// quantized shares. Hue shares are relative to the colored pixels only.
+func ColorHash(img image.Image) Hash {
+	const size = 64
+	small := imgresize.Resize(img, size, size, imgresize.Config{Filter: imgresize.ApproxBiLinear})
+
+	var counts [colorBins]int
+	colored := 0
+	for i := 0; i < len(small.Pix); i += 4 {
+		h, s, v := hsv(small.Pix[i], small.Pix[i+1], small.Pix[i+2])
+		switch {
+		case v < 1.0/8:
+			counts[0]++
+		case s < 1.0/3:
+			counts[1]++
+		case s < 2.0/3:
+			counts[2+hueBin(h)]++
+			colored++
+		default:
+			counts[8+hueBin(h)]++
+			colored++
+		}
+	}
+
+	var hash Hash
+	for bin, count := range counts {
+		total := size * size
+		if bin >= 2 {
+			total = max(colored, 1)
+		}
+		level := (count*colorLevels + total/2) / total
+		for bit := 0; bit < level; bit++ {
+			hash |= 1 << (bin*colorLevels + bit)
+		}
+	}
+	return hash
+}
+
+// hueBin maps a hue in [0, 1) to one of six equal ranges.
+func hueBin(h float64) int {
+	return min(int(h*6), 5)
+}
+
+// hsv converts 8-bit RGB to hue, saturation and value, each in [0, 1].
+func hsv(r, g, b uint8) (h, s, v float64) {
+	maxC := max(r, g, b)
+	minC := min(r, g, b)
+	v = float64(maxC) / 255
+	if maxC == 0 {
+		return 0, 0, v
+	}
+	delta := float64(maxC - minC)
+	s = delta / float64(maxC)
+	if delta == 0 {
+		return 0, s, v
+	}
+
+	switch maxC {
+	case r:
+		h = (float64(g) - float64(b)) / delta
+	case g:
+		h = 2 + (float64(b)-float64(r))/delta
+	default:
+		h = 4 + (float64(r)-float64(g))/delta
+	}
+	h /= 6
+	if h < 0 {
+		h++
+	}
+	return h, s, v
+}
@@ -0,0 +1,41 @@
+package perceptualhash
+
+import "fmt"
+
+// DefaultThreshold is the largest distance CompareFiles reports as similar
+// unless WithThreshold is given, tolerating resizing and recompression.
+const DefaultThreshold = 10
+
+// CompareFiles hashes the images at pathA and pathB and returns the number
+// of differing bits between them, and whether it is within the threshold
+// set by WithThreshold. The configuration is built from opts as by New.
+func CompareFiles(pathA, pathB string, opts ...Option) (distance int, similar bool, err error) {
+	o := applyOptions(opts)
+	config := o.Config
+	if err := config.Validate(); err != nil {
+		return 0, false, err
+	}
+	if o.threshold < 0 {
+		return 0, false, fmt.Errorf("%w: threshold %d is negative", ErrInvalidConfig, o.threshold)
+	}
+
+	hashA, err := hashFile(pathA, config)
+	if err != nil {
+		return 0, false, err
+	}
+	hashB, err := hashFile(pathB, config)
+	if err != nil {
+		return 0, false, err
+	}
+	distance = hashA.Distance(hashB)
+	return distance, distance <= o.threshold, nil
+}
+
+// hashFile hashes the image at path as by FromPath.
+func hashFile(path string, config Config) (Hash, error) {
+	hex, err := (&DCTHasher{config: config}).FromPath(path)
+	if err != nil {
+		return 0, err
+	}
+	return ParseHash(hex)
+}
@@ -0,0 +1,118 @@
+package perceptualhash
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+)
+
+var ErrInvalidConfig = errors.New("invalid perceptual hash config")
+
+// Validate reports every problem with the configuration, so mistakes
+// surface before any expensive decoding work. The functions taking a
+// Config call it automatically.
+func (c Config) Validate() error {
+	debugPaths := []struct{ name, path string }{
+		{"PreprocessedImagePath", c.DebugParameter.PreprocessedImagePath},
+		{"VisualizedImagePath", c.DebugParameter.VisualizedImagePath},
+		{"ReportPath", c.DebugParameter.ReportPath},
+	}
+
+	var errs []error
+	var anyPath bool
+	seen := map[string]string{}
+	for _, debugPath := range debugPaths {
+		name, path := debugPath.name, debugPath.path
+		if path == "" {
+			continue
+		}
+		anyPath = true
+
+		if !c.Debug {
+			errs = append(errs, fmt.Errorf("%w: DebugParameter.%s is set but Debug is false", ErrInvalidConfig, name))
+			continue
+		}
+		if other, ok := seen[filepath.Clean(path)]; ok {
+			errs = append(errs, fmt.Errorf("%w: DebugParameter.%s and DebugParameter.%s both write to %q", ErrInvalidConfig, other, name, path))
+			continue
+		}
+		seen[filepath.Clean(path)] = name
+
+		if err := checkWritableDir(filepath.Dir(path)); err != nil {
+			errs = append(errs, fmt.Errorf("%w: DebugParameter.%s: %v", ErrInvalidConfig, name, err))
+		}
+	}
+
+	if c.DCMode != DCReserved && c.DCMode != DCExcluded {
+		errs = append(errs, fmt.Errorf("%w: unknown DCMode %d", ErrInvalidConfig, c.DCMode))
+	}
+
+	if region := c.Coefficients; !region.Empty() {
+		switch {
+		case !region.In(image.Rect(0, 0, workingSize, workingSize)):
+			errs = append(errs, fmt.Errorf("%w: Coefficients %v exceed the %dx%d DCT", ErrInvalidConfig, region, workingSize, workingSize))
+		case region.Dx()*region.Dy() > 64:
+			errs = append(errs, fmt.Errorf("%w: Coefficients %v select %d coefficients, more than the 64 bits of a hash", ErrInvalidConfig, region, region.Dx()*region.Dy()))
+		case c.DCMode == DCReserved && region.Min == (image.Point{}) && region.Dx()*region.Dy() == 1:
+			errs = append(errs, fmt.Errorf("%w: Coefficients %v hold only the DC coefficient, which DCReserved leaves out", ErrInvalidConfig, region))
+		case c.DCMode == DCExcluded && region.Min == (image.Point{}) && region.Max.X >= workingSize:
+			errs = append(errs, fmt.Errorf("%w: DCExcluded needs a column right of Coefficients %v", ErrInvalidConfig, region))
+		}
+	}
+
+	switch c.Order {
+	case BlockOrder:
+	case ZigzagOrder:
+		if !c.Coefficients.Empty() {
+			errs = append(errs, fmt.Errorf("%w: Coefficients cannot be set with ZigzagOrder", ErrInvalidConfig))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%w: unknown Order %d", ErrInvalidConfig, c.Order))
+	}
+
+	if c.Transform != FloatDCT && c.Transform != FixedPointDCT {
+		errs = append(errs, fmt.Errorf("%w: unknown Transform %d", ErrInvalidConfig, c.Transform))
+	}
+
+	if c.Watermark < WatermarkNone || c.Watermark > WatermarkCenterCrop {
+		errs = append(errs, fmt.Errorf("%w: unknown Watermark %d", ErrInvalidConfig, c.Watermark))
+	}
+
+	if c.CenterWeight < 0 || c.CenterWeight > 1 {
+		errs = append(errs, fmt.Errorf("%w: CenterWeight %g is outside [0, 1]", ErrInvalidConfig, c.CenterWeight))
+	}
+
+	if c.Walk.Symlinks < SymlinkFiles || c.Walk.Symlinks > SymlinkFollow {
+		errs = append(errs, fmt.Errorf("%w: unknown Walk.Symlinks %d", ErrInvalidConfig, c.Walk.Symlinks))
+	}
+
+	if c.Pipeline.MaxEntrySize < 0 {
+		errs = append(errs, fmt.Errorf("%w: Pipeline.MaxEntrySize %d is negative", ErrInvalidConfig, c.Pipeline.MaxEntrySize))
+	}
+
+	if c.Debug && !anyPath {
+		errs = append(errs, fmt.Errorf("%w: Debug is true but no DebugParameter paths are set", ErrInvalidConfig))
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkWritableDir reports whether files can be created in dir.
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %q is not accessible: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%q is not a directory", dir)
+	}
+
+	probe, err := os.CreateTemp(dir, ".perceptualhash-*")
+	if err != nil {
+		return fmt.Errorf("directory %q is not writable: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,33 @@
+package perceptualhash_test
+
+import (
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+func TestValidateCoefficients(t *testing.T) {
+	tests := []struct {
+		name   string
+		config perceptualhash.Config
+		valid  bool
+	}{
+		{"default block", perceptualhash.Config{}, true},
+		{"single AC coefficient", perceptualhash.Config{Coefficients: image.Rect(1, 0, 2, 1)}, true},
+		{"DC only, excluded", perceptualhash.Config{Coefficients: image.Rect(0, 0, 1, 1), DCMode: perceptualhash.DCExcluded}, true},
+		// DCReserved leaves the DC coefficient out, so no coefficient is
+		// left to average.
+		{"DC only, reserved", perceptualhash.Config{Coefficients: image.Rect(0, 0, 1, 1)}, false},
+	}
+	for _, test := range tests {
+		err := test.config.Validate()
+		if test.valid && err != nil {
+			t.Errorf("%s: Validate() = %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, perceptualhash.ErrInvalidConfig) {
+			t.Errorf("%s: Validate() = %v, want ErrInvalidConfig", test.name, err)
+		}
+	}
+}
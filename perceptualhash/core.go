@@ -0,0 +1,480 @@
+package perceptualhash
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// This file holds the hashing pipeline itself. It does not touch the
+// filesystem, so it is all that is needed on platforms without one, such as
+// GOOS=js GOARCH=wasm in the browser.
+
+// FromReader computes the perceptual hash of the image read from r.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FromReader.
+func FromReader(r io.Reader, configs ...Config) (string, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return "", err
+	}
+	return h.FromReader(r)
+}
+
+// FromReader computes the perceptual hash of the image read from r. Debug
+// artifacts are written to files and are therefore only produced by
+// FromPath.
+func (h *DCTHasher) FromReader(r io.Reader) (string, error) {
+	config := h.config
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if config.Pipeline.Cache != nil {
+		return cachedHash(data, config, func() (string, error) {
+			return hashData(data, config)
+		})
+	}
+	return hashData(data, config)
+}
+
+// hashData computes the hash of an encoded image, without the cache.
+func hashData(data []byte, config Config) (string, error) {
+	decodedImage, _, err := decodeImageData(data)
+	if err != nil {
+		return "", err
+	}
+
+	hash, _, err := hashGray(preprocessImage(decodedImage, config), config)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%016x", hash), nil
+}
+
+// FromBytes computes the perceptual hash of an encoded JPEG or PNG image.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FromBytes.
+func FromBytes(data []byte, configs ...Config) (string, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return "", err
+	}
+	return h.FromBytes(data)
+}
+
+// FromBytes computes the perceptual hash of an encoded image.
+func (h *DCTHasher) FromBytes(data []byte) (string, error) {
+	return h.FromReader(bytes.NewReader(data))
+}
+
+// FromFS computes the perceptual hash of the image at path within fsys.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FromFS.
+func FromFS(fsys fs.FS, path string, configs ...Config) (string, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return "", err
+	}
+	return h.FromFS(fsys, path)
+}
+
+// FromFS computes the perceptual hash of the image at path within fsys,
+// such as an embed.FS, a zip.Reader or a fstest.MapFS. Debug artifacts are
+// not written.
+func (h *DCTHasher) FromFS(fsys fs.FS, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return h.FromReader(f)
+}
+
+// FromImage computes the perceptual hash of an already decoded image.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.Hash.
+func FromImage(img image.Image, configs ...Config) (string, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return "", err
+	}
+	hash, err := h.Hash(img)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// Formats returns the image formats that can be hashed: JPEG, PNG and TIFF,
+// and the Canon, Nikon and DNG RAW formats, hashed from their embedded JPEG
+// previews so RAW+JPEG shoots can be deduplicated without converting.
+func Formats() []string {
+	return []string{"jpeg", "png", "tiff", "cr2", "nef", "dng"}
+}
+
+// Decode decodes an encoded image as the hashing functions do, converting
+// embedded color profiles to sRGB and scaling 16-bit samples, so hashing
+// the result with a Hasher matches FromBytes. It returns the format name
+// and ErrImageTooSmall for images smaller than 32x32 pixels.
+func Decode(data []byte) (image.Image, string, error) {
+	return decodeImageData(data)
+}
+
+// decodeImage decodes an image large enough to be hashed, in one of
+// Formats.
+func decodeImage(r io.Reader) (image.Image, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	return decodeImageData(data)
+}
+
+// decodeImageData is decodeImage for an image already in memory.
+func decodeImageData(data []byte) (image.Image, string, error) {
+	decodedImage, format, err := decodeData(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !slices.Contains(Formats(), format) && format != "jpg" {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	if bounds := decodedImage.Bounds(); bounds.Dx() < workingSize || bounds.Dy() < workingSize {
+		return nil, "", ErrImageTooSmall
+	}
+
+	return decodedImage, format, nil
+}
+
+// hashGray computes the hash of a preprocessed image, along with the DCT
+// matrix it was derived from. With FixedPointDCT the matrix only holds the
+// computed block, at least 9x9.
+func hashGray(img *image.Gray, config Config) (uint64, [][]float64, error) {
+	return hashGrayInto(img, config, nil)
+}
+
+// hashGrayInto is like hashGray but fills pixels, if not nil, with the
+// intensities of img instead of allocating a matrix for them.
+func hashGrayInto(img *image.Gray, config Config, pixels [][]float64) (uint64, [][]float64, error) {
+	if stdDev(img) < minStdDev {
+		return 0, nil, ErrLowEntropyImage
+	}
+
+	if config.Transform == FixedPointDCT {
+		coefficients := fixedDCT(img, max(fixedBlock, coefficientExtent(config)))
+		dctMatrix := make([][]float64, len(coefficients))
+		for u, row := range coefficients {
+			dctMatrix[u] = make([]float64, len(row))
+			for v, value := range row {
+				dctMatrix[u][v] = float64(value)
+			}
+		}
+		return generateFixedHash(coefficients, config), dctMatrix, nil
+	}
+
+	dctMatrix := dct(grayPixels(img, pixels))
+	return generateHash(dctMatrix, config), dctMatrix, nil
+}
+
+// CompareHashes returns the number of differing hexadecimal digits between
+// two hashes, from 0 to 16 for 64-bit hashes, rather than differing bits.
+// Hashes of different lengths are rejected.
+//
+// Deprecated: Digit counts are not comparable with the bit distances used
+// everywhere else. Use Hash.Distance, or CompareMixedHashes for hexadecimal
+// hashes of possibly different lengths.
+func CompareHashes(hash1, hash2 string) (int, error) {
+	if len(hash1) != len(hash2) {
+		return 0, fmt.Errorf("hashes must be of the same length; use CompareMixedHashes to compare across lengths")
+	}
+
+	distance := 0
+	for i := 0; i < len(hash1); i++ {
+		if hash1[i] != hash2[i] {
+			distance++
+		}
+	}
+
+	return distance, nil
+}
+
+// decodeData wraps image.Decode, converting decoder panics on malformed input
+// into errors so one corrupt file cannot crash a batch run. JPEG images are
+// handed to decodeJPEG, which builds with the phash_cgo tag replace, as are
+// the previews embedded in RAW files. 16-bit images are scaled to their
+// full range, and images with an embedded ICC profile are converted to
+// sRGB.
+func decodeData(data []byte) (img image.Image, format string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			img, format, err = nil, "", fmt.Errorf("%w: %v", ErrDecoderPanic, p)
+		}
+	}()
+
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8")):
+		format = "jpeg"
+		img, err = decodeJPEG(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")):
+		// RAW camera files are TIFF files; they are decoded from the JPEG
+		// preview they embed, or as TIFF files if they have none.
+		if format = rawFormat(data); format != "" {
+			if preview := rawPreview(data); preview != nil {
+				img, err = decodeJPEG(bytes.NewReader(preview))
+				return img, format, err
+			}
+			if img, format, err = image.Decode(bytes.NewReader(data)); err != nil {
+				return nil, "", ErrNoPreview
+			}
+			break
+		}
+		img, format, err = image.Decode(bytes.NewReader(data))
+	default:
+		img, format, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return toSRGB(expandDepth(img), data), format, nil
+}
+
+// preprocessImage resizes the image to 32x32 and converts it to grayscale,
+// applying the configured watermark handling.
+func preprocessImage(inputImage image.Image, config Config) *image.Gray {
+	source := inputImage.Bounds()
+	if config.Watermark == WatermarkCenterCrop {
+		source = source.Inset(min(source.Dx(), source.Dy()) * 15 / 100)
+	}
+	if config.SmartCrop {
+		source = salientRegion(inputImage, source)
+	}
+
+	if config.SuppressText {
+		// Text is only recognizable at a higher resolution. Images without
+		// text are scaled from the original, so they hash as without
+		// SuppressText.
+		intermediate := imgresize.Gray(inputImage, textSize, textSize, imgresize.Config{Source: source})
+		if suppressText(intermediate) {
+			inputImage, source = intermediate, intermediate.Bounds()
+		}
+	}
+
+	resizedImage := imgresize.Gray(inputImage, workingSize, workingSize, imgresize.Config{Source: source})
+
+	if config.Watermark == WatermarkMask {
+		maskWatermarks(resizedImage)
+	}
+	if config.CenterWeight > 0 {
+		weightCenter(resizedImage, config.CenterWeight)
+	}
+	return resizedImage
+}
+
+// weightCenter blends every pixel of a 32x32 image toward the mean
+// intensity by strength times its squared distance from the center,
+// relative to that of the corners.
+func weightCenter(img *image.Gray, strength float64) {
+	var sum int
+	for y := range workingSize {
+		for x := range workingSize {
+			sum += int(img.GrayAt(x, y).Y)
+		}
+	}
+	mean := float64(sum) / (workingSize * workingSize)
+
+	const center = (workingSize - 1) / 2.0
+	for y := range workingSize {
+		for x := range workingSize {
+			dx, dy := (float64(x)-center)/center, (float64(y)-center)/center
+			fade := strength * (dx*dx + dy*dy) / 2
+			i := img.PixOffset(x, y)
+			value := float64(img.Pix[i])
+			img.Pix[i] = uint8(math.Round(value + (mean-value)*fade))
+		}
+	}
+}
+
+// Sizes of the regions masked by WatermarkMask, in working-size pixels.
+const (
+	watermarkCorner = 6
+	watermarkStrip  = 3
+)
+
+// maskWatermarks fills the corners and bottom strip of a 32x32 image with
+// the mean intensity of the remaining pixels.
+func maskWatermarks(img *image.Gray) {
+	masked := func(x, y int) bool {
+		if y >= workingSize-watermarkStrip {
+			return true
+		}
+		nearX := x < watermarkCorner || x >= workingSize-watermarkCorner
+		nearY := y < watermarkCorner || y >= workingSize-watermarkCorner
+		return nearX && nearY
+	}
+
+	var sum, count int
+	for y := range workingSize {
+		for x := range workingSize {
+			if !masked(x, y) {
+				sum += int(img.GrayAt(x, y).Y)
+				count++
+			}
+		}
+	}
+	mean := uint8((sum + count/2) / count)
+
+	for y := range workingSize {
+		for x := range workingSize {
+			if masked(x, y) {
+				img.Pix[img.PixOffset(x, y)] = mean
+			}
+		}
+	}
+}
+
+// stdDev returns the standard deviation of the intensities of img.
+func stdDev(img *image.Gray) float64 {
+	var sum, sumSquares int
+	for _, value := range img.Pix {
+		sum += int(value)
+		sumSquares += int(value) * int(value)
+	}
+
+	n := len(img.Pix)
+	variance := float64(n*sumSquares-sum*sum) / float64(n*n)
+	return math.Sqrt(variance)
+}
+
+// grayPixels returns the intensities of a 32x32 grayscale image as a matrix,
+// stored in dst if it is not nil.
+func grayPixels(img *image.Gray, dst [][]float64) [][]float64 {
+	if dst == nil {
+		dst = newMatrix(workingSize)
+	}
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			grayColor := img.GrayAt(x, y)
+			dst[y][x] = float64(grayColor.Y)
+		}
+	}
+	return dst
+}
+
+// newMatrix returns an n x n matrix backed by a single allocation.
+func newMatrix(n int) [][]float64 {
+	backing := make([]float64, n*n)
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		matrix[i] = backing[i*n : (i+1)*n : (i+1)*n]
+	}
+	return matrix
+}
+
+// generateHash computes the 64-bit hash from the DCT of a 32x32 grayscale
+// image, comparing the coefficients selected by config against their
+// average.
+func generateHash(dctMatrix [][]float64, config Config) uint64 {
+	selected, reserved := hashedCoefficients(config)
+	dctValues := make([]float64, len(selected))
+	for i, c := range selected {
+		dctValues[i] = dctMatrix[c.row][c.col]
+	}
+
+	// skip is the number of leading values left out of the hash.
+	skip := 0
+	if reserved {
+		skip = 1
+	}
+
+	var sum float64
+	for i := skip; i < len(dctValues); i++ {
+		sum += dctValues[i]
+	}
+	average := sum / float64(len(dctValues)-skip)
+
+	var hash uint64
+	for i, value := range dctValues {
+		if i >= skip && value > average {
+			hash |= 1 << i
+		}
+	}
+
+	return hash
+}
+
+// workingCosines is the cosine table of the working size, computed once.
+var workingCosines = sync.OnceValue(func() [][]float64 {
+	return newCosineTable(workingSize)
+})
+
+// dct performs a 2D Discrete Cosine Transform on the input matrix.
+//
+// Every product is wrapped in an explicit float64 conversion, which stops
+// the compiler from fusing multiply-adds into FMA instructions on arm64,
+// ppc64 and s390x. Together with math.Cos, which is implemented in Go on
+// every port but s390x, this keeps results bit-identical across
+// architectures, including wasm; golden_test.go checks them. On s390x the
+// assembly math.Cos may round the cosine table differently.
+func dct(matrix [][]float64) [][]float64 {
+	N := len(matrix)
+	cosines := cosineTable(N)
+	dct := make([][]float64, N)
+	for u := 0; u < N; u++ {
+		dct[u] = make([]float64, N)
+		for v := 0; v < N; v++ {
+			sum := 0.0
+			for x := 0; x < N; x++ {
+				for y := 0; y < N; y++ {
+					sum += float64(float64(matrix[x][y]*cosines[u][x]) * cosines[v][y])
+				}
+			}
+
+			cu := 1.0
+			cv := 1.0
+			if u == 0 {
+				cu = 1 / math.Sqrt2
+			}
+			if v == 0 {
+				cv = 1 / math.Sqrt2
+			}
+			dct[u][v] = 0.25 * cu * cv * sum
+		}
+	}
+	return dct
+}
+
+// cosineTable returns cos((2x+1)uπ/2N) indexed by [u][x]. The table must not
+// be modified, as it may be shared.
+func cosineTable(N int) [][]float64 {
+	if N == workingSize {
+		return workingCosines()
+	}
+	return newCosineTable(N)
+}
+
+// newCosineTable computes the table returned by cosineTable.
+func newCosineTable(N int) [][]float64 {
+	table := make([][]float64, N)
+	for u := 0; u < N; u++ {
+		table[u] = make([]float64, N)
+		for x := 0; x < N; x++ {
+			table[u][x] = math.Cos((float64(2*x+1) * float64(u) * math.Pi) / (2 * float64(N)))
+		}
+	}
+	return table
+}
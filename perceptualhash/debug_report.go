@@ -0,0 +1,146 @@
+package perceptualhash
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+)
+
+// debugReport collects the intermediate artifacts of a single hash
+// computation for rendering as one self-contained HTML file.
+type debugReport struct {
+	Source       string
+	Original     image.Image
+	Preprocessed *image.Gray
+	DCT          [][]float64
+	Hash         uint64
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Perceptual hash: {{.Source}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+figure { display: inline-block; margin: 0 2em 2em 0; vertical-align: top; }
+figcaption { margin-top: .5em; font-size: .9em; color: #555; }
+.pixelated { width: 256px; height: 256px; image-rendering: pixelated; }
+.original { max-width: 512px; max-height: 512px; }
+code { font-size: 1.4em; }
+</style>
+</head>
+<body>
+<h1>{{.Source}}</h1>
+<p>Hash: <code>{{.Hash}}</code></p>
+<figure><img class="original" src="{{.Original}}"><figcaption>Original</figcaption></figure>
+<figure><img class="pixelated" src="{{.Preprocessed}}"><figcaption>Preprocessed (32x32 grayscale)</figcaption></figure>
+<figure><img class="pixelated" src="{{.Heatmap}}"><figcaption>DCT magnitude (log scale, hashed 8x8 block outlined)</figcaption></figure>
+<figure><img class="pixelated" src="{{.Bits}}"><figcaption>Hash bits (white = 1)</figcaption></figure>
+</body>
+</html>
+`))
+
+// write renders the report to location.
+func (r debugReport) write(location string) error {
+	original, err := dataURI(r.Original)
+	if err != nil {
+		return err
+	}
+	preprocessed, err := dataURI(r.Preprocessed)
+	if err != nil {
+		return err
+	}
+	heatmap, err := dataURI(dctHeatmap(r.DCT))
+	if err != nil {
+		return err
+	}
+	bits, err := dataURI(hashBits(r.Hash))
+	if err != nil {
+		return err
+	}
+
+	outputFile, err := os.OpenFile(location, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	return reportTemplate.Execute(outputFile, map[string]any{
+		"Source":       r.Source,
+		"Hash":         fmt.Sprintf("%016x", r.Hash),
+		"Original":     original,
+		"Preprocessed": preprocessed,
+		"Heatmap":      heatmap,
+		"Bits":         bits,
+	})
+}
+
+// dataURI encodes img as a base64 PNG data URI.
+func dataURI(img image.Image) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// dctHeatmap renders the log magnitude of the DCT coefficients, with the
+// 8x8 block used for the hash outlined in red.
+func dctHeatmap(dctMatrix [][]float64) image.Image {
+	size := len(dctMatrix)
+	var peak float64
+	for _, row := range dctMatrix {
+		for _, value := range row {
+			peak = math.Max(peak, math.Log1p(math.Abs(value)))
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			level := 0.0
+			if peak > 0 {
+				level = math.Log1p(math.Abs(dctMatrix[y][x])) / peak
+			}
+			img.Set(x, y, heatColor(level))
+		}
+	}
+	for i := range 8 {
+		img.Set(i, 8, color.RGBA{255, 0, 0, 255})
+		img.Set(8, i, color.RGBA{255, 0, 0, 255})
+	}
+	return img
+}
+
+// heatColor maps a level in [0, 1] onto a black-red-yellow-white ramp.
+func heatColor(level float64) color.RGBA {
+	v := uint8(math.Round(level * 255))
+	switch {
+	case level < 1.0/3:
+		return color.RGBA{uint8(math.Round(level * 3 * 255)), 0, 0, 255}
+	case level < 2.0/3:
+		return color.RGBA{255, uint8(math.Round((level - 1.0/3) * 3 * 255)), 0, 255}
+	default:
+		return color.RGBA{255, 255, v, 255}
+	}
+}
+
+// hashBits renders the hash as an 8x8 grid, matching visualizeHash.
+func hashBits(hash uint64) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range 8 {
+		for j := range 8 {
+			if (hash>>uint(i*8+j))&1 == 1 {
+				img.SetGray(j, i, color.Gray{255})
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,65 @@
+package perceptualhash
+
+import (
+	"image"
+	"math/bits"
+)
+
+// expandDepth scales 16-bit images whose samples use fewer bits, such as
+// the 10 to 14 bits of medical and scanner outputs stored in 16-bit PNG
+// and TIFF files, to the full 16-bit range. Hashed as stored, they would be
+// dark images left with a few gray levels once converted to 8 bits, and
+// hash unlike their 8-bit exports. Scaling by a power of two never clips,
+// so genuinely dark images only gain precision.
+func expandDepth(img image.Image) image.Image {
+	switch img := img.(type) {
+	case *image.Gray16:
+		expandSamples(img.Pix, img.Rect, img.Stride, 1, 1)
+	case *image.NRGBA64:
+		expandSamples(img.Pix, img.Rect, img.Stride, 4, 3)
+	case *image.RGBA64:
+		// Colors are premultiplied and bounded by alpha, so only opaque
+		// images can be scaled.
+		for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+				if img.RGBA64At(x, y).A != 0xffff {
+					return img
+				}
+			}
+		}
+		expandSamples(img.Pix, img.Rect, img.Stride, 4, 3)
+	}
+	return img
+}
+
+// expandSamples scales the big-endian 16-bit color samples of the pixels in
+// rect in place, so the largest value the bits they use can hold becomes
+// 0xffff. Each pixel has channels samples, the first colors of which are
+// colors.
+func expandSamples(pix []byte, rect image.Rectangle, stride, channels, colors int) {
+	rows := func(fn func(sample []byte)) {
+		for y := range rect.Dy() {
+			row := pix[y*stride:][:2*channels*rect.Dx()]
+			for i := 0; i < len(row); i += 2 * channels {
+				for c := range colors {
+					fn(row[i+2*c:])
+				}
+			}
+		}
+	}
+
+	var largest uint16
+	rows(func(sample []byte) {
+		largest = max(largest, uint16(sample[0])<<8|uint16(sample[1]))
+	})
+	used := bits.Len16(largest)
+	if used == 0 || used == 16 {
+		return
+	}
+
+	top := uint32(1)<<used - 1
+	rows(func(sample []byte) {
+		v := (uint32(sample[0])<<8 | uint32(sample[1])) * 0xffff / top
+		sample[0], sample[1] = byte(v>>8), byte(v)
+	})
+}
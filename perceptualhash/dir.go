@@ -0,0 +1,509 @@
+package perceptualhash
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of hashing one file during a directory walk.
+type Result struct {
+	Path string
+	Hash string
+	Err  error
+	// Timing and Image describe how the file was hashed, as far as it got.
+	// They are left zero by Iter in debug mode, which hashes with FromPath
+	// to write the debug artifacts.
+	Timing Timing
+	Image  ImageInfo
+	// SHA256 is the hex encoded SHA-256 digest of the file, if
+	// Config.Pipeline.Checksum is set and the file could be read.
+	SHA256 string
+}
+
+// Iter walks root and lazily yields the hash of every image file.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.Iter.
+func Iter(ctx context.Context, root string, configs ...Config) iter.Seq[Result] {
+	h, err := newHasher(configs)
+	if err != nil {
+		return failedIter(root, err)
+	}
+	return h.Iter(ctx, root)
+}
+
+// IterFS is like Iter but walks root within fsys.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.IterFS.
+func IterFS(ctx context.Context, fsys fs.FS, root string, configs ...Config) iter.Seq[Result] {
+	h, err := newHasher(configs)
+	if err != nil {
+		return failedIter(root, err)
+	}
+	return h.IterFS(ctx, fsys, root)
+}
+
+// failedIter yields a single result for path carrying err.
+func failedIter(path string, err error) iter.Seq[Result] {
+	return func(yield func(Result) bool) {
+		yield(Result{Path: path, Err: err})
+	}
+}
+
+// Iter walks root and lazily yields the hash of every image file in lexical
+// order. Files are hashed only as the caller consumes results, so breaking
+// out of the loop stops the walk without hashing the rest of the tree.
+// Errors for individual files or directories are reported in Result.Err and
+// the walk continues; if ctx is cancelled a final result carrying ctx.Err()
+// is yielded.
+func (h *DCTHasher) Iter(ctx context.Context, root string) iter.Seq[Result] {
+	return h.iterSource(ctx, osSource(root))
+}
+
+// IterFS is like Iter but walks root within fsys, so embedded files, zip
+// archives and in-memory filesystems can be hashed. Debug artifacts are not
+// written.
+func (h *DCTHasher) IterFS(ctx context.Context, fsys fs.FS, root string) iter.Seq[Result] {
+	return h.iterSource(ctx, fsSource(fsys, root))
+}
+
+func (h *DCTHasher) iterSource(ctx context.Context, src source) iter.Seq[Result] {
+	config := h.config
+	return func(yield func(Result) bool) {
+		src.eachFile(config, func(path string, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				yield(Result{Path: path, Err: ctxErr})
+				return fs.SkipAll
+			}
+			if err != nil {
+				if !yield(Result{Path: path, Err: err}) {
+					return fs.SkipAll
+				}
+				return nil
+			}
+
+			var result Result
+			if config.Debug {
+				hash, err := src.hash(h, path)
+				result = Result{Path: path, Hash: hash, Err: err}
+			} else {
+				result = timedHash(path, src.load, config)
+			}
+			if !yield(result) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+	}
+}
+
+// ImagePaths walks root and lazily yields the path of every file a
+// directory walk with the same configuration would hash.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.ImagePaths.
+func ImagePaths(root string, configs ...Config) iter.Seq2[string, error] {
+	h, err := newHasher(configs)
+	if err != nil {
+		return failedPaths(root, err)
+	}
+	return h.ImagePaths(root)
+}
+
+// ImagePathsFS is like ImagePaths but walks root within fsys.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.ImagePathsFS.
+func ImagePathsFS(fsys fs.FS, root string, configs ...Config) iter.Seq2[string, error] {
+	h, err := newHasher(configs)
+	if err != nil {
+		return failedPaths(root, err)
+	}
+	return h.ImagePathsFS(fsys, root)
+}
+
+// failedPaths yields path with err.
+func failedPaths(path string, err error) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		yield(path, err)
+	}
+}
+
+// ImagePaths walks root and lazily yields the path of every file a
+// directory walk with the same configuration would hash, in lexical order,
+// along with errors for unreadable directories. Breaking out of the loop
+// stops the walk.
+//
+// Files are selected by Config.Walk.Extensions, then Config.Walk.Include and
+// Config.Walk.Exclude, whose patterns follow .gitignore conventions and are
+// matched against the slash-separated path relative to root. A pattern
+// without a slash matches any single path element, so "node_modules" skips
+// that directory at any depth and "*.thumb.jpg" such files anywhere. A
+// pattern with a slash matches the whole relative path, with "**" standing
+// for any number of directories, as in "raw/**" or "**/cache/*.png".
+// Elements use the syntax of path.Match.
+func (h *DCTHasher) ImagePaths(root string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		osSource(root).eachFile(h.config, func(path string, err error) error {
+			if !yield(path, err) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+	}
+}
+
+// ImagePathsFS is like ImagePaths but walks root within fsys.
+func (h *DCTHasher) ImagePathsFS(fsys fs.FS, root string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		fsSource(fsys, root).eachFile(h.config, func(path string, err error) error {
+			if !yield(path, err) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+	}
+}
+
+// HashDirStream walks root and hashes image files concurrently.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.HashDirStream.
+func HashDirStream(ctx context.Context, root string, configs ...Config) (<-chan Result, <-chan error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return failedStream(err)
+	}
+	return h.HashDirStream(ctx, root)
+}
+
+// HashDirStreamFS is like HashDirStream but walks root within fsys.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.HashDirStreamFS.
+func HashDirStreamFS(ctx context.Context, fsys fs.FS, root string, configs ...Config) (<-chan Result, <-chan error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return failedStream(err)
+	}
+	return h.HashDirStreamFS(ctx, fsys, root)
+}
+
+// failedStream returns the closed channels of a walk that failed with err
+// before it started.
+func failedStream(err error) (<-chan Result, <-chan error) {
+	results := make(chan Result)
+	errc := make(chan error, 1)
+	close(results)
+	errc <- err
+	close(errc)
+	return results, errc
+}
+
+// HashDirStream walks root and hashes image files concurrently, sending each
+// result as soon as it is ready so callers can display progress
+// incrementally. Results arrive in no particular order. Per-file errors are
+// reported in Result.Err; the error channel receives at most one error that
+// aborted the whole walk, such as an unreadable root or a cancelled ctx.
+// Both channels are closed when the walk is finished.
+//
+// Files go through separate read, decode and hash stages, sized by
+// Config.Pipeline.Workers, so slow storage can be given more readers to
+// keep the CPU-bound stages fed. Debug artifacts are not written.
+func (h *DCTHasher) HashDirStream(ctx context.Context, root string) (<-chan Result, <-chan error) {
+	return hashDirStream(ctx, osSource(root), h.config)
+}
+
+// HashDirStreamFS is like HashDirStream but walks root within fsys.
+func (h *DCTHasher) HashDirStreamFS(ctx context.Context, fsys fs.FS, root string) (<-chan Result, <-chan error) {
+	return hashDirStream(ctx, fsSource(fsys, root), h.config)
+}
+
+func hashDirStream(ctx context.Context, src source, config Config) (<-chan Result, <-chan error) {
+	workers := func(n int) int {
+		if n <= 0 {
+			return runtime.NumCPU()
+		}
+		return n
+	}
+	results := make(chan Result)
+	errc := make(chan error, 1)
+
+	readWorkers := workers(config.Pipeline.Workers.Read)
+	decodeWorkers := workers(config.Pipeline.Workers.Decode)
+	hashWorkers := workers(config.Pipeline.Workers.Hash)
+
+	paths := make(chan string)
+	// The buffers let readers run ahead while the CPU stages are busy.
+	files := make(chan loadedFile, readWorkers)
+	images := make(chan decodedFile, decodeWorkers)
+
+	send := func(r Result) {
+		select {
+		case results <- r:
+		case <-ctx.Done():
+		}
+	}
+
+	readers := stage(readWorkers, func() {
+		for path := range paths {
+			result := Result{Path: path}
+			start := time.Now()
+			data, release, err := src.load(path, config)
+			result.Timing.Read = time.Since(start)
+			if err != nil {
+				result.Err = err
+				send(result)
+				continue
+			}
+			result.Image.Size = int64(len(data))
+			if config.Pipeline.Checksum {
+				result.SHA256 = checksum(data)
+			}
+
+			var key string
+			if config.Pipeline.Cache != nil {
+				key = CacheKey(data, config)
+				if hash, ok := config.Pipeline.Cache.Get(key); ok {
+					release()
+					result.Hash = hash
+					send(result)
+					continue
+				}
+			}
+			select {
+			case files <- loadedFile{result: result, data: data, release: release, key: key}:
+			case <-ctx.Done():
+				release()
+			}
+		}
+	})
+	go func() {
+		readers.Wait()
+		close(files)
+	}()
+
+	decoders := stage(decodeWorkers, func() {
+		for file := range files {
+			result := file.result
+			start := time.Now()
+			img, format, err := decodeImageData(file.data)
+			result.Timing.Decode = time.Since(start)
+			frames := frameCount(file.data)
+			file.release()
+			if err != nil {
+				result.Err = err
+				send(result)
+				continue
+			}
+			bounds := img.Bounds()
+			result.Image.Format, result.Image.Width, result.Image.Height = format, bounds.Dx(), bounds.Dy()
+			result.Image.Frames = max(frames, 1)
+			select {
+			case images <- decodedFile{result: result, img: img, key: file.key}:
+			case <-ctx.Done():
+			}
+		}
+	})
+	go func() {
+		decoders.Wait()
+		close(images)
+	}()
+
+	hashers := stage(hashWorkers, func() {
+		for file := range images {
+			result := file.result
+			start := time.Now()
+			gray := preprocessImage(file.img, config)
+			result.Timing.Preprocess = time.Since(start)
+
+			start = time.Now()
+			hash, _, err := hashGray(gray, config)
+			result.Timing.Transform = time.Since(start)
+			if err != nil {
+				result.Err = err
+				send(result)
+				continue
+			}
+			result.Hash = fmt.Sprintf("%016x", hash)
+			if config.Pipeline.Cache != nil {
+				config.Pipeline.Cache.Set(file.key, result.Hash)
+			}
+			send(result)
+		}
+	})
+
+	go func() {
+		defer close(errc)
+
+		walkErr := src.eachFile(config, func(path string, err error) error {
+			if err != nil {
+				if path == src.root {
+					return err
+				}
+				select {
+				case results <- Result{Path: path, Err: err}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(paths)
+		// Each stage closes the input of the next once it is drained, so the
+		// hashers finish last.
+		hashers.Wait()
+		close(results)
+
+		if walkErr == nil {
+			// Workers may have dropped results after the walk completed.
+			walkErr = ctx.Err()
+		}
+		if walkErr != nil {
+			errc <- walkErr
+		}
+	}()
+
+	return results, errc
+}
+
+// source is a file tree walked by Iter and HashDirStream and their FS
+// variants.
+type source struct {
+	root     string
+	walk     func(fn fs.WalkDirFunc) error
+	rel      func(path string) string
+	stat     func(path string) (fs.FileInfo, error)
+	readDir  func(path string) ([]fs.DirEntry, error)
+	join     func(elem ...string) string
+	identify func(path string) (fileKey, error)
+	// load reads a file; release must be called once its contents are no
+	// longer used.
+	load func(path string, config Config) (data []byte, release func(), err error)
+	hash func(h *DCTHasher, path string) (string, error)
+}
+
+// osSource walks root in the OS filesystem.
+func osSource(root string) source {
+	return source{
+		root: root,
+		walk: func(fn fs.WalkDirFunc) error {
+			return filepath.WalkDir(root, fn)
+		},
+		rel: func(path string) string {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return filepath.ToSlash(path)
+			}
+			return filepath.ToSlash(rel)
+		},
+		stat:    os.Stat,
+		readDir: os.ReadDir,
+		join:    filepath.Join,
+		identify: func(path string) (fileKey, error) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return fileKey{}, err
+			}
+			if key, ok := fileID(info); ok {
+				return key, nil
+			}
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return fileKey{}, err
+			}
+			resolved, err = filepath.Abs(resolved)
+			return fileKey{path: resolved}, err
+		},
+		load: readFile,
+		hash: (*DCTHasher).FromPath,
+	}
+}
+
+// fsSource walks root within fsys.
+func fsSource(fsys fs.FS, root string) source {
+	return source{
+		root: root,
+		walk: func(fn fs.WalkDirFunc) error {
+			return fs.WalkDir(fsys, root, fn)
+		},
+		rel: func(path string) string {
+			if root == "." || path == root {
+				return path
+			}
+			return strings.TrimPrefix(path, root+"/")
+		},
+		stat: func(name string) (fs.FileInfo, error) {
+			return fs.Stat(fsys, name)
+		},
+		readDir: func(name string) ([]fs.DirEntry, error) {
+			return fs.ReadDir(fsys, name)
+		},
+		join: path.Join,
+		identify: func(name string) (fileKey, error) {
+			info, err := fs.Stat(fsys, name)
+			if err != nil {
+				return fileKey{}, err
+			}
+			if key, ok := fileID(info); ok {
+				return key, nil
+			}
+			return fileKey{path: name}, nil
+		},
+		load: func(path string, _ Config) ([]byte, func(), error) {
+			data, err := fs.ReadFile(fsys, path)
+			return data, func() {}, err
+		},
+		hash: func(h *DCTHasher, path string) (string, error) {
+			return h.FromFS(fsys, path)
+		},
+	}
+}
+
+// loadedFile is a file read by the first stage of HashDirStream.
+type loadedFile struct {
+	// result is filled in as the file goes through the stages.
+	result  Result
+	data    []byte
+	release func()
+	// key is the cache key of data, if Config.Pipeline.Cache is set.
+	key string
+}
+
+// decodedFile is an image decoded by the second stage of HashDirStream.
+type decodedFile struct {
+	result Result
+	img    image.Image
+	key    string
+}
+
+// stage starts n goroutines running fn.
+func stage(n int, fn func()) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+	return &wg
+}
@@ -0,0 +1,111 @@
+package perceptualhash
+
+import (
+	"math/bits"
+	"runtime"
+	"sync"
+)
+
+// DistanceMany returns the Hamming distance between query and each of the
+// candidates, in order. It is meant for brute-force scans when no index is
+// used: the loop is a plain XOR and popcount over a contiguous slice, which
+// the compiler turns into POPCNT instructions where available.
+func DistanceMany(query Hash, candidates []Hash) []int {
+	distances := make([]int, len(candidates))
+
+	// Unrolled by four so the popcounts of independent hashes overlap.
+	i := 0
+	for ; i+4 <= len(candidates); i += 4 {
+		c := candidates[i : i+4 : i+4]
+		distances[i] = bits.OnesCount64(uint64(query ^ c[0]))
+		distances[i+1] = bits.OnesCount64(uint64(query ^ c[1]))
+		distances[i+2] = bits.OnesCount64(uint64(query ^ c[2]))
+		distances[i+3] = bits.OnesCount64(uint64(query ^ c[3]))
+	}
+	for ; i < len(candidates); i++ {
+		distances[i] = bits.OnesCount64(uint64(query ^ candidates[i]))
+	}
+	return distances
+}
+
+// distanceTile is the number of hashes per side of the blocks the distance
+// matrices are computed in, so the hashes of a block stay in the L1 cache.
+const distanceTile = 256
+
+// DistanceMatrix returns the Hamming distances between all pairs of hashes,
+// with matrix[i][j] holding the distance between hashes[i] and hashes[j].
+// Blocks of the matrix are computed in parallel on all CPUs. The matrix
+// takes n² ints, so for large catalogs see CondensedDistanceMatrix.
+func DistanceMatrix(hashes []Hash) [][]int {
+	n := len(hashes)
+	backing := make([]int, n*n)
+	matrix := make([][]int, n)
+	for i := range matrix {
+		matrix[i] = backing[i*n : (i+1)*n : (i+1)*n]
+	}
+
+	forEachPairTile(hashes, func(i, j int, others []Hash) {
+		row := matrix[i]
+		for k, other := range others {
+			d := bits.OnesCount64(uint64(hashes[i] ^ other))
+			row[j+k] = d
+			matrix[j+k][i] = d
+		}
+	})
+	return matrix
+}
+
+// CondensedDistanceMatrix returns the Hamming distances between all pairs
+// of hashes i < j as a flat slice holding the upper triangle row by row,
+// the layout of SciPy's pdist: the distance between hashes[i] and hashes[j]
+// is at index n*i - i*(i+1)/2 + j - i - 1. At one byte per pair it takes
+// about n²/2 bytes, 5 GB for 100,000 hashes. Blocks are computed in
+// parallel on all CPUs.
+func CondensedDistanceMatrix(hashes []Hash) []uint8 {
+	n := len(hashes)
+	condensed := make([]uint8, n*(n-1)/2)
+
+	forEachPairTile(hashes, func(i, j int, others []Hash) {
+		row := condensed[n*i-i*(i+1)/2+j-i-1:][:len(others)]
+		for k, other := range others {
+			row[k] = uint8(bits.OnesCount64(uint64(hashes[i] ^ other)))
+		}
+	})
+	return condensed
+}
+
+// forEachPairTile splits the pairs i < j of hashes into square tiles of the
+// upper triangle, processed concurrently. For each row i of a tile, fn
+// receives others, the hashes of the tile's columns from j on.
+func forEachPairTile(hashes []Hash, fn func(i, j int, others []Hash)) {
+	n := len(hashes)
+	tiles := (n + distanceTile - 1) / distanceTile
+
+	type tile struct{ row, col int }
+	jobs := make(chan tile)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), tiles*(tiles+1)/2) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				rowEnd := min(t.row+distanceTile, n)
+				colEnd := min(t.col+distanceTile, n)
+				for i := t.row; i < rowEnd; i++ {
+					j := max(t.col, i+1)
+					if j < colEnd {
+						fn(i, j, hashes[j:colEnd])
+					}
+				}
+			}
+		}()
+	}
+
+	for row := 0; row < n; row += distanceTile {
+		for col := row; col < n; col += distanceTile {
+			jobs <- tile{row, col}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
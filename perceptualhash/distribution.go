@@ -0,0 +1,154 @@
+package perceptualhash
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// AnalyzeConfig holds options for AnalyzeDistances.
+type AnalyzeConfig struct {
+	// Samples is the number of hashes compared against the whole catalog.
+	// All hashes are used if there are fewer.
+	Samples int
+	// Seed seeds the choice of samples, so reports are reproducible.
+	Seed uint64
+}
+
+var defaultAnalyzeConfig = AnalyzeConfig{
+	Samples: 1000,
+}
+
+// DistanceReport describes the distribution of distances in a catalog of
+// hashes, for choosing a threshold suited to the data.
+type DistanceReport struct {
+	// Pairs[d] counts the sampled pairs of hashes at distance d.
+	Pairs [65]int
+	// Nearest[d] counts the sampled hashes whose closest other hash is at
+	// distance d. Duplicates form a mode at low distances, separated from
+	// unique images by a gap.
+	Nearest [65]int
+	// Thresholds lists suggested thresholds at the gaps of Nearest, most
+	// pronounced first. It is empty if the distribution has no gap, e.g.
+	// in a catalog without duplicates.
+	Thresholds []int
+}
+
+// AnalyzeDistances compares a random sample of hashes against all others
+// and reports the distribution of their distances, with suggested
+// thresholds at its natural gaps.
+// It optionally accepts a custom configuration.
+func AnalyzeDistances(hashes []Hash, configs ...AnalyzeConfig) DistanceReport {
+	config := defaultAnalyzeConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	samples := make([]int, len(hashes))
+	for i := range samples {
+		samples[i] = i
+	}
+	if config.Samples > 0 && config.Samples < len(hashes) {
+		rng := rand.New(rand.NewPCG(config.Seed, config.Seed))
+		rng.Shuffle(len(samples), func(i, j int) {
+			samples[i], samples[j] = samples[j], samples[i]
+		})
+		samples = samples[:config.Samples]
+	}
+
+	var report DistanceReport
+	for _, i := range samples {
+		nearest := -1
+		for j, d := range DistanceMany(hashes[i], hashes) {
+			if j == i {
+				continue
+			}
+			report.Pairs[d]++
+			if nearest < 0 || d < nearest {
+				nearest = d
+			}
+		}
+		if nearest >= 0 {
+			report.Nearest[nearest]++
+		}
+	}
+	report.Thresholds = gaps(report.Nearest[:])
+	return report
+}
+
+// Percentile returns the smallest distance d such that a fraction p of the
+// sampled pairs are at most d apart. As most pairs are unrelated images, a
+// threshold below Percentile(0.001) keeps false matches under about 0.1%.
+func (r DistanceReport) Percentile(p float64) int {
+	var total int
+	for _, count := range r.Pairs {
+		total += count
+	}
+
+	var cumulative int
+	for d, count := range r.Pairs {
+		cumulative += count
+		if float64(cumulative) >= p*float64(total) {
+			return d
+		}
+	}
+	return len(r.Pairs) - 1
+}
+
+// maxThresholds is the number of gaps suggested by AnalyzeDistances.
+const maxThresholds = 3
+
+// gaps returns the centers of the valleys of a histogram that lie between
+// two modes, deepest first. The histogram is smoothed over three
+// bins to ignore sampling noise.
+func gaps(histogram []int) []int {
+	smoothed := make([]float64, len(histogram))
+	for d := range histogram {
+		var sum float64
+		var n int
+		for k := max(d-1, 0); k <= min(d+1, len(histogram)-1); k++ {
+			sum += float64(histogram[k])
+			n++
+		}
+		smoothed[d] = sum / float64(n)
+	}
+
+	type gap struct {
+		center     int
+		prominence float64
+	}
+	var found []gap
+	for start := 1; start < len(smoothed)-1; {
+		// Find a run of equal values lower than both of its neighbors.
+		end := start
+		for end+1 < len(smoothed) && smoothed[end+1] == smoothed[start] {
+			end++
+		}
+		if end+1 >= len(smoothed) || smoothed[start-1] <= smoothed[start] || smoothed[end+1] <= smoothed[start] {
+			start = end + 1
+			continue
+		}
+
+		// Valleys less than half as deep as the lower of the surrounding
+		// peaks are noise rather than gaps.
+		peak := min(slices.Max(smoothed[:start]), slices.Max(smoothed[end+1:]))
+		if smoothed[start] <= peak/2 {
+			found = append(found, gap{center: (start + end) / 2, prominence: peak - smoothed[start]})
+		}
+		start = end + 1
+	}
+
+	slices.SortStableFunc(found, func(a, b gap) int {
+		switch {
+		case a.prominence > b.prominence:
+			return -1
+		case a.prominence < b.prominence:
+			return 1
+		}
+		return 0
+	})
+	var thresholds []int
+	for _, g := range found[:min(len(found), maxThresholds)] {
+		thresholds = append(thresholds, g.center)
+	}
+	return thresholds
+}
@@ -0,0 +1,88 @@
+package perceptualhash
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// BitDiff describes one differing bit between two hashes in terms of the
+// DCT coefficient it was derived from.
+type BitDiff struct {
+	// Bit is the bit position within the hash.
+	Bit int
+	// Horizontal and Vertical are the frequency indices of the coefficient,
+	// i.e. the number of sign changes of its basis pattern across the image
+	// width and height.
+	Horizontal int
+	Vertical   int
+	// Set reports whether the bit is set in the first hash.
+	Set bool
+}
+
+// Columns returns the number of alternating cells the coefficient compares
+// across the image width, approximating the spatial region it measures.
+func (d BitDiff) Columns() int {
+	return d.Horizontal + 1
+}
+
+// Rows returns the number of alternating cells the coefficient compares
+// across the image height.
+func (d BitDiff) Rows() int {
+	return d.Vertical + 1
+}
+
+// String returns a short human-readable explanation of the difference.
+func (d BitDiff) String() string {
+	var pattern string
+	switch {
+	case d.Horizontal == 0 && d.Vertical == 0:
+		pattern = "overall brightness"
+	case d.Vertical == 0 && d.Horizontal == 1:
+		pattern = "left versus right brightness"
+	case d.Horizontal == 0 && d.Vertical == 1:
+		pattern = "top versus bottom brightness"
+	case d.Vertical == 0:
+		pattern = fmt.Sprintf("brightness alternating across %d vertical bands", d.Columns())
+	case d.Horizontal == 0:
+		pattern = fmt.Sprintf("brightness alternating across %d horizontal bands", d.Rows())
+	default:
+		pattern = fmt.Sprintf("checkerboard of %dx%d cells", d.Columns(), d.Rows())
+	}
+	return fmt.Sprintf("bit %d (frequency %d,%d): %s", d.Bit, d.Horizontal, d.Vertical, pattern)
+}
+
+// Explain maps each bit that differs between h1 and h2 back to the DCT
+// coefficient it encodes.
+// It optionally accepts the configuration the hashes were computed with.
+//
+// Deprecated: Use New and DCTHasher.Explain.
+func Explain(h1, h2 Hash, configs ...Config) []BitDiff {
+	h := &DCTHasher{}
+	if len(configs) > 0 {
+		h.config = configs[0]
+	}
+	return h.Explain(h1, h2)
+}
+
+// Explain maps each bit that differs between h1 and h2, computed by h, back
+// to the DCT coefficient it encodes, ordered from lowest to highest bit.
+func (h *DCTHasher) Explain(h1, h2 Hash) []BitDiff {
+	selected, _ := hashedCoefficients(h.config)
+	diff := uint64(h1 ^ h2)
+	diffs := make([]BitDiff, 0, bits.OnesCount64(diff))
+	for diff != 0 {
+		bit := bits.TrailingZeros64(diff)
+		diff &= diff - 1
+
+		if bit >= len(selected) {
+			continue
+		}
+		diffs = append(diffs, BitDiff{
+			Bit:        bit,
+			Horizontal: selected[bit].col,
+			Vertical:   selected[bit].row,
+			Set:        uint64(h1)>>bit&1 == 1,
+		})
+	}
+	return diffs
+}
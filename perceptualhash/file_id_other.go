@@ -0,0 +1,10 @@
+//go:build !unix
+
+package perceptualhash
+
+import "io/fs"
+
+// fileID reports that device and inode numbers are unavailable.
+func fileID(fs.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package perceptualhash
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID returns the device and inode of the file described by info.
+func fileID(info fs.FileInfo) (fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
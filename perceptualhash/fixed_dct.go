@@ -0,0 +1,107 @@
+package perceptualhash
+
+import "image"
+
+// fixedBits is the number of fractional bits of fixed-point values.
+const fixedBits = 14
+
+// fixedBlock is the smallest width and height of the coefficient block
+// computed by the fixed-point DCT: the default 8x8 hashed block plus the row
+// and column after it, which DCExcluded draws from.
+const fixedBlock = 9
+
+// fixedCosines holds round(cos(kπ/64) * 2^14) for k in [0, 128), so that
+// cos((2x+1)uπ/64) is fixedCosines[(2x+1)u mod 128]. It is spelled out
+// rather than computed so no floating-point math is involved at all.
+var fixedCosines = [128]int64{
+	16384, 16364, 16305, 16207, 16069, 15893, 15679, 15426,
+	15137, 14811, 14449, 14053, 13623, 13160, 12665, 12140,
+	11585, 11003, 10394, 9760, 9102, 8423, 7723, 7005,
+	6270, 5520, 4756, 3981, 3196, 2404, 1606, 804,
+	0, -804, -1606, -2404, -3196, -3981, -4756, -5520,
+	-6270, -7005, -7723, -8423, -9102, -9760, -10394, -11003,
+	-11585, -12140, -12665, -13160, -13623, -14053, -14449, -14811,
+	-15137, -15426, -15679, -15893, -16069, -16207, -16305, -16364,
+	-16384, -16364, -16305, -16207, -16069, -15893, -15679, -15426,
+	-15137, -14811, -14449, -14053, -13623, -13160, -12665, -12140,
+	-11585, -11003, -10394, -9760, -9102, -8423, -7723, -7005,
+	-6270, -5520, -4756, -3981, -3196, -2404, -1606, -804,
+	0, 804, 1606, 2404, 3196, 3981, 4756, 5520,
+	6270, 7005, 7723, 8423, 9102, 9760, 10394, 11003,
+	11585, 12140, 12665, 13160, 13623, 14053, 14449, 14811,
+	15137, 15426, 15679, 15893, 16069, 16207, 16305, 16364,
+}
+
+// fixedDCT computes the lowest size x size DCT coefficients of a 32x32
+// grayscale image using integer arithmetic only, as a separable transform:
+// first over the columns of every row, then over the rows. The coefficients
+// carry fixedBits fractional bits and omit the constant 1/4 factor, which
+// does not affect the hash.
+func fixedDCT(img *image.Gray, size int) [][]int64 {
+	rows := make([][]int64, workingSize)
+	for x := range workingSize {
+		rows[x] = make([]int64, size)
+		row := img.Pix[img.PixOffset(0, x):][:workingSize]
+		for v := range size {
+			var sum int64
+			for y, value := range row {
+				sum += int64(value) * fixedCosines[(2*y+1)*v%128]
+			}
+			rows[x][v] = sum
+		}
+	}
+
+	// 1/√2 in fixed point, the normalization of the first row and column.
+	const invSqrt2 = 11585
+
+	coefficients := make([][]int64, size)
+	for u := range size {
+		coefficients[u] = make([]int64, size)
+		for v := range size {
+			var sum int64
+			for x := range workingSize {
+				sum += fixedCosines[(2*x+1)*u%128] * rows[x][v]
+			}
+			sum >>= fixedBits
+			if u == 0 {
+				sum = sum * invSqrt2 >> fixedBits
+			}
+			if v == 0 {
+				sum = sum * invSqrt2 >> fixedBits
+			}
+			coefficients[u][v] = sum
+		}
+	}
+	return coefficients
+}
+
+// generateFixedHash is generateHash for fixed-point coefficients. It
+// compares each value against the average without dividing, so the hash
+// is exact on every platform.
+func generateFixedHash(coefficients [][]int64, config Config) uint64 {
+	selected, reserved := hashedCoefficients(config)
+	values := make([]int64, len(selected))
+	for i, c := range selected {
+		values[i] = coefficients[c.row][c.col]
+	}
+
+	skip := 0
+	if reserved {
+		skip = 1
+	}
+
+	var sum int64
+	for i := skip; i < len(values); i++ {
+		sum += values[i]
+	}
+	count := int64(len(values) - skip)
+
+	var hash uint64
+	for i, value := range values {
+		// value > sum/count, without rounding.
+		if i >= skip && value*count > sum {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
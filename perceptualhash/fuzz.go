@@ -0,0 +1,60 @@
+package perceptualhash
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+// maxFuzzPixels bounds the images decoded by FuzzDecodeAndHash, so inputs
+// claiming huge dimensions do not exhaust memory.
+const maxFuzzPixels = 1 << 22
+
+// fuzzConfigs together enable every preprocessing and transform option.
+var fuzzConfigs = []Config{
+	{},
+	{DCMode: DCExcluded, Transform: FixedPointDCT},
+	{Watermark: WatermarkMask, SuppressText: true, CenterWeight: 0.8},
+	{Watermark: WatermarkCenterCrop, SmartCrop: true},
+	{Coefficients: image.Rect(1, 1, 9, 9), Transform: FixedPointDCT},
+	{Coefficients: image.Rect(0, 0, 16, 4), DCMode: DCExcluded},
+	{Order: ZigzagOrder, DCMode: DCExcluded, Transform: FixedPointDCT},
+}
+
+// FuzzDecodeAndHash decodes data and hashes it under every configuration
+// variant, as a fuzz target for testing.F or go-fuzz. Malformed input must
+// only produce errors, so any panic is a bug that would crash batch jobs.
+// Following the go-fuzz convention, it returns 1 for inputs that were
+// hashed, 0 for rejected ones and -1 for inputs too large to try.
+func FuzzDecodeAndHash(data []byte) int {
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	if int64(imageConfig.Width)*int64(imageConfig.Height) > maxFuzzPixels {
+		return -1
+	}
+
+	img, _, err := decodeImageData(data)
+	if err != nil {
+		return 0
+	}
+
+	for _, config := range fuzzConfigs {
+		h, err := New(WithConfig(config))
+		if err != nil {
+			panic(fmt.Sprintf("fuzz configuration is invalid: %v", err))
+		}
+		hash, err := h.Hash(img)
+		if err != nil {
+			continue
+		}
+		if parsed, err := ParseHash(hash.String()); err != nil || parsed != hash {
+			panic(fmt.Sprintf("hash %q does not round-trip through ParseHash", hash))
+		}
+	}
+	ColorHash(img)
+	ChromaHash(img)
+	new(DCTHasher).FramesFromReader(bytes.NewReader(data))
+	return 1
+}
@@ -0,0 +1,127 @@
+package perceptualhash_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// seedImages returns small encoded images as a seed corpus, with truncated
+// copies to start the fuzzer inside the decoders.
+func seedImages(t testing.TB) [][]byte {
+	img := image.NewRGBA(image.Rect(0, 0, 48, 40))
+	for y := range 40 {
+		for x := range 48 {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 5), uint8(y * 6), uint8(x ^ y), 255})
+		}
+	}
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return [][]byte{
+		pngData.Bytes(),
+		jpegData.Bytes(),
+		pngData.Bytes()[:pngData.Len()/2],
+		jpegData.Bytes()[:jpegData.Len()/2],
+		[]byte("II*\x00\x08\x00\x00\x00\x00\x00"),
+	}
+}
+
+func FuzzDecodeAndHash(f *testing.F) {
+	for _, seed := range seedImages(f) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		perceptualhash.FuzzDecodeAndHash(data)
+	})
+}
+
+func FuzzParseHash(f *testing.F) {
+	for _, seed := range []string{"2d52af2450a2552a", "0", "ffffffffffffffff", "-1", "0x10", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		h, err := perceptualhash.ParseHash(s)
+		if err != nil {
+			return
+		}
+		if again, err := perceptualhash.ParseHash(h.String()); err != nil || again != h {
+			t.Errorf("hash %q does not round-trip: %v, %v", s, again, err)
+		}
+	})
+}
+
+// apngSeed builds an animated PNG repeating the image data of a still PNG
+// for every frame, with the dimensions in its IHDR chunk replaced by width
+// and height if they are not zero.
+func apngSeed(t testing.TB, still []byte, frames int, width, height uint32) []byte {
+	var header, data []byte
+	rest := still[8:]
+	for len(rest) >= 12 {
+		length := binary.BigEndian.Uint32(rest)
+		body := rest[8 : 8+length]
+		switch string(rest[4:8]) {
+		case "IHDR":
+			header = bytes.Clone(body)
+		case "IDAT":
+			data = append(data, body...)
+		}
+		rest = rest[12+length:]
+	}
+	if header == nil {
+		t.Fatal("seed PNG has no IHDR chunk")
+	}
+	if width != 0 {
+		binary.BigEndian.PutUint32(header[0:4], width)
+		binary.BigEndian.PutUint32(header[4:8], height)
+	}
+
+	out := []byte("\x89PNG\r\n\x1a\n")
+	appendChunk := func(kind string, body []byte) {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(body)))
+		out = append(out, kind...)
+		out = append(out, body...)
+		out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[len(out)-len(body)-4:]))
+	}
+	appendChunk("IHDR", header)
+	appendChunk("acTL", binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(frames)), 0))
+	var sequence uint32
+	for i := range frames {
+		control := binary.BigEndian.AppendUint32(nil, sequence)
+		control = append(control, header[0:8]...)
+		control = append(control, make([]byte, 8)...)
+		control = append(control, 0, 1, 0, 10, 0, 0)
+		appendChunk("fcTL", control)
+		sequence++
+		if i == 0 {
+			appendChunk("IDAT", data)
+			continue
+		}
+		appendChunk("fdAT", append(binary.BigEndian.AppendUint32(nil, sequence), data...))
+		sequence++
+	}
+	appendChunk("IEND", nil)
+	return out
+}
+
+func FuzzFramesFromReader(f *testing.F) {
+	still := seedImages(f)[0]
+	f.Add(apngSeed(f, still, 2, 0, 0))
+	// Forged dimensions once made the canvas allocation panic.
+	f.Add(apngSeed(f, still, 2, 0x7fffffff, 0x7fffffff))
+	f.Add(apngSeed(f, still, 2, 0xffffffff, 1))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		new(perceptualhash.DCTHasher).FramesFromReader(bytes.NewReader(data))
+	})
+}
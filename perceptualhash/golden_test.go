@@ -0,0 +1,111 @@
+package perceptualhash_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// fixtures are synthetic images drawn with integer arithmetic only, so they
+// are identical on every architecture and need no files, which keeps the
+// test runnable under GOOS=js GOARCH=wasm.
+var fixtures = []struct {
+	name  string
+	pixel func(x, y int) color.RGBA
+}{
+	{"horizontal gradient", func(x, y int) color.RGBA {
+		return gray(x * 2)
+	}},
+	{"vertical gradient", func(x, y int) color.RGBA {
+		return gray(255 - y*2)
+	}},
+	{"diagonal color", func(x, y int) color.RGBA {
+		return color.RGBA{uint8(x * 2), uint8(y * 2), uint8((x + y) % 256), 255}
+	}},
+	{"checkerboard", func(x, y int) color.RGBA {
+		return gray(255 * ((x/16 + y/16) % 2))
+	}},
+	{"rings", func(x, y int) color.RGBA {
+		dx, dy := x-64, y-48
+		return gray((dx*dx + dy*dy) / 8 % 256)
+	}},
+	{"disk", func(x, y int) color.RGBA {
+		dx, dy := x-40, y-60
+		if dx*dx+dy*dy < 900 {
+			return gray(230)
+		}
+		return gray(30)
+	}},
+	{"stripes", func(x, y int) color.RGBA {
+		return gray(128 + 100*((x+2*y)/12%2) - 50*(y/48))
+	}},
+	{"noise", func(x, y int) color.RGBA {
+		// A linear congruential generator over the block coordinates.
+		seed := uint32((x/8)*7919 + (y/8)*104729)
+		seed = seed*1664525 + 1013904223
+		return gray(int(seed >> 24))
+	}},
+}
+
+func gray(v int) color.RGBA {
+	return color.RGBA{uint8(v), uint8(v), uint8(v), 255}
+}
+
+func fixture(pixel func(x, y int) color.RGBA) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 128, 96))
+	for y := range 96 {
+		for x := range 128 {
+			img.SetRGBA(x, y, pixel(x, y))
+		}
+	}
+	return img
+}
+
+// golden holds the hashes of the fixtures, which must not change across
+// releases or architectures.
+var golden = map[perceptualhash.Transform]map[string]string{
+	perceptualhash.FloatDCT: {
+		"horizontal gradient": "ffffffffffffff54",
+		"vertical gradient":   "0100010001000100",
+		"diagonal color":      "fffffefffefffef4",
+		"checkerboard":        "ffff55ff55ff55fe",
+		"rings":               "4484449e041b0444",
+		"disk":                "fffce3ff13fcfc22",
+		"stripes":             "8000010000000100",
+		"noise":               "28c5684f796f394c",
+	},
+	perceptualhash.FixedPointDCT: {
+		"horizontal gradient": "ffffffffffffff54",
+		"vertical gradient":   "0100010001000100",
+		"diagonal color":      "fffffefffefffef4",
+		"checkerboard":        "ffff55ff55ff55fe",
+		"rings":               "4484449e041b0444",
+		"disk":                "fffce3ff13fcfc22",
+		"stripes":             "8000010000000100",
+		"noise":               "28c5684f796f394c",
+	},
+}
+
+// TestGoldenHashes checks the fixture hashes for both transforms. Run it on
+// other architectures with GOARCH=arm64 go test under qemu, or with
+// GOOS=js GOARCH=wasm go test -exec="$(go env GOROOT)/lib/wasm/go_js_wasm_exec".
+func TestGoldenHashes(t *testing.T) {
+	for transform, hashes := range golden {
+		h, err := perceptualhash.New(perceptualhash.WithTransform(transform))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range fixtures {
+			got, err := h.Hash(fixture(f.pixel))
+			if err != nil {
+				t.Errorf("transform %d, %s: %v", transform, f.name, err)
+				continue
+			}
+			if want := hashes[f.name]; got.String() != want {
+				t.Errorf("transform %d, %s: hash %s, want %s", transform, f.name, got, want)
+			}
+		}
+	}
+}
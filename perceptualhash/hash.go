@@ -0,0 +1,34 @@
+package perceptualhash
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// Hash is a 64-bit perceptual hash. Bit i holds whether DCT coefficient i of
+// the hashed block, by default the 8x8 lowest frequencies, in row-major
+// order, is above the average; see DCMode for the meaning of bit 0.
+type Hash uint64
+
+// ParseHash parses the hexadecimal form returned by FromPath.
+func ParseHash(s string) (Hash, error) {
+	value, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash %q: %w", s, err)
+	}
+	return Hash(value), nil
+}
+
+// String returns the hash as 16 hexadecimal digits.
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Distance returns the number of differing bits between h and other.
+//
+// Unlike CompareHashes, which counts differing hexadecimal digits, this is
+// the true Hamming distance, ranging from 0 to 64.
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
@@ -0,0 +1,50 @@
+package perceptualhash
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+)
+
+// Value implements driver.Valuer, storing the hash as a 64-bit integer with
+// the same bits. SQL integers are signed, so hashes with the top bit set are
+// stored as negative numbers, but bitwise operators such as
+// bit_count(a # b) in PostgreSQL or BIT_COUNT(a ^ b) in MySQL still compute
+// the Hamming distance.
+//
+// Together with Scan and GormDataType, this lets ORMs map Hash fields
+// without conversion code: GORM needs no serializer tag, and ent fields can
+// be declared as field.Uint64("phash").GoType(perceptualhash.Hash(0)).
+func (h Hash) Value() (driver.Value, error) {
+	return int64(h), nil
+}
+
+// Scan implements sql.Scanner. It accepts integers as stored by Value,
+// including the decimal text some drivers return for integer columns.
+func (h *Hash) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case int64:
+		*h = Hash(v)
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("cannot scan %T into Hash", src)
+	}
+
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid hash %q: %w", text, err)
+	}
+	*h = Hash(value)
+	return nil
+}
+
+// GormDataType tells GORM to create a 64-bit integer column for Hash
+// fields.
+func (Hash) GormDataType() string {
+	return "int"
+}
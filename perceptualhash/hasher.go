@@ -0,0 +1,254 @@
+package perceptualhash
+
+import (
+	"errors"
+	"image"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Hasher is an image hashing algorithm. Implementations are safe for
+// concurrent use.
+type Hasher interface {
+	// Hash computes the hash of img.
+	Hash(img image.Image) (Hash, error)
+	// Name identifies the algorithm in the registry, e.g. "phash".
+	Name() string
+	// Bits is the number of meaningful low bits of the hashes, bounding
+	// their Hamming distances.
+	Bits() int
+}
+
+var ErrUnknownHasher = errors.New("hash algorithm is not registered")
+
+var (
+	hashersMu sync.RWMutex
+	hashers   = map[string]Hasher{
+		"phash":      &DCTHasher{},
+		"colorhash":  colorHasher{},
+		"chromahash": chromaHasher{},
+		"ahash":      averageHasher{},
+		"dhash":      differenceHasher{},
+	}
+)
+
+// Register adds or replaces the hasher for h.Name(), so it can be selected
+// by name with Lookup.
+func Register(h Hasher) {
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+
+	hashers[h.Name()] = h
+}
+
+// Lookup returns the hasher registered under name. Built in are "phash",
+// the DCT hash with the default configuration, the color signatures
+// "colorhash" and "chromahash", and the cheap "ahash" and "dhash".
+func Lookup(name string) (Hasher, error) {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+
+	h, ok := hashers[name]
+	if !ok {
+		return nil, ErrUnknownHasher
+	}
+	return h, nil
+}
+
+// Hashers returns the names of all registered hashers, sorted.
+func Hashers() []string {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+
+	names := make([]string, 0, len(hashers))
+	for name := range hashers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Backend describes the JPEG decoder compiled in: pure Go by default, or
+// libjpeg-turbo through cgo with the phash_cgo build tag, followed by the
+// accelerator installed with SetAccelerator, if any.
+func Backend() string {
+	acceleratorMu.RLock()
+	defer acceleratorMu.RUnlock()
+
+	if accelerator != nil {
+		return backend + ", accelerated by " + accelerator.Name()
+	}
+	return backend
+}
+
+// DCTHasher is the DCT-based perceptual hash, as a Hasher with a fixed
+// configuration. Its methods hash files, readers, directory trees and
+// archives with that configuration, which New validates once, up front, and
+// reuse scratch buffers across calls. It is safe for concurrent use. The
+// zero value hashes with the default configuration.
+type DCTHasher struct {
+	config Config
+	pixels *sync.Pool
+}
+
+// Option configures a DCTHasher created by New, or CompareFiles.
+type Option func(*options)
+
+// options holds what Options set: a configuration, and the threshold of
+// CompareFiles.
+type options struct {
+	Config
+	threshold int
+}
+
+// applyOptions applies opts in order on top of the defaults.
+func applyOptions(opts []Option) options {
+	o := options{Config: defaultConfig, threshold: DefaultThreshold}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithConfig replaces the whole configuration.
+func WithConfig(config Config) Option {
+	return func(o *options) { o.Config = config }
+}
+
+// WithDCMode sets Config.DCMode.
+func WithDCMode(mode DCMode) Option {
+	return func(o *options) { o.DCMode = mode }
+}
+
+// WithCoefficients sets Config.Coefficients.
+func WithCoefficients(region image.Rectangle) Option {
+	return func(o *options) { o.Coefficients = region }
+}
+
+// WithOrder sets Config.Order.
+func WithOrder(order CoefficientOrder) Option {
+	return func(o *options) { o.Order = order }
+}
+
+// WithTransform sets Config.Transform.
+func WithTransform(transform Transform) Option {
+	return func(o *options) { o.Transform = transform }
+}
+
+// WithWatermark sets Config.Watermark.
+func WithWatermark(mode WatermarkMode) Option {
+	return func(o *options) { o.Watermark = mode }
+}
+
+// WithSuppressText enables Config.SuppressText.
+func WithSuppressText() Option {
+	return func(o *options) { o.SuppressText = true }
+}
+
+// WithSmartCrop enables Config.SmartCrop.
+func WithSmartCrop() Option {
+	return func(o *options) { o.SmartCrop = true }
+}
+
+// WithCenterWeight sets Config.CenterWeight.
+func WithCenterWeight(strength float64) Option {
+	return func(o *options) { o.CenterWeight = strength }
+}
+
+// WithWalk sets Config.Walk.
+func WithWalk(walk WalkConfig) Option {
+	return func(o *options) { o.Walk = walk }
+}
+
+// WithPipeline sets Config.Pipeline.
+func WithPipeline(pipeline PipelineConfig) Option {
+	return func(o *options) { o.Pipeline = pipeline }
+}
+
+// WithChecksum enables Config.Pipeline.Checksum.
+func WithChecksum() Option {
+	return func(o *options) { o.Pipeline.Checksum = true }
+}
+
+// WithThreshold sets the largest distance CompareFiles reports as similar,
+// DefaultThreshold by default. It does not apply to New.
+func WithThreshold(bits int) Option {
+	return func(o *options) { o.threshold = bits }
+}
+
+// New returns a hasher configured by opts, applied in order on top of the
+// default configuration. It returns an error wrapping ErrInvalidConfig if
+// the resulting configuration is invalid.
+func New(opts ...Option) (*DCTHasher, error) {
+	config := applyOptions(opts).Config
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &DCTHasher{
+		config: config,
+		pixels: &sync.Pool{New: func() any { return newMatrix(workingSize) }},
+	}, nil
+}
+
+// newHasher returns the hasher for the optional configuration of the
+// deprecated functions taking a Config.
+func newHasher(configs []Config) (*DCTHasher, error) {
+	if len(configs) == 0 {
+		return New()
+	}
+	return New(WithConfig(configs[0]))
+}
+
+// Config returns the configuration of h.
+func (h *DCTHasher) Config() Config {
+	return h.config
+}
+
+// Hash computes the perceptual hash of img. Debug artifacts are not
+// written.
+func (h *DCTHasher) Hash(img image.Image) (Hash, error) {
+	if bounds := img.Bounds(); bounds.Dx() < workingSize || bounds.Dy() < workingSize {
+		return 0, ErrImageTooSmall
+	}
+
+	var pixels [][]float64
+	if h.pixels != nil {
+		pixels = h.pixels.Get().([][]float64)
+		defer h.pixels.Put(pixels)
+	}
+	hash, _, err := hashGrayInto(preprocessImage(img, h.config), h.config, pixels)
+	return Hash(hash), err
+}
+
+// HashReader decodes a JPEG or PNG image from r and computes its perceptual
+// hash.
+func (h *DCTHasher) HashReader(r io.Reader) (Hash, error) {
+	img, _, err := decodeImage(r)
+	if err != nil {
+		return 0, err
+	}
+	return h.Hash(img)
+}
+
+func (*DCTHasher) Name() string { return "phash" }
+
+func (h *DCTHasher) Bits() int {
+	selected, _ := hashedCoefficients(h.config)
+	return len(selected)
+}
+
+// colorHasher is ColorHash as a Hasher.
+type colorHasher struct{}
+
+func (colorHasher) Hash(img image.Image) (Hash, error) {
+	if img.Bounds().Empty() {
+		return 0, ErrImageTooSmall
+	}
+	return ColorHash(img), nil
+}
+
+func (colorHasher) Name() string { return "colorhash" }
+
+func (colorHasher) Bits() int { return colorBins * colorLevels }
@@ -0,0 +1,394 @@
+package perceptualhash
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"slices"
+	"sync"
+)
+
+// tagICCProfile is the TIFF tag holding an embedded ICC profile.
+const tagICCProfile = 0x8773
+
+// maxICCProfile bounds the size of an embedded ICC profile.
+const maxICCProfile = 1 << 24
+
+// curveLevels is the number of entries of the lookup tables that map
+// encoded channel values to linear light and back.
+const curveLevels = 4096
+
+// xyzToSRGB converts D50 XYZ, the profile connection space, to linear sRGB,
+// including the Bradford adaptation to D65.
+var xyzToSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// colorTransform converts colors described by an ICC profile to sRGB.
+type colorTransform struct {
+	// curves map encoded channel values, scaled to curveLevels, to linear
+	// light.
+	curves [3][]float32
+	// matrix converts linear device colors to linear sRGB.
+	matrix [3][3]float32
+}
+
+// srgbEncode maps linear light, scaled to curveLevels, to 8-bit sRGB.
+var srgbEncode = sync.OnceValue(func() []uint8 {
+	table := make([]uint8, curveLevels)
+	for i := range table {
+		table[i] = uint8(math.Round(255 * srgbFromLinear(float64(i)/(curveLevels-1))))
+	}
+	return table
+})
+
+// srgbFromLinear applies the sRGB transfer function to linear light.
+func srgbFromLinear(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// toSRGB converts an image decoded from data to sRGB if data embeds an ICC
+// profile describing other colors, such as the Display P3 of phone photos
+// or Adobe RGB, so it hashes like its sRGB-converted copies. Images without
+// a profile are taken to be sRGB already, as are images whose profile this
+// package cannot apply, such as CMYK profiles and profiles built from
+// lookup tables.
+func toSRGB(img image.Image, data []byte) image.Image {
+	t := parseICC(embeddedProfile(data))
+	if t == nil {
+		return img
+	}
+
+	bounds := img.Bounds()
+	converted := image.NewNRGBA(bounds)
+	encode := srgbEncode()
+	at := nrgba64At(img)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := converted.Pix[converted.PixOffset(bounds.Min.X, y):]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := at(x, y)
+			linear := [3]float32{
+				t.curves[0][int(c.R)*(curveLevels-1)/0xffff],
+				t.curves[1][int(c.G)*(curveLevels-1)/0xffff],
+				t.curves[2][int(c.B)*(curveLevels-1)/0xffff],
+			}
+			i := 4 * (x - bounds.Min.X)
+			for c := range 3 {
+				v := t.matrix[c][0]*linear[0] + t.matrix[c][1]*linear[1] + t.matrix[c][2]*linear[2]
+				row[i+c] = encode[int(min(max(v, 0), 1)*(curveLevels-1)+0.5)]
+			}
+			row[i+3] = uint8(c.A >> 8)
+		}
+	}
+	return converted
+}
+
+// nrgba64At returns a function giving the colors of img as
+// color.NRGBA64Model converts them. It reads the pixel slices of the image
+// types decoders return directly, since going through At and Convert
+// allocates for every pixel.
+func nrgba64At(img image.Image) func(x, y int) color.NRGBA64 {
+	switch src := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) color.NRGBA64 {
+			c := src.YCbCrAt(x, y)
+			r, g, b := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+			return color.NRGBA64{uint16(r) * 0x101, uint16(g) * 0x101, uint16(b) * 0x101, 0xffff}
+		}
+	case *image.Gray:
+		return func(x, y int) color.NRGBA64 {
+			v := uint16(src.Pix[src.PixOffset(x, y)]) * 0x101
+			return color.NRGBA64{v, v, v, 0xffff}
+		}
+	case *image.Gray16:
+		return func(x, y int) color.NRGBA64 {
+			p := src.Pix[src.PixOffset(x, y):]
+			v := uint16(p[0])<<8 | uint16(p[1])
+			return color.NRGBA64{v, v, v, 0xffff}
+		}
+	case *image.NRGBA:
+		return func(x, y int) color.NRGBA64 {
+			p := src.Pix[src.PixOffset(x, y):]
+			return unpremultiply(color.NRGBA{p[0], p[1], p[2], p[3]}.RGBA())
+		}
+	case *image.RGBA:
+		return func(x, y int) color.NRGBA64 {
+			p := src.Pix[src.PixOffset(x, y):]
+			return unpremultiply(color.RGBA{p[0], p[1], p[2], p[3]}.RGBA())
+		}
+	case *image.NRGBA64:
+		return src.NRGBA64At
+	case *image.RGBA64:
+		return func(x, y int) color.NRGBA64 {
+			return unpremultiply(src.RGBA64At(x, y).RGBA())
+		}
+	}
+	return func(x, y int) color.NRGBA64 {
+		return color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+	}
+}
+
+// unpremultiply converts alpha-premultiplied channels as returned by
+// color.Color.RGBA the way color.NRGBA64Model does.
+func unpremultiply(r, g, b, a uint32) color.NRGBA64 {
+	switch a {
+	case 0xffff:
+		return color.NRGBA64{uint16(r), uint16(g), uint16(b), 0xffff}
+	case 0:
+		return color.NRGBA64{}
+	}
+	return color.NRGBA64{uint16(r * 0xffff / a), uint16(g * 0xffff / a), uint16(b * 0xffff / a), uint16(a)}
+}
+
+// embeddedProfile returns the ICC profile embedded in a JPEG, PNG or TIFF
+// file, or nil if there is none.
+func embeddedProfile(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return jpegProfile(data)
+	case bytes.HasPrefix(data, []byte(pngSignature)):
+		return pngProfile(data)
+	}
+	directories, file := tiffDirectories(data)
+	if len(directories) == 0 || rawFormat(data) != "" {
+		return nil
+	}
+	fields, err := file.Directory(directories[0])
+	if err != nil {
+		return nil
+	}
+	return fields[tagICCProfile].Value
+}
+
+// jpegProfile joins the ICC_PROFILE APP2 segments of a JPEG file, which
+// split profiles larger than a segment.
+func jpegProfile(data []byte) []byte {
+	type segment struct {
+		sequence byte
+		body     []byte
+	}
+	var segments []segment
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xff; {
+		marker := data[pos+1]
+		if marker == 0xff {
+			// Fill byte.
+			pos++
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			// Metadata precedes the scan.
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		body := data[pos+4 : pos+2+length]
+		if marker == 0xe2 && len(body) > 14 && string(body[:12]) == "ICC_PROFILE\x00" {
+			segments = append(segments, segment{body[12], body[14:]})
+		}
+		pos += 2 + length
+	}
+
+	slices.SortStableFunc(segments, func(a, b segment) int { return int(a.sequence) - int(b.sequence) })
+	var profile []byte
+	for _, s := range segments {
+		profile = append(profile, s.body...)
+	}
+	return profile
+}
+
+// pngProfile decompresses the iCCP chunk of a PNG file.
+func pngProfile(data []byte) []byte {
+	var profile []byte
+	eachChunk(data, func(kind string, body []byte) bool {
+		switch kind {
+		case "iCCP":
+			// The profile name, a NUL and the compression method precede
+			// the zlib stream.
+			name := bytes.IndexByte(body, 0)
+			if name < 0 || name+2 > len(body) {
+				return false
+			}
+			r, err := zlib.NewReader(bytes.NewReader(body[name+2:]))
+			if err != nil {
+				return false
+			}
+			profile, _ = io.ReadAll(io.LimitReader(r, maxICCProfile))
+			return false
+		case "IDAT":
+			return false
+		}
+		return true
+	})
+	return profile
+}
+
+// parseICC returns the transform to sRGB described by an RGB or grayscale
+// ICC profile built from tone curves and, for RGB, primaries. It returns
+// nil for other profiles and for profiles that already describe sRGB.
+func parseICC(profile []byte) *colorTransform {
+	if len(profile) < 132 || string(profile[36:40]) != "acsp" || string(profile[20:24]) != "XYZ " {
+		return nil
+	}
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := range min(count, (len(profile)-132)/12) {
+		entry := profile[132+12*i:]
+		offset := uint64(binary.BigEndian.Uint32(entry[4:]))
+		size := uint64(binary.BigEndian.Uint32(entry[8:]))
+		if offset+size <= uint64(len(profile)) {
+			tags[string(entry[:4])] = profile[offset : offset+size]
+		}
+	}
+
+	var curves [3]func(float64) float64
+	var matrix [3][3]float64
+	switch string(profile[16:20]) {
+	case "RGB ":
+		for i, name := range []string{"rTRC", "gTRC", "bTRC"} {
+			if curves[i] = parseCurve(tags[name]); curves[i] == nil {
+				return nil
+			}
+		}
+		// The columns of the profile matrix are the XYZ of the primaries.
+		var primaries [3][3]float64
+		for i, name := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+			xyz := tags[name]
+			if len(xyz) < 20 || string(xyz[:4]) != "XYZ " {
+				return nil
+			}
+			for j := range 3 {
+				primaries[j][i] = s15Fixed16(xyz[8+4*j:])
+			}
+		}
+		for i := range 3 {
+			for j := range 3 {
+				for k := range 3 {
+					matrix[i][j] += xyzToSRGB[i][k] * primaries[k][j]
+				}
+			}
+		}
+	case "GRAY":
+		curve := parseCurve(tags["kTRC"])
+		if curve == nil {
+			return nil
+		}
+		curves = [3]func(float64) float64{curve, curve, curve}
+		matrix = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	default:
+		return nil
+	}
+
+	if isSRGB(curves, matrix) {
+		return nil
+	}
+	t := &colorTransform{}
+	for c := range 3 {
+		t.curves[c] = make([]float32, curveLevels)
+		for i := range curveLevels {
+			t.curves[c][i] = float32(curves[c](float64(i) / (curveLevels - 1)))
+		}
+		for j := range 3 {
+			t.matrix[c][j] = float32(matrix[c][j])
+		}
+	}
+	return t
+}
+
+// isSRGB reports whether curves and matrix describe sRGB closely enough
+// that converting would only add rounding errors.
+func isSRGB(curves [3]func(float64) float64, matrix [3][3]float64) bool {
+	for i := range 3 {
+		for j := range 3 {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(matrix[i][j]-want) > 0.01 {
+				return false
+			}
+		}
+	}
+	for _, curve := range curves {
+		for i := range 256 {
+			v := float64(i) / 255
+			if math.Abs(srgbFromLinear(curve(v))-v) > 0.5/255 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseCurve returns the function of a curv or para tone curve, mapping
+// encoded values in [0, 1] to linear light, or nil if it is malformed.
+func parseCurve(tag []byte) func(float64) float64 {
+	if len(tag) < 12 {
+		return nil
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case n == 0:
+			return func(v float64) float64 { return v }
+		case n == 1 && len(tag) >= 14:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(v float64) float64 { return math.Pow(v, gamma) }
+		case len(tag) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 0xffff
+			}
+			return func(v float64) float64 {
+				x := v * float64(n-1)
+				i := min(int(x), n-2)
+				return table[i] + (x-float64(i))*(table[i+1]-table[i])
+			}
+		}
+	case "para":
+		paramCounts := []int{1, 3, 4, 5, 7}
+		kind := int(binary.BigEndian.Uint16(tag[8:]))
+		if kind >= len(paramCounts) || len(tag) < 12+4*paramCounts[kind] {
+			return nil
+		}
+		// g, a, b, c, d, e, f as in the ICC specification; the parameters a
+		// function type lacks keep values that make them no-ops.
+		p := [7]float64{1, 1, 0, 0, 0, 0, 0}
+		for i := range paramCounts[kind] {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch kind {
+		case 1, 2:
+			// Below -b/a the curve is c, which type 1 lacks.
+			if a == 0 {
+				return nil
+			}
+			d, e, f = -b/a, c, c
+			c = 0
+		}
+		return func(v float64) float64 {
+			if v < d {
+				return c*v + f
+			}
+			return math.Pow(max(a*v+b, 0), g) + e
+		}
+	}
+	return nil
+}
+
+// s15Fixed16 decodes an ICC signed 15.16 fixed-point number.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
@@ -0,0 +1,61 @@
+package perceptualhash
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestNRGBA64At(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bounds := image.Rect(3, 5, 19, 17)
+	random := func(pix []byte) {
+		r.Read(pix)
+	}
+	// Premultiplied images must not hold channels above alpha.
+	premultiplied := func(pix []byte, size int) {
+		random(pix)
+		for i := 0; i < len(pix); i += 4 * size {
+			for c := range 3 * size {
+				pix[i+c] = min(pix[i+c], pix[i+3*size+c%size])
+			}
+		}
+	}
+
+	nrgba := image.NewNRGBA(bounds)
+	random(nrgba.Pix)
+	rgba := image.NewRGBA(bounds)
+	premultiplied(rgba.Pix, 1)
+	nrgba64 := image.NewNRGBA64(bounds)
+	random(nrgba64.Pix)
+	rgba64 := image.NewRGBA64(bounds)
+	premultiplied(rgba64.Pix, 2)
+	gray := image.NewGray(bounds)
+	random(gray.Pix)
+	gray16 := image.NewGray16(bounds)
+	random(gray16.Pix)
+	paletted := image.NewPaletted(bounds, color.Palette{color.Black, color.NRGBA{200, 100, 50, 128}})
+	for i := range paletted.Pix {
+		paletted.Pix[i] = uint8(r.Intn(2))
+	}
+
+	// YCbCr images keep the 8-bit conversion of color.YCbCrToRGB, which
+	// rounds differently from their RGBA method.
+	for _, img := range []image.Image{nrgba, rgba, nrgba64, rgba64, gray, gray16, paletted} {
+		at := nrgba64At(img)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				want := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+				if got := at(x, y); got != want {
+					t.Fatalf("%T at (%d, %d) = %v, want %v", img, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	at := nrgba64At(nrgba)
+	if allocs := testing.AllocsPerRun(10, func() { at(4, 6) }); allocs != 0 {
+		t.Errorf("reading a pixel allocates %v times, want 0", allocs)
+	}
+}
@@ -0,0 +1,183 @@
+package perceptualhash
+
+import (
+	"image"
+	"slices"
+
+	"golang.org/x/image/draw"
+)
+
+// Region is the part of an image that best matches a hash.
+type Region struct {
+	Bounds   image.Rectangle
+	Distance int
+}
+
+const (
+	// locateSize is the shorter side images are reduced to before searching.
+	locateSize = 256
+	// locateMinScale is the smallest window searched, as a fraction of the
+	// shorter side of the image.
+	locateMinScale = 0.25
+	// locateScaleStep is the ratio between successive window sizes.
+	locateScaleStep = 0.9
+	// locateRefine is the number of best coarse windows refined.
+	locateRefine = 8
+)
+
+// locateAspects are the window width to height ratios searched by Locate.
+var locateAspects = []float64{1, 4.0 / 3, 3.0 / 4}
+
+// Locate finds the region of img that best matches h. Pass the
+// configuration h was computed with.
+//
+// Deprecated: Use New and DCTHasher.Locate.
+func Locate(h Hash, img image.Image, configs ...Config) (Region, error) {
+	hasher, err := newHasher(configs)
+	if err != nil {
+		return Region{}, err
+	}
+	return hasher.Locate(h, img)
+}
+
+// Locate finds the region of img that best matches target, computed by h,
+// for detecting an image embedded in a collage or screenshot. It slides
+// windows of several sizes and aspect ratios over img, down to a quarter of
+// its shorter side, then refines the best matches with a finer step.
+// Preprocessing options other than the DCT settings are not applied to the
+// windows.
+func (h *DCTHasher) Locate(target Hash, img image.Image) (Region, error) {
+	config := h.config
+
+	bounds := img.Bounds()
+	if bounds.Dx() < workingSize || bounds.Dy() < workingSize {
+		return Region{}, ErrImageTooSmall
+	}
+
+	// Search a reduced copy, then map the result back.
+	scale := min(1, float64(locateSize)/float64(min(bounds.Dx(), bounds.Dy())))
+	small := image.NewGray(image.Rect(0, 0, max(int(float64(bounds.Dx())*scale), 1), max(int(float64(bounds.Dy())*scale), 1)))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+	width, height := small.Bounds().Dx(), small.Bounds().Dy()
+
+	// Windows are ranked with the fixed-point DCT, which is much faster and
+	// almost always agrees with the configured transform, and are reduced by
+	// averaging boxes of an integral image instead of resampling. Only the
+	// final distance is computed like FromImage does.
+	fast := config
+	fast.Transform = FixedPointDCT
+	sums := newIntegralImage(small)
+	window := image.NewGray(image.Rect(0, 0, workingSize, workingSize))
+	distance := func(r image.Rectangle, precise bool, config Config) (int, bool) {
+		if !r.In(small.Bounds()) || r.Dx() < workingSize || r.Dy() < workingSize {
+			return 0, false
+		}
+		if precise {
+			draw.CatmullRom.Scale(window, window.Bounds(), small, r, draw.Src, nil)
+		} else {
+			sums.boxScale(window, r)
+		}
+		hash, _, err := hashGray(window, config)
+		if err != nil {
+			return 0, false
+		}
+		return target.Distance(Hash(hash)), true
+	}
+
+	// Coarse pass: every size and aspect ratio with a step of an eighth of
+	// the window, keeping the best few windows.
+	var candidates []Region
+	shorter := float64(min(width, height))
+	for size := shorter; size >= shorter*locateMinScale; size *= locateScaleStep {
+		for _, aspect := range locateAspects {
+			w, h := int(size*min(aspect, 1)), int(size/max(aspect, 1))
+			stepX, stepY := max(w/8, 1), max(h/8, 1)
+			for y := 0; y+h <= height; y += stepY {
+				for x := 0; x+w <= width; x += stepX {
+					r := image.Rect(x, y, x+w, y+h)
+					if d, ok := distance(r, false, fast); ok {
+						candidates = append(candidates, Region{Bounds: r, Distance: d})
+					}
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return Region{}, ErrLowEntropyImage
+	}
+	slices.SortStableFunc(candidates, func(a, b Region) int {
+		return a.Distance - b.Distance
+	})
+	candidates = candidates[:min(len(candidates), locateRefine)]
+
+	// Fine pass: shift the best windows by small steps, then resize them in
+	// either direction, which also covers aspect ratios between the searched
+	// ones.
+	best := candidates[0]
+	for _, candidate := range candidates {
+		stepX, stepY := max(candidate.Bounds.Dx()/32, 1), max(candidate.Bounds.Dy()/32, 1)
+		shifted := candidate
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				r := candidate.Bounds.Add(image.Pt(dx*stepX, dy*stepY))
+				if d, ok := distance(r, true, fast); ok && d < shifted.Distance {
+					shifted = Region{Bounds: r, Distance: d}
+				}
+			}
+		}
+		for growY := -2; growY <= 2; growY++ {
+			for growX := -2; growX <= 2; growX++ {
+				r := shifted.Bounds
+				r = image.Rect(r.Min.X-growX*stepX, r.Min.Y-growY*stepY, r.Max.X+growX*stepX, r.Max.Y+growY*stepY)
+				if d, ok := distance(r, true, fast); ok && d < best.Distance {
+					best = Region{Bounds: r, Distance: d}
+				}
+			}
+		}
+	}
+	if d, ok := distance(best.Bounds, true, config); ok {
+		best.Distance = d
+	}
+
+	best.Bounds = image.Rect(
+		bounds.Min.X+int(float64(best.Bounds.Min.X)/scale),
+		bounds.Min.Y+int(float64(best.Bounds.Min.Y)/scale),
+		bounds.Min.X+int(float64(best.Bounds.Max.X)/scale),
+		bounds.Min.Y+int(float64(best.Bounds.Max.Y)/scale),
+	)
+	return best, nil
+}
+
+// integralImage holds the sums of all pixels above and left of each point,
+// so the mean of any rectangle takes four lookups.
+type integralImage struct {
+	width int
+	sums  []int
+}
+
+func newIntegralImage(img *image.Gray) integralImage {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	ii := integralImage{width: w + 1, sums: make([]int, (w+1)*(h+1))}
+	for y := range h {
+		rowSum := 0
+		for x := range w {
+			rowSum += int(img.Pix[img.PixOffset(x, y)])
+			ii.sums[(y+1)*ii.width+x+1] = ii.sums[y*ii.width+x+1] + rowSum
+		}
+	}
+	return ii
+}
+
+// boxScale fills dst with the means of the cells of r divided into a grid
+// the size of dst.
+func (ii integralImage) boxScale(dst *image.Gray, r image.Rectangle) {
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+	for y := range h {
+		y0, y1 := r.Min.Y+y*r.Dy()/h, r.Min.Y+(y+1)*r.Dy()/h
+		for x := range w {
+			x0, x1 := r.Min.X+x*r.Dx()/w, r.Min.X+(x+1)*r.Dx()/w
+			sum := ii.sums[y1*ii.width+x1] - ii.sums[y0*ii.width+x1] - ii.sums[y1*ii.width+x0] + ii.sums[y0*ii.width+x0]
+			dst.Pix[dst.PixOffset(x, y)] = uint8(sum / ((x1 - x0) * (y1 - y0)))
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package perceptualhash
+
+import (
+	"image"
+	"slices"
+
+	"github.com/insomnius/tools/imagemetrics"
+	"github.com/insomnius/tools/imgresize"
+)
+
+// MatchConfig holds options for a Matcher.
+type MatchConfig struct {
+	// Prefilter is the cheap hash every reference is screened with.
+	Prefilter Hasher
+	// PrefilterThreshold is the maximum Prefilter distance for a reference
+	// to be compared with the expensive hash. It should be generous, as the
+	// cheap hashes are less robust.
+	PrefilterThreshold int
+	// Hasher is the expensive hash deciding matches.
+	Hasher Hasher
+	// Threshold is the maximum Hasher distance for a match.
+	Threshold int
+	// MinSSIM, if positive, additionally requires matches to have at least
+	// this structural similarity with the query, measured on small
+	// grayscale copies kept for every reference.
+	MinSSIM float64
+}
+
+var defaultMatchConfig = MatchConfig{
+	Prefilter:          averageHasher{},
+	PrefilterThreshold: 16,
+	Hasher:             &DCTHasher{},
+	Threshold:          10,
+}
+
+// ssimSize is the width and height of the copies compared for
+// MatchConfig.MinSSIM.
+const ssimSize = 64
+
+// Matcher finds near-duplicates of an image among a set of references in
+// two stages: a cheap hash rules out most references, and the expensive
+// hash, and optionally SSIM, is only computed for the query and compared
+// against the survivors. A Matcher must not be queried while references
+// are being added.
+type Matcher struct {
+	config     MatchConfig
+	references []matchReference
+}
+
+type matchReference struct {
+	name      string
+	prefilter Hash
+	hash      Hash
+	small     *image.Gray
+}
+
+// MatchResult is a reference that matched a query.
+type MatchResult struct {
+	Name string
+	// Distance is the distance between the expensive hashes.
+	Distance int
+	// PrefilterDistance is the distance between the cheap hashes.
+	PrefilterDistance int
+	// SSIM is the structural similarity, set if MatchConfig.MinSSIM is.
+	SSIM float64
+}
+
+// NewMatcher returns an empty Matcher. By default it prefilters with
+// AverageHash, which at a threshold of 16 keeps near-duplicates within a
+// DCT distance of 10 while ruling out over 90% of unrelated references.
+// It optionally accepts a custom configuration.
+func NewMatcher(configs ...MatchConfig) *Matcher {
+	config := defaultMatchConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Prefilter == nil {
+		config.Prefilter = defaultMatchConfig.Prefilter
+	}
+	if config.Hasher == nil {
+		config.Hasher = defaultMatchConfig.Hasher
+	}
+	return &Matcher{config: config}
+}
+
+// Add computes both hashes of img and registers it as a reference under
+// name.
+func (m *Matcher) Add(name string, img image.Image) error {
+	prefilter, err := m.config.Prefilter.Hash(img)
+	if err != nil {
+		return err
+	}
+	hash, err := m.config.Hasher.Hash(img)
+	if err != nil {
+		return err
+	}
+
+	reference := matchReference{name: name, prefilter: prefilter, hash: hash}
+	if m.config.MinSSIM > 0 {
+		reference.small = imgresize.Gray(img, ssimSize, ssimSize)
+	}
+	m.references = append(m.references, reference)
+	return nil
+}
+
+// Find returns the references matching img, closest first. The expensive
+// hash of img is only computed if some reference passes the prefilter.
+func (m *Matcher) Find(img image.Image) ([]MatchResult, error) {
+	prefilter, err := m.config.Prefilter.Hash(img)
+	if err != nil {
+		return nil, err
+	}
+
+	var survivors []MatchResult
+	var indices []int
+	for i, reference := range m.references {
+		if distance := prefilter.Distance(reference.prefilter); distance <= m.config.PrefilterThreshold {
+			survivors = append(survivors, MatchResult{Name: reference.name, PrefilterDistance: distance})
+			indices = append(indices, i)
+		}
+	}
+	if len(survivors) == 0 {
+		return nil, nil
+	}
+
+	hash, err := m.config.Hasher.Hash(img)
+	if err != nil {
+		return nil, err
+	}
+	var small *image.Gray
+	if m.config.MinSSIM > 0 {
+		small = imgresize.Gray(img, ssimSize, ssimSize)
+	}
+
+	var results []MatchResult
+	for i, result := range survivors {
+		reference := m.references[indices[i]]
+		result.Distance = hash.Distance(reference.hash)
+		if result.Distance > m.config.Threshold {
+			continue
+		}
+		if small != nil {
+			if result.SSIM, err = imagemetrics.SSIM(small, reference.small); err != nil {
+				return nil, err
+			}
+			if result.SSIM < m.config.MinSSIM {
+				continue
+			}
+		}
+		results = append(results, result)
+	}
+
+	slices.SortStableFunc(results, func(a, b MatchResult) int {
+		return a.Distance - b.Distance
+	})
+	return results, nil
+}
@@ -0,0 +1,23 @@
+package perceptualhash
+
+import (
+	"os"
+
+	"github.com/insomnius/tools/internal/mmap"
+)
+
+// readFile returns the contents of the file at path, memory-mapped if it
+// has at least Config.Pipeline.MmapThreshold bytes. release must be called
+// once the contents are no longer used.
+func readFile(path string, config Config) (data []byte, release func(), err error) {
+	if config.Pipeline.MmapThreshold > 0 {
+		if info, err := os.Stat(path); err == nil && info.Size() >= config.Pipeline.MmapThreshold {
+			if data, unmap, err := mmap.Map(path); err == nil {
+				return data, func() { unmap() }, nil
+			}
+		}
+	}
+
+	data, err = os.ReadFile(path)
+	return data, func() {}, err
+}
@@ -0,0 +1,150 @@
+package perceptualhash
+
+import (
+	"fmt"
+	"image"
+)
+
+// Orientation is one of the eight rotations and mirrorings of an image. The
+// values match the EXIF orientation tag.
+type Orientation int
+
+const (
+	Identity Orientation = iota + 1
+	FlipHorizontal
+	Rotate180
+	FlipVertical
+	// Transpose mirrors the image across its main diagonal.
+	Transpose
+	// Rotate90 rotates the image clockwise.
+	Rotate90
+	// Transverse mirrors the image across its anti-diagonal.
+	Transverse
+	// Rotate270 rotates the image counterclockwise.
+	Rotate270
+)
+
+var orientationNames = map[Orientation]string{
+	Identity:       "identity",
+	FlipHorizontal: "flip horizontal",
+	Rotate180:      "rotate 180",
+	FlipVertical:   "flip vertical",
+	Transpose:      "transpose",
+	Rotate90:       "rotate 90",
+	Transverse:     "transverse",
+	Rotate270:      "rotate 270",
+}
+
+func (o Orientation) String() string {
+	if name, ok := orientationNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Orientation(%d)", int(o))
+}
+
+// DetectOrientation returns the orientation of query that brings it
+// closest to reference, with the resulting distance in bits.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.DetectOrientation.
+func DetectOrientation(query, reference image.Image, configs ...Config) (Orientation, int, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return 0, 0, err
+	}
+	return h.DetectOrientation(query, reference)
+}
+
+// CompareRotations returns the smallest distance in bits between h and img
+// rotated by 0, 90, 180 and 270 degrees.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.CompareRotations.
+func CompareRotations(h Hash, img image.Image, configs ...Config) (int, error) {
+	hasher, err := newHasher(configs)
+	if err != nil {
+		return 0, err
+	}
+	return hasher.CompareRotations(h, img)
+}
+
+// DetectOrientation hashes query under all eight orientations and returns
+// the one that brings it closest to reference, with the resulting distance
+// in bits. Applying the orientation to query corrects a mirrored or rotated
+// re-upload. Ties favor Identity, then the order of the constants.
+func (h *DCTHasher) DetectOrientation(query, reference image.Image) (Orientation, int, error) {
+	want, err := h.Hash(reference)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return bestOrientation(want, query, []Orientation{
+		Identity, FlipHorizontal, Rotate180, FlipVertical,
+		Transpose, Rotate90, Transverse, Rotate270,
+	}, h.config)
+}
+
+// CompareRotations hashes img rotated by 0, 90, 180 and 270 degrees and
+// returns the smallest distance in bits to want. It matches phone photos
+// whose orientation metadata was stripped somewhere along the way.
+func (h *DCTHasher) CompareRotations(want Hash, img image.Image) (int, error) {
+	_, distance, err := bestOrientation(want, img, []Orientation{
+		Identity, Rotate90, Rotate180, Rotate270,
+	}, h.config)
+	return distance, err
+}
+
+// bestOrientation returns the candidate orientation of img whose hash is
+// closest to want, with its distance. Earlier candidates win ties.
+func bestOrientation(want Hash, img image.Image, candidates []Orientation, config Config) (Orientation, int, error) {
+	if bounds := img.Bounds(); bounds.Dx() < workingSize || bounds.Dy() < workingSize {
+		return 0, 0, ErrImageTooSmall
+	}
+	// Rotating the 32x32 working image is equivalent to rotating the
+	// original first, as the resampling filter is symmetric.
+	preprocessed := preprocessImage(img, config)
+
+	best, bestDistance := Orientation(0), 0
+	for _, o := range candidates {
+		hash, _, err := hashGray(o.apply(preprocessed), config)
+		if err != nil {
+			return 0, 0, err
+		}
+		if distance := want.Distance(Hash(hash)); best == 0 || distance < bestDistance {
+			best, bestDistance = o, distance
+		}
+	}
+	return best, bestDistance, nil
+}
+
+// apply returns a copy of the square image img in orientation o.
+func (o Orientation) apply(img *image.Gray) *image.Gray {
+	n := img.Bounds().Dx()
+	last := n - 1
+	out := image.NewGray(image.Rect(0, 0, n, n))
+	for y := range n {
+		for x := range n {
+			var sx, sy int
+			switch o {
+			case FlipHorizontal:
+				sx, sy = last-x, y
+			case Rotate180:
+				sx, sy = last-x, last-y
+			case FlipVertical:
+				sx, sy = x, last-y
+			case Transpose:
+				sx, sy = y, x
+			case Rotate90:
+				sx, sy = y, last-x
+			case Transverse:
+				sx, sy = last-y, last-x
+			case Rotate270:
+				sx, sy = last-y, x
+			default:
+				sx, sy = x, y
+			}
+			out.Pix[out.PixOffset(x, y)] = img.Pix[img.PixOffset(sx, sy)]
+		}
+	}
+	return out
+}
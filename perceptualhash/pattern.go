@@ -0,0 +1,109 @@
+package perceptualhash
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// defaultExtensions lists the file extensions hashed by directory walks when
+// Config.Walk.Extensions is empty.
+var defaultExtensions = []string{".jpg", ".jpeg", ".png"}
+
+// selector decides which entries of a directory walk are hashed, following
+// Config.Walk.
+type selector struct {
+	extensions []string
+	include    []string
+	exclude    []string
+}
+
+func newSelector(config Config) selector {
+	s := selector{extensions: defaultExtensions, include: config.Walk.Include, exclude: config.Walk.Exclude}
+	if len(config.Walk.Extensions) > 0 {
+		s.extensions = make([]string, len(config.Walk.Extensions))
+		for i, ext := range config.Walk.Extensions {
+			s.extensions[i] = strings.ToLower(ext)
+		}
+	}
+	return s
+}
+
+// visit reports whether the entry at rel, a slash-separated path relative
+// to the walk root, is a file to hash. Excluded directories return
+// fs.SkipDir so the walk does not descend into them.
+func (s selector) visit(rel string, d fs.DirEntry) (bool, error) {
+	if d.IsDir() {
+		if rel != "." && s.matches(s.exclude, rel) {
+			return false, fs.SkipDir
+		}
+		return false, nil
+	}
+	return s.file(rel), nil
+}
+
+// file reports whether the file at rel is to be hashed, leaving out the
+// directories it is in.
+func (s selector) file(rel string) bool {
+	if !slices.Contains(s.extensions, strings.ToLower(path.Ext(rel))) {
+		return false
+	}
+	if len(s.include) > 0 && !s.matches(s.include, rel) {
+		return false
+	}
+	return !s.matches(s.exclude, rel)
+}
+
+// entry is like file for archive entries, which are listed without their
+// directories: rel is also left out if one of its directories is excluded.
+func (s selector) entry(rel string) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if s.matches(s.exclude, dir) {
+			return false
+		}
+	}
+	return s.file(rel)
+}
+
+// matches reports whether rel matches any of patterns, as documented on
+// ImagePaths.
+func (selector) matches(patterns []string, rel string) bool {
+	elements := strings.Split(rel, "/")
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, elements[len(elements)-1]); ok {
+				return true
+			}
+			continue
+		}
+		if matchElements(strings.Split(pattern, "/"), elements) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchElements matches path elements against pattern elements, where "**"
+// matches zero or more elements.
+func matchElements(pattern, elements []string) bool {
+	if len(pattern) == 0 {
+		return len(elements) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(elements); i++ {
+			if matchElements(pattern[1:], elements[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(elements) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], elements[0]); !ok {
+		return false
+	}
+	return matchElements(pattern[1:], elements[1:])
+}
@@ -8,94 +8,297 @@ import (
 	"image/color"
 	"image/jpeg"
 	"image/png"
-	"math"
 	"os"
-
-	"golang.org/x/image/draw"
 )
 
-// Config holds debugging options for perceptual hashing.
+// Config holds the options of perceptual hashing: those of the hash itself,
+// which make hashes incomparable when they differ, the debug artifacts, and
+// in Walk and Pipeline, how files are selected and processed. In debug mode,
+// each artifact whose path is set is written to that path.
 type Config struct {
 	Debug          bool
 	DebugParameter struct {
 		PreprocessedImagePath string
 		VisualizedImagePath   string
+		// ReportPath is where a self-contained HTML report embedding every
+		// debug artifact is written.
+		ReportPath string
 	}
+	// DCMode selects what bit 0 of the hash encodes.
+	DCMode DCMode
+	// Coefficients selects the block of DCT coefficients the hash is built
+	// from, with X the horizontal and Y the vertical frequency. Each
+	// coefficient gives one bit, in row-major order, so the block holds at
+	// most 64 of them, within the 32x32 DCT. Empty means the lowest 8x8
+	// frequencies, image.Rect(0, 0, 8, 8). Blocks away from the origin, such
+	// as image.Rect(1, 1, 9, 9) skipping the first row and column, make the
+	// hash sensitive to texture-level edits the lowest frequencies miss.
+	// DCMode only applies to blocks including the DC coefficient. Hashes
+	// computed from different blocks are not comparable.
+	Coefficients image.Rectangle
+	// Order selects how coefficients are assigned to bits. ZigzagOrder
+	// replaces the block selected by Coefficients, which must then be
+	// empty.
+	Order CoefficientOrder
+	// Transform selects the DCT implementation.
+	Transform Transform
+	// Watermark selects how regions that commonly carry watermarks are
+	// treated.
+	Watermark WatermarkMode
+	// SuppressText detects high-contrast overlaid text, such as meme
+	// captions, and paints over it with the surrounding content before
+	// hashing, so captioned variants match their originals. Images without
+	// detected text hash exactly as without it.
+	SuppressText bool
+	// SmartCrop hashes only the region of the image holding its edges,
+	// trimming plain backgrounds and margins, so a full product photo
+	// matches a tightly cropped copy. Hashes are not comparable with those
+	// computed without it.
+	SmartCrop bool
+	// CenterWeight, from 0 to 1, fades the image toward its mean intensity
+	// with the distance from its center, by up to this fraction at the
+	// corners, so the subject of centered shots outweighs varying
+	// background padding around it. Zero hashes the image evenly. Hashes
+	// are only comparable with those computed with the same weight.
+	CenterWeight float64
+	// Walk selects the files directory walks hash. It does not affect
+	// hashes.
+	Walk WalkConfig
+	// Pipeline tunes how files are read, cached and processed. It does not
+	// affect hashes.
+	Pipeline PipelineConfig
+}
+
+// WalkConfig selects the files hashed by directory walks.
+type WalkConfig struct {
+	// Extensions lists the file extensions hashed, such as ".webp". Empty
+	// means .jpg, .jpeg and .png.
+	Extensions []string
+	// Include, if not empty, restricts walks to files matching one of these
+	// patterns.
+	Include []string
+	// Exclude skips files and directories matching any of these patterns,
+	// such as "node_modules", "*.thumb.jpg" or "raw/**". See ImagePaths for
+	// the pattern syntax.
+	Exclude []string
+	// Symlinks selects how symbolic links are treated.
+	Symlinks SymlinkMode
+	// SkipVisited hashes every file only once, even if it is reachable
+	// through several symbolic links or hard links. Files are identified by
+	// device and inode where the platform provides them, and by their
+	// resolved path otherwise.
+	SkipVisited bool
 }
 
+// PipelineConfig tunes how files are read, cached and processed.
+type PipelineConfig struct {
+	// Cache, if set, stores computed hashes by file contents and
+	// configuration, so unchanged images are not hashed again by FromPath,
+	// FromReader, FromBytes, FromFS and the directory walks. It is bypassed
+	// in debug mode, which needs every artifact computed.
+	Cache Cache
+	// Checksum makes FromPathResult and the directory walks also compute
+	// the SHA-256 digest of every file they read, in Result.SHA256, so
+	// integrity checks share the expensive traversal with hashing. It is
+	// ignored in debug mode.
+	Checksum bool
+	// MmapThreshold, if positive, makes FromPath, FromPathResult and Iter
+	// and HashDirStream memory-map files of at least this many bytes instead
+	// of reading them, saving a copy of large inputs such as TIFF scans. It
+	// only applies on Unix systems. A mapped file that is truncated while
+	// being hashed crashes the process.
+	MmapThreshold int64
+	// MaxEntrySize is the largest archive entry, in bytes, IterArchive and
+	// ArchiveFiles read, so a small compressed archive cannot expand into
+	// all available memory. Larger entries fail with ErrEntryTooLarge. Zero
+	// means DefaultMaxEntrySize.
+	MaxEntrySize int64
+	// Workers sizes the read, decode and hash stages of HashDirStream.
+	// Zero means the number of CPUs.
+	Workers struct {
+		Read   int
+		Decode int
+		Hash   int
+	}
+}
+
+// DCMode selects how the DC coefficient, which only measures average
+// brightness, is treated when building the hash.
+type DCMode int
+
+const (
+	// DCReserved keeps bit 0 for the DC coefficient but never sets it,
+	// wasting one bit. It is the default, for compatibility with hashes
+	// computed before DCMode existed.
+	DCReserved DCMode = iota
+	// DCExcluded drops the DC coefficient entirely and uses bit 0 for the
+	// next horizontal frequency, the coefficient in row 0 right of the
+	// hashed block (column 8 by default), so all 64 bits carry AC
+	// information. Hashes are not comparable with DCReserved ones.
+	DCExcluded
+)
+
+// CoefficientOrder selects the DCT coefficients the hash is built from and
+// the order of their bits. Hashes computed with different orders are not
+// comparable.
+type CoefficientOrder int
+
+const (
+	// BlockOrder hashes the rectangular block selected by
+	// Config.Coefficients, row by row. It is the default.
+	BlockOrder CoefficientOrder = iota
+	// ZigzagOrder hashes the first 64 coefficients in the zigzag scan order
+	// of JPEG, from the DC coefficient along the anti-diagonals. It covers
+	// the frequencies more evenly per bit than a square block and matches
+	// implementations that scan this way. With DCExcluded, bit 0 encodes
+	// the 65th coefficient of the scan.
+	ZigzagOrder
+)
+
+// Transform selects how the DCT is computed.
+type Transform int
+
+const (
+	// FloatDCT computes the DCT in floating point. It is the default.
+	FloatDCT Transform = iota
+	// FixedPointDCT computes only the coefficients the hash needs, using
+	// integer arithmetic. It is much faster on small cores without a fast
+	// FPU and yields exactly the same hash on every platform. Hashes almost
+	// always equal FloatDCT ones, but rounding can flip a bit for
+	// coefficients very close to the average.
+	FixedPointDCT
+)
+
+// WatermarkMode selects how watermark-prone regions affect the hash. Hashes
+// computed with different modes are not comparable.
+type WatermarkMode int
+
+const (
+	// WatermarkNone hashes the whole image. It is the default.
+	WatermarkNone WatermarkMode = iota
+	// WatermarkMask replaces the four corners and the bottom strip, where
+	// aggregator sites put their logos, with the mean intensity of the rest
+	// of the image before hashing.
+	WatermarkMask
+	// WatermarkCenterCrop hashes only the central 70% of the image in each
+	// dimension.
+	WatermarkCenterCrop
+)
+
+// SymlinkMode selects how directory walks treat symbolic links.
+type SymlinkMode int
+
+const (
+	// SymlinkFiles hashes links to files but does not descend into linked
+	// directories. It is the default, matching filepath.WalkDir.
+	SymlinkFiles SymlinkMode = iota
+	// SymlinkSkip ignores all symbolic links.
+	SymlinkSkip
+	// SymlinkFollow also descends into linked directories, as found in
+	// archives of symlinked albums. A link back to a directory being walked
+	// is reported as an error wrapping ErrSymlinkCycle and not followed.
+	SymlinkFollow
+)
+
 var defaultConfig = Config{
 	Debug: false,
 }
 
-var ErrUnsupportedFormat = errors.New("image format is not supported")
+var (
+	ErrUnsupportedFormat = errors.New("image format is not supported")
+	// ErrNoPreview is returned for RAW files without an embedded JPEG
+	// preview that can be decoded, which cannot be decoded as plain TIFF
+	// files either.
+	ErrNoPreview = errors.New("RAW file has no decodable preview")
+	// ErrImageTooSmall is returned for images smaller than the 32x32 working
+	// size, which would have to be upscaled into meaningless detail.
+	ErrImageTooSmall = errors.New("image is smaller than 32x32 pixels")
+	// ErrLowEntropyImage is returned for uniformly colored images, whose
+	// hashes carry no information and would match each other.
+	ErrLowEntropyImage = errors.New("image is uniform and cannot be hashed meaningfully")
+	// ErrDecoderPanic is returned when an image decoder panics on malformed
+	// input.
+	ErrDecoderPanic = errors.New("image decoder panicked")
+	// ErrSymlinkCycle is reported by directory walks following symbolic
+	// links for a link to one of its own ancestors.
+	ErrSymlinkCycle = errors.New("symbolic link cycle")
+)
+
+// workingSize is the width and height images are reduced to before hashing.
+const workingSize = 32
+
+// minStdDev is the intensity standard deviation below which a preprocessed
+// image is considered uniform.
+const minStdDev = 1.0
 
 // FromPath computes the perceptual hash of the image at filePath.
 // It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FromPath.
 func FromPath(filePath string, configs ...Config) (string, error) {
-	// load the configurations
-	config := defaultConfig
-	if len(configs) > 0 {
-		config = configs[0]
+	h, err := newHasher(configs)
+	if err != nil {
+		return "", err
 	}
+	return h.FromPath(filePath)
+}
+
+// FromPath computes the perceptual hash of the image at filePath, writing
+// the debug artifacts selected by the configuration.
+func (h *DCTHasher) FromPath(filePath string) (string, error) {
+	config := h.config
 
 	// 1. Load the image
-	loadedImage, err := os.Open(filePath)
+	data, release, err := readFile(filePath, config)
 	if err != nil {
 		return "", err
 	}
-	defer loadedImage.Close()
+	defer release()
+
+	if config.Pipeline.Cache != nil && !config.Debug {
+		return cachedHash(data, config, func() (string, error) {
+			return hashData(data, config)
+		})
+	}
 
 	// 2. Decode the image
-	decodedImage, format, err := image.Decode(loadedImage)
+	decodedImage, format, err := decodeImageData(data)
 	if err != nil {
 		return "", err
 	}
 
-	if format != "png" && format != "jpeg" && format != "jpg" {
-		return "", ErrUnsupportedFormat
-	}
-
 	// 3. Preprocess the image
 	preprocessedImage := preprocessImage(decodedImage, config)
-	if config.Debug {
+	if config.Debug && config.DebugParameter.PreprocessedImagePath != "" {
 		if err := saveImage(preprocessedImage, format, config.DebugParameter.PreprocessedImagePath); err != nil {
 			return "", err
 		}
 	}
 
-	hash := generateHash(preprocessedImage)
-	if config.Debug {
+	// 4. Hash the preprocessed image
+	hash, dctMatrix, err := hashGray(preprocessedImage, config)
+	if err != nil {
+		return "", err
+	}
+	if config.Debug && config.DebugParameter.VisualizedImagePath != "" {
 		if err := visualizeHash(hash, format, config); err != nil {
 			return "", err
 		}
 	}
-
-	return fmt.Sprintf("%016x", hash), nil
-}
-
-// CompareHashes compares two perceptual hashes and returns the Hamming distance.
-// The distance is the number of differing bits between the two hashes.
-func CompareHashes(hash1, hash2 string) (int, error) {
-	if len(hash1) != len(hash2) {
-		return 0, fmt.Errorf("hashes must be of the same length")
-	}
-
-	distance := 0
-	for i := 0; i < len(hash1); i++ {
-		if hash1[i] != hash2[i] {
-			distance++
+	if config.Debug && config.DebugParameter.ReportPath != "" {
+		report := debugReport{
+			Source:       filePath,
+			Original:     decodedImage,
+			Preprocessed: preprocessedImage,
+			DCT:          dctMatrix,
+			Hash:         hash,
+		}
+		if err := report.write(config.DebugParameter.ReportPath); err != nil {
+			return "", err
 		}
 	}
 
-	return distance, nil
-}
-
-// preprocessImage resizes the image to 32x32 and converts it to grayscale.
-func preprocessImage(inputImage image.Image, config Config) *image.Gray {
-	resizedImage := image.NewGray(image.Rect(0, 0, 32, 32))
-	draw.CatmullRom.Scale(resizedImage, resizedImage.Bounds(), inputImage, inputImage.Bounds(), draw.Over, nil)
-
-	return resizedImage
+	return fmt.Sprintf("%016x", hash), nil
 }
 
 // saveImage writes the given image to location in the specified format.
@@ -124,72 +327,6 @@ func saveImage(img image.Image, format string, location string) error {
 	return nil
 }
 
-// generateHash computes the DCT-based 64-bit hash from a 32x32 grayscale image.
-func generateHash(img *image.Gray) uint64 {
-	var pixels [][]float64
-	for y := 0; y < 32; y++ {
-		row := make([]float64, 32)
-		for x := 0; x < 32; x++ {
-			grayColor := img.GrayAt(x, y)
-			row[x] = float64(grayColor.Y)
-		}
-		pixels = append(pixels, row)
-	}
-
-	dctMatrix := dct(pixels)
-	var dctValues []float64
-	for y := 0; y < 8; y++ {
-		for x := 0; x < 8; x++ {
-			dctValues = append(dctValues, dctMatrix[y][x])
-		}
-	}
-
-	var sum float64
-	for i := 1; i < len(dctValues); i++ {
-		sum += dctValues[i]
-	}
-	average := sum / 63
-
-	var hash uint64
-	for i, value := range dctValues {
-		if i > 0 && value > average {
-			hash |= 1 << i
-		}
-	}
-
-	return hash
-}
-
-// dct performs a 2D Discrete Cosine Transform on the input matrix.
-func dct(matrix [][]float64) [][]float64 {
-	N := len(matrix)
-	dct := make([][]float64, N)
-	for u := 0; u < N; u++ {
-		dct[u] = make([]float64, N)
-		for v := 0; v < N; v++ {
-			sum := 0.0
-			for x := 0; x < N; x++ {
-				for y := 0; y < N; y++ {
-					sum += matrix[x][y] *
-						math.Cos((float64(2*x+1)*float64(u)*math.Pi)/(2*float64(N))) *
-						math.Cos((float64(2*y+1)*float64(v)*math.Pi)/(2*float64(N)))
-				}
-			}
-
-			cu := 1.0
-			cv := 1.0
-			if u == 0 {
-				cu = 1 / math.Sqrt2
-			}
-			if v == 0 {
-				cv = 1 / math.Sqrt2
-			}
-			dct[u][v] = 0.25 * cu * cv * sum
-		}
-	}
-	return dct
-}
-
 // visualizeHash creates a small 8x8 image from hash bits for debugging.
 func visualizeHash(hash uint64, format string, config Config) error {
 	size := 8
@@ -0,0 +1,142 @@
+package perceptualhash
+
+import (
+	"bytes"
+	"image/jpeg"
+	"slices"
+	"strings"
+
+	"github.com/insomnius/tools/internal/tiff"
+)
+
+// TIFF tags read to find the previews embedded in RAW files.
+const (
+	tagCompression     = 0x103
+	tagPhotometric     = 0x106
+	tagMake            = 0x10f
+	tagStripOffsets    = 0x111
+	tagStripByteCounts = 0x117
+	tagSubIFDs         = 0x14a
+	tagJPEGOffset      = 0x201
+	tagJPEGLength      = 0x202
+	tagDNGVersion      = 0xc612
+)
+
+// Values of the Compression and PhotometricInterpretation tags marking the
+// sensor data of NEF files.
+const (
+	compressionNEF = 34713
+	photometricCFA = 32803
+)
+
+// maxRAWDirectories bounds the directories visited in a RAW file.
+const maxRAWDirectories = 64
+
+// rawFormat identifies a RAW camera file by its TIFF structure: "cr2",
+// "nef" or "dng", or "" for other data.
+func rawFormat(data []byte) string {
+	directories, file := tiffDirectories(data)
+	if len(directories) == 0 {
+		return ""
+	}
+	if len(data) >= 10 && string(data[8:10]) == "CR" {
+		return "cr2"
+	}
+
+	fields, err := file.Directory(directories[0])
+	if err != nil {
+		return ""
+	}
+	if _, ok := fields[tagDNGVersion]; ok {
+		return "dng"
+	}
+	if maker, ok := fields[tagMake]; ok && maker.Type == tiff.ASCII {
+		if strings.HasPrefix(strings.ToUpper(string(maker.Value)), "NIKON") && hasNEFData(file, fields) {
+			return "nef"
+		}
+	}
+	return ""
+}
+
+// hasNEFData reports whether one of the SubIFDs of the first directory,
+// given by its fields, holds NEF sensor data, telling NEF files apart from
+// ordinary TIFF files written by Nikon scanners and software.
+func hasNEFData(file *tiff.File, fields map[uint16]tiff.Field) bool {
+	sub, ok := fields[tagSubIFDs]
+	if !ok {
+		return false
+	}
+	for i := range min(int(sub.Count), maxRAWDirectories) {
+		offset, _ := file.Uint(sub, i)
+		subFields, err := file.Directory(offset)
+		if err != nil {
+			continue
+		}
+		if compression, ok := file.Uint(subFields[tagCompression], 0); ok && compression == compressionNEF {
+			return true
+		}
+		if photometric, ok := file.Uint(subFields[tagPhotometric], 0); ok && photometric == photometricCFA {
+			return true
+		}
+	}
+	return false
+}
+
+// rawPreview returns the largest JPEG preview embedded in a RAW file that
+// image/jpeg can decode, skipping the lossless JPEG raw data of DNG and CR2
+// files. It returns nil if there is none.
+func rawPreview(data []byte) []byte {
+	directories, file := tiffDirectories(data)
+
+	var candidates [][]byte
+	add := func(offset, length uint32) {
+		end := uint64(offset) + uint64(length)
+		if length > 2 && end <= uint64(len(data)) && bytes.HasPrefix(data[offset:], []byte{0xff, 0xd8}) {
+			candidates = append(candidates, data[offset:end])
+		}
+	}
+
+	// Previews are in the main directories and in their SubIFDs.
+	seen := map[uint32]bool{}
+	for len(directories) > 0 && len(seen) < maxRAWDirectories {
+		offset := directories[0]
+		directories = directories[1:]
+		if seen[offset] {
+			continue
+		}
+		seen[offset] = true
+
+		fields, err := file.Directory(offset)
+		if err != nil {
+			continue
+		}
+		if start, ok := file.Uint(fields[tagJPEGOffset], 0); ok {
+			if length, ok := file.Uint(fields[tagJPEGLength], 0); ok {
+				add(start, length)
+			}
+		}
+		if compression, ok := file.Uint(fields[tagCompression], 0); ok && (compression == 6 || compression == 7) {
+			strips, counts := fields[tagStripOffsets], fields[tagStripByteCounts]
+			if strips.Count == 1 && counts.Count == 1 {
+				start, _ := file.Uint(strips, 0)
+				length, _ := file.Uint(counts, 0)
+				add(start, length)
+			}
+		}
+		if sub, ok := fields[tagSubIFDs]; ok {
+			for i := range min(int(sub.Count), maxRAWDirectories) {
+				if offset, ok := file.Uint(sub, i); ok {
+					directories = append(directories, offset)
+				}
+			}
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b []byte) int { return len(b) - len(a) })
+	for _, candidate := range candidates {
+		if _, err := jpeg.DecodeConfig(bytes.NewReader(candidate)); err == nil {
+			return candidate
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package perceptualhash_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// tiffField is an entry of a directory written by grayTIFF.
+type tiffField struct {
+	tag, kind uint16
+	values    []uint32
+}
+
+// grayTIFF returns a little-endian, uncompressed 8-bit grayscale TIFF file
+// of a 48x48 gradient, with the given Make and, if subIFD is not nil, a
+// SubIFD holding its fields.
+func grayTIFF(maker string, subIFD []tiffField) []byte {
+	const size = 48
+	pixels := make([]byte, size*size)
+	for y := range size {
+		for x := range size {
+			pixels[y*size+x] = byte(x*5 ^ y*3)
+		}
+	}
+
+	fields := []tiffField{
+		{0x100, 3, []uint32{size}},
+		{0x101, 3, []uint32{size}},
+		{0x102, 3, []uint32{8}},
+		{0x103, 3, []uint32{1}},
+		{0x106, 3, []uint32{1}},
+		{0x10f, 2, nil},
+		{0x111, 4, nil},
+		{0x116, 3, []uint32{size}},
+		{0x117, 4, []uint32{size * size}},
+	}
+	if subIFD != nil {
+		fields = append(fields, tiffField{0x14a, 4, nil})
+	}
+	// The file holds the header, the directory, the Make string, the SubIFD
+	// and the pixels.
+	makeOffset := uint32(8 + 2 + 12*len(fields) + 4)
+	subOffset := makeOffset + uint32(len(maker)+1)
+	pixelOffset := subOffset + uint32(2+12*len(subIFD)+4)
+
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	writeDirectory := func(fields []tiffField) {
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(fields)))
+		for _, f := range fields {
+			data = binary.LittleEndian.AppendUint16(data, f.tag)
+			data = binary.LittleEndian.AppendUint16(data, f.kind)
+			var count, value uint32 = 1, 0
+			switch f.tag {
+			case 0x10f:
+				count, value = uint32(len(maker)+1), makeOffset
+			case 0x111:
+				value = pixelOffset
+			case 0x14a:
+				value = subOffset
+			default:
+				value = f.values[0]
+			}
+			data = binary.LittleEndian.AppendUint32(data, count)
+			data = binary.LittleEndian.AppendUint32(data, value)
+		}
+		data = binary.LittleEndian.AppendUint32(data, 0)
+	}
+	writeDirectory(fields)
+	data = append(data, maker...)
+	data = append(data, 0)
+	writeDirectory(subIFD)
+	return append(data, pixels...)
+}
+
+func TestNikonTIFFDecodes(t *testing.T) {
+	if _, err := new(perceptualhash.DCTHasher).FromBytes(grayTIFF("NIKON CORPORATION", nil)); err != nil {
+		t.Fatalf("Nikon TIFF without sensor data: %v", err)
+	}
+}
+
+func TestNEFWithoutPreviewFallsBack(t *testing.T) {
+	cfa := []tiffField{{0x103, 3, []uint32{34713}}, {0x106, 3, []uint32{32803}}}
+	want, err := new(perceptualhash.DCTHasher).FromBytes(grayTIFF("NIKON CORPORATION", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := new(perceptualhash.DCTHasher).FromBytes(grayTIFF("NIKON CORPORATION", cfa))
+	if err != nil {
+		t.Fatalf("NEF without a JPEG preview: %v", err)
+	}
+	if got != want {
+		t.Errorf("NEF fallback hash = %s, want the TIFF hash %s", got, want)
+	}
+}
+
+func TestRAWWithoutAnyImage(t *testing.T) {
+	cfa := []tiffField{{0x103, 3, []uint32{34713}}, {0x106, 3, []uint32{32803}}}
+	data := grayTIFF("NIKON CORPORATION", cfa)
+	// With NEF compression in the first directory too, the TIFF decoder
+	// cannot decode it either.
+	for i := 10; i+12 <= len(data); i += 12 {
+		if binary.LittleEndian.Uint16(data[i:]) == 0x103 {
+			binary.LittleEndian.PutUint32(data[i+8:], 34713)
+			break
+		}
+	}
+	if _, err := new(perceptualhash.DCTHasher).FromBytes(data); !errors.Is(err, perceptualhash.ErrNoPreview) {
+		t.Errorf("err = %v, want ErrNoPreview", err)
+	}
+}
@@ -0,0 +1,135 @@
+package perceptualhash
+
+import (
+	"image"
+	"sync"
+)
+
+// Image is a decoded image whose intermediate results are shared by all
+// the hashes computed from it: an ensemble of algorithms or several
+// compatibility configurations decode it once, and DCT hashes that only
+// differ in DCMode, Coefficients or Order also share the downsampled image
+// and its DCT. Hashes are identical to those computed separately. It is
+// safe for concurrent use.
+type Image struct {
+	img    image.Image
+	format string
+
+	mu sync.Mutex
+	// prepared holds the preprocessed image and its DCTs by the options
+	// affecting preprocessing.
+	prepared map[preprocessKey]*preparedImage
+}
+
+// preprocessKey holds the options of preprocessImage.
+type preprocessKey struct {
+	watermark    WatermarkMode
+	suppressText bool
+	smartCrop    bool
+	centerWeight float64
+}
+
+type preparedImage struct {
+	gray       *image.Gray
+	lowEntropy bool
+	// dct is the floating-point DCT, computed on first use, and fixed the
+	// fixed-point one, grown to the largest block used so far.
+	dct   [][]float64
+	fixed [][]int64
+}
+
+// NewImage wraps an already decoded image.
+func NewImage(img image.Image) *Image {
+	return &Image{img: img, prepared: map[preprocessKey]*preparedImage{}}
+}
+
+// DecodeShared decodes an encoded image as Decode does, for hashing it
+// several times.
+func DecodeShared(data []byte) (*Image, error) {
+	img, format, err := decodeImageData(data)
+	if err != nil {
+		return nil, err
+	}
+	shared := NewImage(img)
+	shared.format = format
+	return shared, nil
+}
+
+// Image returns the decoded image.
+func (im *Image) Image() image.Image {
+	return im.img
+}
+
+// Format returns the name of the decoder for images from DecodeShared, and
+// "" otherwise.
+func (im *Image) Format() string {
+	return im.format
+}
+
+// Hash computes the DCT hash of the image, as DCTHasher.Hash does.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and Image.HashWith.
+func (im *Image) Hash(configs ...Config) (Hash, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return 0, err
+	}
+	return im.HashWith(h)
+}
+
+// dctHash computes the DCT hash of the image with config, sharing the
+// preprocessed image and its DCT between configurations.
+func (im *Image) dctHash(config Config) (Hash, error) {
+	if bounds := im.img.Bounds(); bounds.Dx() < workingSize || bounds.Dy() < workingSize {
+		return 0, ErrImageTooSmall
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	key := preprocessKey{config.Watermark, config.SuppressText, config.SmartCrop, config.CenterWeight}
+	p := im.prepared[key]
+	if p == nil {
+		gray := preprocessImage(im.img, config)
+		p = &preparedImage{gray: gray, lowEntropy: stdDev(gray) < minStdDev}
+		im.prepared[key] = p
+	}
+	if p.lowEntropy {
+		return 0, ErrLowEntropyImage
+	}
+
+	if config.Transform == FixedPointDCT {
+		if size := max(fixedBlock, coefficientExtent(config)); len(p.fixed) < size {
+			p.fixed = fixedDCT(p.gray, size)
+		}
+		return Hash(generateFixedHash(p.fixed, config)), nil
+	}
+	if p.dct == nil {
+		p.dct = dct(grayPixels(p.gray, nil))
+	}
+	return Hash(generateHash(p.dct, config)), nil
+}
+
+// HashWith computes the hash of the image with h. DCTHasher hashes share
+// the intermediates of Hash; other hashers share the decoded image.
+func (im *Image) HashWith(h Hasher) (Hash, error) {
+	if dctHasher, ok := h.(*DCTHasher); ok {
+		return im.dctHash(dctHasher.config)
+	}
+	return h.Hash(im.img)
+}
+
+// HashAll computes the hashes of the image with every hasher, by name. It
+// stops at the first error.
+func (im *Image) HashAll(hashers ...Hasher) (map[string]Hash, error) {
+	hashes := make(map[string]Hash, len(hashers))
+	for _, h := range hashers {
+		hash, err := im.HashWith(h)
+		if err != nil {
+			return nil, err
+		}
+		hashes[h.Name()] = hash
+	}
+	return hashes, nil
+}
@@ -0,0 +1,78 @@
+package perceptualhash
+
+import (
+	"cmp"
+	"context"
+	"slices"
+)
+
+// Similar is a file found by FindSimilar.
+type Similar struct {
+	Path string
+	Hash string
+	// Distance is the number of differing bits from the query hash.
+	Distance int
+}
+
+// FindSimilar returns the topK files under root closest to the image at
+// queryPath.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FindSimilar.
+func FindSimilar(ctx context.Context, queryPath, root string, topK int, configs ...Config) ([]Similar, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return nil, err
+	}
+	return h.FindSimilar(ctx, queryPath, root, topK)
+}
+
+// FindSimilar hashes the image at queryPath and the images under root and
+// returns the topK files closest to the query, closest first, with ties
+// broken by path. Files are hashed concurrently as by HashDirStream; those
+// that cannot be hashed are skipped. The hash tolerates resizing,
+// recompression and mild crops; to find the photo a small cut-out was
+// taken from, use Locate on the candidates. Debug artifacts are not
+// written.
+func (h *DCTHasher) FindSimilar(ctx context.Context, queryPath, root string, topK int) ([]Similar, error) {
+	config := h.config
+	config.Debug = false
+
+	query, err := hashFile(queryPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if topK <= 0 {
+		return nil, nil
+	}
+
+	better := func(a, b Similar) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.Path, b.Path))
+	}
+	best := make([]Similar, 0, topK+1)
+	results, errc := hashDirStream(ctx, osSource(root), config)
+	for result := range results {
+		if result.Err != nil {
+			continue
+		}
+		hash, err := ParseHash(result.Hash)
+		if err != nil {
+			continue
+		}
+		distance := query.Distance(hash)
+
+		candidate := Similar{Path: result.Path, Hash: result.Hash, Distance: distance}
+		if len(best) == topK && better(candidate, best[topK-1]) >= 0 {
+			continue
+		}
+		i, _ := slices.BinarySearchFunc(best, candidate, better)
+		best = slices.Insert(best, i, candidate)
+		if len(best) > topK {
+			best = best[:topK]
+		}
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return best, nil
+}
@@ -0,0 +1,76 @@
+package perceptualhash
+
+import (
+	"image"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// AverageHash computes the 64-bit average hash (aHash) of img: each bit
+// tells whether a pixel of the 8x8 grayscale thumbnail is brighter than the
+// mean. It is much cheaper than the DCT hash but less robust, which makes it
+// suited to prefiltering candidates.
+func AverageHash(img image.Image) Hash {
+	small := imgresize.Gray(img, 8, 8, imgresize.Config{Filter: imgresize.Box})
+
+	var sum int
+	for _, value := range small.Pix {
+		sum += int(value)
+	}
+
+	var hash Hash
+	for i, value := range small.Pix {
+		if int(value)*len(small.Pix) > sum {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+// DifferenceHash computes the 64-bit difference hash (dHash) of img: each
+// bit tells whether a pixel of the 9x8 grayscale thumbnail is brighter than
+// its right neighbor. Like AverageHash it is cheap, and it tracks gradients
+// rather than absolute brightness.
+func DifferenceHash(img image.Image) Hash {
+	small := imgresize.Gray(img, 9, 8, imgresize.Config{Filter: imgresize.Box})
+
+	var hash Hash
+	for y := range 8 {
+		row := small.Pix[y*small.Stride:]
+		for x := range 8 {
+			if row[x] > row[x+1] {
+				hash |= 1 << (y*8 + x)
+			}
+		}
+	}
+	return hash
+}
+
+// averageHasher and differenceHasher expose AverageHash and DifferenceHash
+// as Hashers.
+type (
+	averageHasher    struct{}
+	differenceHasher struct{}
+)
+
+func (averageHasher) Hash(img image.Image) (Hash, error) {
+	if img.Bounds().Empty() {
+		return 0, ErrImageTooSmall
+	}
+	return AverageHash(img), nil
+}
+
+func (averageHasher) Name() string { return "ahash" }
+
+func (averageHasher) Bits() int { return 64 }
+
+func (differenceHasher) Hash(img image.Image) (Hash, error) {
+	if img.Bounds().Empty() {
+		return 0, ErrImageTooSmall
+	}
+	return DifferenceHash(img), nil
+}
+
+func (differenceHasher) Name() string { return "dhash" }
+
+func (differenceHasher) Bits() int { return 64 }
@@ -0,0 +1,78 @@
+package perceptualhash
+
+import (
+	"image"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+const (
+	// saliencySize is the width and height saliency is measured at.
+	saliencySize = 128
+	// saliencyTrim is the fraction of the average edge energy of a row or
+	// column below which it counts as empty.
+	saliencyTrim = 0.1
+)
+
+// salientRegion returns the part of source that holds the informative
+// content of img, by trimming rows and columns from each side for as long as
+// they hold almost no edge energy. Plain backgrounds and margins are dropped,
+// so a product shot and a tightly cropped copy of it reduce to about the same
+// region, while images filled with detail are left whole.
+func salientRegion(img image.Image, source image.Rectangle) image.Rectangle {
+	small := imgresize.Gray(img, saliencySize, saliencySize, imgresize.Config{Source: source})
+
+	var rows, columns [saliencySize]float64
+	var total float64
+	for y := range saliencySize {
+		for x := range saliencySize {
+			i := small.PixOffset(x, y)
+			v := int(small.Pix[i])
+			var energy float64
+			if x+1 < saliencySize {
+				energy += float64(abs(v - int(small.Pix[i+1])))
+			}
+			if y+1 < saliencySize {
+				energy += float64(abs(v - int(small.Pix[i+small.Stride])))
+			}
+			rows[y] += energy
+			columns[x] += energy
+			total += energy
+		}
+	}
+	if total == 0 {
+		return source
+	}
+
+	limit := total / saliencySize * saliencyTrim
+	trim := func(sums *[saliencySize]float64, from, step int) int {
+		i := from
+		for i >= 0 && i < saliencySize && sums[i] < limit {
+			i += step
+		}
+		return i
+	}
+	// An edge between pixels i and i+1 is counted at i, so shift the sums
+	// for trimming from the start, where the edge belongs to pixel i+1, or
+	// trimming would stop one pixel into a plain margin.
+	shift := func(sums [saliencySize]float64) *[saliencySize]float64 {
+		copy(sums[1:], sums[:saliencySize-1])
+		return &sums
+	}
+	left, right := trim(shift(columns), 0, 1), trim(&columns, saliencySize-1, -1)+1
+	top, bottom := trim(shift(rows), 0, 1), trim(&rows, saliencySize-1, -1)+1
+	if right-left <= 0 || bottom-top <= 0 {
+		return source
+	}
+
+	region := image.Rect(
+		source.Min.X+left*source.Dx()/saliencySize,
+		source.Min.Y+top*source.Dy()/saliencySize,
+		source.Min.X+right*source.Dx()/saliencySize,
+		source.Min.Y+bottom*source.Dy()/saliencySize,
+	)
+	if region.Dx() < workingSize || region.Dy() < workingSize {
+		return source
+	}
+	return region
+}
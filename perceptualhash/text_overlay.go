@@ -0,0 +1,201 @@
+package perceptualhash
+
+import (
+	"image"
+	"slices"
+)
+
+const (
+	// textSize is the width and height text detection works at.
+	textSize = 128
+	// textBlock is the side of the square blocks classified as text or not.
+	textBlock = 8
+	// textEdge is the intensity step counted as a sharp text edge.
+	textEdge = 96
+	// textMinEdges is the number of sharp edges making a block text-like.
+	textMinEdges = 8
+	// textMinExtremes is the number of near-white or near-black pixels, the
+	// usual caption colors, a text block must contain.
+	textMinExtremes = 4
+	// textMinRun is the number of horizontally adjacent text-like blocks
+	// forming a line of text.
+	textMinRun = 3
+	// textInpaintPasses is the number of smoothing passes filling text in.
+	textInpaintPasses = 40
+)
+
+// suppressText finds blocks of img that look like overlaid text and fills
+// the glyphs in from their surroundings. Text blocks are dense in sharp edges,
+// contain pure white or black pixels, and come in horizontal runs; isolated
+// blocks matching the first two are more likely texture. If more than half
+// of the image looks like text, it is left unchanged. It reports whether img
+// was modified.
+func suppressText(img *image.Gray) bool {
+	const blocks = textSize / textBlock
+
+	var candidate [blocks][blocks]bool
+	for by := range blocks {
+		for bx := range blocks {
+			candidate[by][bx] = textLike(img, bx*textBlock, by*textBlock)
+		}
+	}
+
+	// Keep runs of at least textMinRun candidates, then grow them by a block
+	// up and down, since text lines rarely align with the block grid.
+	var text [blocks][blocks]bool
+	for by := range blocks {
+		for start := 0; start < blocks; {
+			end := start
+			for end < blocks && candidate[by][end] {
+				end++
+			}
+			if end-start >= textMinRun {
+				for bx := start; bx < end; bx++ {
+					for dy := -1; dy <= 1; dy++ {
+						if y := by + dy; y >= 0 && y < blocks {
+							text[y][bx] = true
+						}
+					}
+				}
+			}
+			start = end + 1
+		}
+	}
+
+	count := 0
+	for by := range blocks {
+		for bx := range blocks {
+			if text[by][bx] {
+				count++
+			}
+		}
+	}
+	if count == 0 || count > blocks*blocks/2 {
+		return false
+	}
+
+	// Within text regions, only mask the glyph pixels themselves and their
+	// immediate neighbors, so the background between letters survives.
+	// Strokes are thin at this size, so glyph pixels stand out from the
+	// median of their neighborhood, while dark or bright backgrounds don't.
+	glyph := make([]bool, len(img.Pix))
+	for y := range textSize {
+		for x := range textSize {
+			if !text[y/textBlock][x/textBlock] || abs(int(img.GrayAt(x, y).Y)-localMedian(img, x, y)) < textEdge/2 {
+				continue
+			}
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if nx, ny := x+dx, y+dy; nx >= 0 && nx < textSize && ny >= 0 && ny < textSize {
+						glyph[ny*textSize+nx] = true
+					}
+				}
+			}
+		}
+	}
+	masked := func(x, y int) bool {
+		return glyph[y*textSize+x]
+	}
+	inpaint(img, masked)
+	return true
+}
+
+// textLike reports whether the block at x0, y0 has the edge density and
+// extreme intensities of overlaid text.
+func textLike(img *image.Gray, x0, y0 int) bool {
+	edges, extremes := 0, 0
+	for y := y0; y < y0+textBlock; y++ {
+		for x := x0; x < x0+textBlock; x++ {
+			value := int(img.GrayAt(x, y).Y)
+			if extreme(uint8(value)) {
+				extremes++
+			}
+			if x+1 < textSize && abs(value-int(img.GrayAt(x+1, y).Y)) >= textEdge {
+				edges++
+			}
+			if y+1 < textSize && abs(value-int(img.GrayAt(x, y+1).Y)) >= textEdge {
+				edges++
+			}
+		}
+	}
+	return edges >= textMinEdges && extremes >= textMinExtremes
+}
+
+// localMedian returns the median intensity of the 5x5 neighborhood of x, y,
+// clipped to the image.
+func localMedian(img *image.Gray, x, y int) int {
+	var values []int
+	for ny := max(y-2, 0); ny <= min(y+2, textSize-1); ny++ {
+		for nx := max(x-2, 0); nx <= min(x+2, textSize-1); nx++ {
+			values = append(values, int(img.GrayAt(nx, ny).Y))
+		}
+	}
+	slices.Sort(values)
+	return values[len(values)/2]
+}
+
+// inpaint replaces the masked pixels of img by diffusing the surrounding
+// unmasked pixels into them.
+func inpaint(img *image.Gray, masked func(x, y int) bool) {
+	size := img.Bounds().Dx()
+	values := make([]float64, len(img.Pix))
+	var sum, count float64
+	for y := range size {
+		for x := range size {
+			if !masked(x, y) {
+				sum += float64(img.GrayAt(x, y).Y)
+				count++
+			}
+		}
+	}
+	mean := sum / count
+	for y := range size {
+		for x := range size {
+			i := y*size + x
+			values[i] = float64(img.GrayAt(x, y).Y)
+			if masked(x, y) {
+				values[i] = mean
+			}
+		}
+	}
+
+	for range textInpaintPasses {
+		for y := range size {
+			for x := range size {
+				if !masked(x, y) {
+					continue
+				}
+				var total, n float64
+				for _, d := range [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+					nx, ny := x+d[0], y+d[1]
+					if nx >= 0 && nx < size && ny >= 0 && ny < size {
+						total += values[ny*size+nx]
+						n++
+					}
+				}
+				values[y*size+x] = total / n
+			}
+		}
+	}
+
+	for y := range size {
+		for x := range size {
+			if masked(x, y) {
+				img.Pix[img.PixOffset(x, y)] = uint8(values[y*size+x] + 0.5)
+			}
+		}
+	}
+}
+
+// extreme reports whether value is near white or near black, the usual
+// caption colors.
+func extreme(value uint8) bool {
+	return value >= 220 || value <= 35
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,86 @@
+package perceptualhash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+
+	"github.com/insomnius/tools/internal/tiff"
+	_ "golang.org/x/image/tiff"
+)
+
+// ErrPageOutOfRange is returned by PageFromPath for pages a file does not
+// have.
+var ErrPageOutOfRange = errors.New("page out of range")
+
+// maxTIFFPages bounds the directories followed in a TIFF file, so corrupt
+// files cannot make page listing run away.
+const maxTIFFPages = 1 << 16
+
+// PageFromPath computes the perceptual hash of one page of the multi-page
+// TIFF file at filePath.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.PageFromPath.
+func PageFromPath(filePath string, page int, configs ...Config) (string, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return "", err
+	}
+	return h.PageFromPath(filePath, page)
+}
+
+// PageFromPath computes the perceptual hash of one page of the multi-page
+// TIFF file at filePath, counting from 0. FromPath hashes the first page;
+// FramesFromPath hashes all of them. Other images only have page 0.
+func (h *DCTHasher) PageFromPath(filePath string, page int) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	if frameCount(data) <= 1 {
+		if page != 0 {
+			return "", ErrPageOutOfRange
+		}
+		return h.FromBytes(data)
+	}
+
+	directories, file := tiffDirectories(data)
+	if page < 0 || page >= len(directories) {
+		return "", ErrPageOutOfRange
+	}
+	return h.FromBytes(tiffPage(data, file.Order, directories[page]))
+}
+
+// tiffPageFrames hashes every page of a TIFF file with h.
+func tiffPageFrames(data []byte, h *DCTHasher) []Frame {
+	directories, file := tiffDirectories(data)
+	frames := make([]Frame, len(directories))
+	for i, offset := range directories {
+		frames[i].Index = i
+		frames[i].Hash, frames[i].Err = h.FromBytes(tiffPage(data, file.Order, offset))
+	}
+	return frames
+}
+
+// tiffDirectories returns the offsets of the image file directories of a
+// TIFF file, one per page, along with the parsed file. It returns nil for
+// other data.
+func tiffDirectories(data []byte) ([]uint32, *tiff.File) {
+	file, err := tiff.Parse(data)
+	if err != nil {
+		return nil, nil
+	}
+	return file.Directories(maxTIFFPages), file
+}
+
+// tiffPage returns a copy of a TIFF file whose first page is the page at
+// the given directory offset. Image data is addressed by absolute offsets,
+// so only the header needs to point elsewhere.
+func tiffPage(data []byte, order binary.ByteOrder, offset uint32) []byte {
+	page := bytes.Clone(data)
+	order.PutUint32(page[4:8], offset)
+	return page
+}
@@ -0,0 +1,116 @@
+package perceptualhash
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timing is the time spent in each stage of hashing one image, for finding
+// the slow stage in production without a profiler. Stages that did not run,
+// such as decoding on a cache hit, are zero.
+type Timing struct {
+	Read       time.Duration
+	Decode     time.Duration
+	Preprocess time.Duration
+	// Transform covers the DCT and the hash computed from it.
+	Transform time.Duration
+}
+
+// Total returns the time spent in all stages.
+func (t Timing) Total() time.Duration {
+	return t.Read + t.Decode + t.Preprocess + t.Transform
+}
+
+// ImageInfo describes a hashed image file.
+type ImageInfo struct {
+	// Format is the name of the decoder, such as "jpeg" or "png".
+	Format string
+	Width  int
+	Height int
+	// Size is the length of the encoded file in bytes.
+	Size int64
+	// Frames is the number of frames of an animated PNG, whose hash is that
+	// of the default image, or of pages of a TIFF file, whose hash is that of
+	// the first page, and 1 for still images. See FramesFromPath.
+	Frames int
+}
+
+// FromPathResult is like FromPath but returns the hash in a Result.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FromPathResult.
+func FromPathResult(filePath string, configs ...Config) (Result, error) {
+	h, err := newHasher(configs)
+	if err != nil {
+		return Result{Path: filePath}, err
+	}
+	return h.FromPathResult(filePath)
+}
+
+// FromPathResult is like FromPath but returns the hash in a Result, along
+// with the time spent in each stage and the image metadata. The error is
+// returned rather than stored in Result.Err. Debug artifacts are not
+// written.
+func (h *DCTHasher) FromPathResult(filePath string) (Result, error) {
+	result := timedHash(filePath, readFile, h.config)
+	err := result.Err
+	result.Err = nil
+	return result, err
+}
+
+// timedHash reads the file at path with load and hashes it, recording the
+// time spent in each stage.
+func timedHash(path string, load func(string, Config) ([]byte, func(), error), config Config) Result {
+	result := Result{Path: path}
+
+	start := time.Now()
+	data, release, err := load(path, config)
+	result.Timing.Read = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer release()
+	result.Image.Size = int64(len(data))
+	if config.Pipeline.Checksum {
+		result.SHA256 = checksum(data)
+	}
+
+	var key string
+	if config.Pipeline.Cache != nil {
+		key = CacheKey(data, config)
+		if hash, ok := config.Pipeline.Cache.Get(key); ok {
+			result.Hash = hash
+			return result
+		}
+	}
+
+	start = time.Now()
+	img, format, err := decodeImageData(data)
+	result.Timing.Decode = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	bounds := img.Bounds()
+	result.Image.Format, result.Image.Width, result.Image.Height = format, bounds.Dx(), bounds.Dy()
+	result.Image.Frames = max(frameCount(data), 1)
+
+	start = time.Now()
+	gray := preprocessImage(img, config)
+	result.Timing.Preprocess = time.Since(start)
+
+	start = time.Now()
+	hash, _, err := hashGray(gray, config)
+	result.Timing.Transform = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Hash = fmt.Sprintf("%016x", hash)
+	if config.Pipeline.Cache != nil {
+		config.Pipeline.Cache.Set(key, result.Hash)
+	}
+	return result
+}
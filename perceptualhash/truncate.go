@@ -0,0 +1,99 @@
+package perceptualhash
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+var ErrHashLength = errors.New("hash length is not supported")
+
+// TruncateHash derives a shorter hash from a longer one by keeping its
+// lowest frequencies, e.g. the 64-bit hash of the 8x8 block from a 256-bit
+// hash of a 16x16 block. Hashes are hexadecimal strings in the layout of
+// Hash: bit i, counting from the least significant, describes coefficient i
+// of a square block in row-major order. size is the number of bits to keep;
+// both lengths must be square numbers of bits, multiples of 4.
+//
+// The coefficients were thresholded against the average of the larger
+// block, so a truncated hash may differ from one computed at the smaller
+// size in a few bits. During a migration, compare truncated hashes with
+// each other, or allow for slightly larger distances against natively
+// computed ones.
+func TruncateHash(hash string, size int) (string, error) {
+	side, ok := hashSide(4 * len(hash))
+	newSide, newOK := hashSide(size)
+	if !ok || !newOK || newSide > side {
+		return "", fmt.Errorf("%w: cannot truncate %d bits to %d", ErrHashLength, 4*len(hash), size)
+	}
+
+	value, ok := new(big.Int).SetString(hash, 16)
+	if !ok {
+		return "", fmt.Errorf("invalid hash %q", hash)
+	}
+
+	truncated := new(big.Int)
+	for row := range newSide {
+		for col := range newSide {
+			truncated.SetBit(truncated, row*newSide+col, value.Bit(row*side+col))
+		}
+	}
+	return fmt.Sprintf("%0*x", size/4, truncated), nil
+}
+
+// hashSide returns the side of the square block described by a hash of n
+// bits, if it is a whole number and n is a whole number of hex digits.
+func hashSide(n int) (int, bool) {
+	if n <= 0 || n%4 != 0 {
+		return 0, false
+	}
+	side := 1
+	for side*side < n {
+		side++
+	}
+	return side, side*side == n
+}
+
+// CompareMixedHashes returns the number of differing bits between two
+// hashes of possibly different lengths, such as a catalog of 64-bit hashes
+// and one of 256-bit hashes being migrated, by truncating the longer hash
+// to the length of the shorter one with TruncateHash. Unlike CompareHashes,
+// it counts bits rather than hex digits.
+func CompareMixedHashes(hash1, hash2 string) (int, error) {
+	if len(hash1) < len(hash2) {
+		hash1, hash2 = hash2, hash1
+	}
+	if len(hash1) != len(hash2) {
+		var err error
+		if hash1, err = TruncateHash(hash1, 4*len(hash2)); err != nil {
+			return 0, err
+		}
+	}
+
+	distance := 0
+	for i := range len(hash1) {
+		a, err := hexDigit(hash1[i])
+		if err != nil {
+			return 0, err
+		}
+		b, err := hexDigit(hash2[i])
+		if err != nil {
+			return 0, err
+		}
+		distance += bits.OnesCount8(a ^ b)
+	}
+	return distance, nil
+}
+
+func hexDigit(c byte) (uint8, error) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', nil
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, nil
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, nil
+	}
+	return 0, fmt.Errorf("invalid hex digit %q", c)
+}
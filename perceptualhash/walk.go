@@ -0,0 +1,134 @@
+package perceptualhash
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+)
+
+// fileKey identifies a file or directory independently of the path it was
+// reached through.
+type fileKey struct {
+	dev, ino uint64
+	// path is the resolved path, used where fileID is unavailable.
+	path string
+}
+
+// eachFile walks src and calls fn with every file selected by config, and
+// with the error for every entry that cannot be read. Errors returned by fn
+// stop the walk; fs.SkipAll stops it without error.
+func (src source) eachFile(config Config, fn func(path string, err error) error) error {
+	selector := newSelector(config)
+	var visited map[fileKey]bool
+	if config.Walk.SkipVisited {
+		visited = map[fileKey]bool{}
+	}
+
+	walkFn := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(path, err)
+		}
+		if config.Walk.Symlinks == SymlinkSkip && d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		if ok, err := selector.visit(src.rel(path), d); !ok {
+			return err
+		}
+		if visited != nil {
+			// Files that cannot be identified are hashed anyway, so reading
+			// them reports the error.
+			if key, err := src.identify(path); err == nil {
+				if visited[key] {
+					return nil
+				}
+				visited[key] = true
+			}
+		}
+		return fn(path, nil)
+	}
+
+	if config.Walk.Symlinks == SymlinkFollow {
+		return src.walkFollow(walkFn, config.Walk.SkipVisited)
+	}
+	return src.walk(walkFn)
+}
+
+// walkFollow is like fs.WalkDir but descends into symbolic links to
+// directories, reporting links to an ancestor with ErrSymlinkCycle. With
+// skipVisited, directories reached again through another link are skipped.
+func (src source) walkFollow(fn fs.WalkDirFunc, skipVisited bool) error {
+	info, err := src.stat(src.root)
+	if err != nil {
+		err = fn(src.root, nil, err)
+	} else {
+		var visited map[fileKey]bool
+		if skipVisited {
+			visited = map[fileKey]bool{}
+		}
+		err = src.walkFollowDir(src.root, fs.FileInfoToDirEntry(info), nil, visited, fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (src source) walkFollowDir(path string, d fs.DirEntry, ancestors []fileKey, visited map[fileKey]bool, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	key, err := src.identify(path)
+	if err != nil {
+		return skipDirErr(fn(path, d, err))
+	}
+	if slices.Contains(ancestors, key) {
+		return skipDirErr(fn(path, d, &fs.PathError{Op: "walk", Path: path, Err: ErrSymlinkCycle}))
+	}
+	if visited != nil {
+		if visited[key] {
+			return nil
+		}
+		visited[key] = true
+	}
+
+	entries, err := src.readDir(path)
+	if err != nil {
+		if err := skipDirErr(fn(path, d, err)); err != nil {
+			return err
+		}
+	}
+
+	ancestors = append(ancestors, key)
+	for _, entry := range entries {
+		child := src.join(path, entry.Name())
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, err := src.stat(child)
+			if err != nil {
+				if err := fn(child, entry, err); err != nil && !errors.Is(err, fs.SkipDir) {
+					return err
+				}
+				continue
+			}
+			entry = fs.FileInfoToDirEntry(info)
+		}
+		if err := src.walkFollowDir(child, entry, ancestors, visited, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// skipDirErr turns fs.SkipDir returned for a directory into nil.
+func skipDirErr(err error) error {
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package perceptualhash
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// ErrNoPairs is returned by CalibrateWeights without both similar and
+// different pairs.
+var ErrNoPairs = errors.New("calibration needs similar and different pairs")
+
+// Weights holds the weight of each bit of a hash in a weighted distance,
+// bit i weighing Weights[i].
+type Weights [64]float64
+
+// FrequencyWeights returns weights for hashes computed with the
+// configuration that make low-frequency coefficients count more.
+// It optionally accepts a custom configuration.
+//
+// Deprecated: Use New and DCTHasher.FrequencyWeights.
+func FrequencyWeights(configs ...Config) Weights {
+	h := &DCTHasher{}
+	if len(configs) > 0 {
+		h.config = configs[0]
+	}
+	return h.FrequencyWeights()
+}
+
+// FrequencyWeights returns weights for hashes computed by h that make
+// low-frequency coefficients, which carry the structure of the image, count
+// more than high-frequency ones, which flip under recompression and noise.
+// The weights average 1 over the bits the hash can set, so weighted
+// distances stay on the scale of Hamming distances. The reserved DC bit
+// weighs 0.
+func (h *DCTHasher) FrequencyWeights() Weights {
+	var w Weights
+	selected, reserved := hashedCoefficients(h.config)
+	for i, c := range selected[:min(len(selected), len(w))] {
+		if i == 0 && reserved {
+			continue
+		}
+		w[i] = 1 / (1 + float64(c.row+c.col)/4)
+	}
+	return w.normalized()
+}
+
+// CalibrateWeights derives weights from labeled pairs of hashes: pairs of
+// copies of the same image, and pairs of different images. Each bit weighs
+// the log-likelihood ratio of it differing between different images rather
+// than between copies, so bits that separate the two best count the most
+// and bits that flip as often either way count nothing. The weights average
+// 1 over the bits that count. It returns ErrNoPairs if either list is
+// empty.
+func CalibrateWeights(similar, different [][2]Hash) (Weights, error) {
+	if len(similar) == 0 || len(different) == 0 {
+		return Weights{}, ErrNoPairs
+	}
+
+	// rates returns the smoothed share of pairs differing at each bit.
+	rates := func(pairs [][2]Hash) [64]float64 {
+		var counts [64]int
+		for _, p := range pairs {
+			diff := p[0] ^ p[1]
+			for i := range counts {
+				counts[i] += int(diff >> i & 1)
+			}
+		}
+		var r [64]float64
+		for i, n := range counts {
+			r[i] = (float64(n) + 0.5) / (float64(len(pairs)) + 1)
+		}
+		return r
+	}
+	same, apart := rates(similar), rates(different)
+
+	var w Weights
+	for i := range w {
+		ratio := apart[i] * (1 - same[i]) / (same[i] * (1 - apart[i]))
+		w[i] = max(math.Log(ratio), 0)
+	}
+	return w.normalized(), nil
+}
+
+// normalized scales w to average 1 over its non-zero weights.
+func (w Weights) normalized() Weights {
+	var sum float64
+	n := 0
+	for _, v := range w {
+		if v > 0 {
+			sum += v
+			n++
+		}
+	}
+	if sum == 0 {
+		return w
+	}
+	for i := range w {
+		w[i] *= float64(n) / sum
+	}
+	return w
+}
+
+// WeightedDistance returns the sum of the weights of the bits that differ
+// between h and other. With uniform weights of 1 it equals Distance.
+func (h Hash) WeightedDistance(other Hash, w *Weights) float64 {
+	var distance float64
+	for diff := uint64(h ^ other); diff != 0; diff &= diff - 1 {
+		distance += w[bits.TrailingZeros64(diff)]
+	}
+	return distance
+}
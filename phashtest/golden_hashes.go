@@ -0,0 +1,163 @@
+package phashtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// GoldenHashes is a golden file of the hashes of a fixture directory, used
+// to catch accidental changes in hashing behavior across releases.
+type GoldenHashes struct {
+	// Version labels the hashing behavior the file was generated with, such
+	// as the release that introduced it. Intentional changes are recorded
+	// by regenerating the file with a new version.
+	Version string `json:"version"`
+	// Hashes maps algorithm names to fixture paths, relative to the fixture
+	// directory and slash-separated, to hashes. Fixtures that fail to hash
+	// map to "error: " followed by the error, since errors are behavior too.
+	Hashes map[string]map[string]string `json:"hashes"`
+}
+
+// HashFixtures computes the hash of every image under dir with each of the
+// named algorithms, or with every registered algorithm if none are named.
+func HashFixtures(dir string, algorithms ...string) (GoldenHashes, error) {
+	if len(algorithms) == 0 {
+		algorithms = perceptualhash.Hashers()
+	}
+
+	hashers := make([]perceptualhash.Hasher, len(algorithms))
+	golden := GoldenHashes{Hashes: map[string]map[string]string{}}
+	for i, name := range algorithms {
+		hasher, err := perceptualhash.Lookup(name)
+		if err != nil {
+			return GoldenHashes{}, fmt.Errorf("%w: %s", err, name)
+		}
+		hashers[i] = hasher
+		golden.Hashes[name] = map[string]string{}
+	}
+
+	for path, err := range new(perceptualhash.DCTHasher).ImagePaths(dir) {
+		if err != nil {
+			return GoldenHashes{}, err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return GoldenHashes{}, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		img, decodeErr := decodeFile(path)
+		for i, hasher := range hashers {
+			err := decodeErr
+			var hash perceptualhash.Hash
+			if err == nil {
+				hash, err = hasher.Hash(img)
+			}
+			if err != nil {
+				golden.Hashes[algorithms[i]][rel] = "error: " + err.Error()
+				continue
+			}
+			golden.Hashes[algorithms[i]][rel] = hash.String()
+		}
+	}
+	return golden, nil
+}
+
+func decodeFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// WriteGoldenHashes writes golden to path as indented JSON with sorted keys,
+// so regenerated files diff cleanly.
+func WriteGoldenHashes(path string, golden GoldenHashes) error {
+	data, err := json.MarshalIndent(golden, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadGoldenHashes reads a file written by WriteGoldenHashes.
+func ReadGoldenHashes(path string) (GoldenHashes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return GoldenHashes{}, err
+	}
+
+	var golden GoldenHashes
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return GoldenHashes{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return golden, nil
+}
+
+// AssertGoldenHashes rehashes the fixtures in dir with the algorithms of
+// the golden file at goldenPath and reports a test error for every hash
+// that changed and every fixture added or removed. With UpdateEnv set, it
+// rewrites the golden file, keeping its version, and always succeeds. It
+// returns whether the assertion held.
+func AssertGoldenHashes(t testing.TB, goldenPath, dir string) bool {
+	t.Helper()
+
+	golden, err := ReadGoldenHashes(goldenPath)
+	if err != nil && !(errors.Is(err, os.ErrNotExist) && os.Getenv(UpdateEnv) != "") {
+		t.Errorf("phashtest: cannot read golden hashes: %v", err)
+		return false
+	}
+
+	actual, err := HashFixtures(dir, slices.Sorted(maps.Keys(golden.Hashes))...)
+	if err != nil {
+		t.Errorf("phashtest: cannot hash fixtures: %v", err)
+		return false
+	}
+	actual.Version = golden.Version
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := WriteGoldenHashes(goldenPath, actual); err != nil {
+			t.Errorf("phashtest: cannot update golden hashes: %v", err)
+			return false
+		}
+		return true
+	}
+
+	ok := true
+	for _, algorithm := range slices.Sorted(maps.Keys(golden.Hashes)) {
+		want, got := golden.Hashes[algorithm], actual.Hashes[algorithm]
+		for _, path := range slices.Sorted(maps.Keys(want)) {
+			switch hash, found := got[path]; {
+			case !found:
+				t.Errorf("phashtest: %s: fixture %s is missing", algorithm, path)
+				ok = false
+			case hash != want[path]:
+				t.Errorf("phashtest: %s: %s hashes to %s, want %s", algorithm, path, hash, want[path])
+				ok = false
+			}
+		}
+		for _, path := range slices.Sorted(maps.Keys(got)) {
+			if _, found := want[path]; !found {
+				t.Errorf("phashtest: %s: fixture %s is not in the golden file", algorithm, path)
+				ok = false
+			}
+		}
+	}
+	if !ok {
+		t.Logf("phashtest: if the changes are intended, regenerate %s with a new version, or run with %s=1", goldenPath, UpdateEnv)
+	}
+	return ok
+}
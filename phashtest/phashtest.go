@@ -0,0 +1,135 @@
+// Package phashtest provides test assertions that compare images by
+// perceptual hash, for screenshot tests that must tolerate antialiasing,
+// font hinting and compression noise that break byte equality.
+package phashtest
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/insomnius/tools/imagemetrics"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// UpdateEnv is the environment variable that makes AssertGolden write the
+// actual image as the new golden file when set to a non-empty value.
+const UpdateEnv = "PHASHTEST_UPDATE"
+
+// Distance returns the number of differing bits between the perceptual
+// hashes of a and b.
+func Distance(a, b image.Image) (int, error) {
+	hashA, err := hash(a)
+	if err != nil {
+		return 0, err
+	}
+	hashB, err := hash(b)
+	if err != nil {
+		return 0, err
+	}
+	return hashA.Distance(hashB), nil
+}
+
+func hash(img image.Image) (perceptualhash.Hash, error) {
+	return new(perceptualhash.DCTHasher).Hash(img)
+}
+
+// AssertSimilar reports a test error unless the hashes of golden and actual
+// are at most maxDistance bits apart. It returns whether the assertion held.
+func AssertSimilar(t testing.TB, golden, actual image.Image, maxDistance int) bool {
+	t.Helper()
+
+	distance, err := Distance(golden, actual)
+	if err != nil {
+		t.Errorf("phashtest: cannot hash images: %v", err)
+		return false
+	}
+	if distance > maxDistance {
+		t.Errorf("phashtest: images differ by %d bits, want at most %d", distance, maxDistance)
+		return false
+	}
+	return true
+}
+
+// AssertDifferent reports a test error unless the hashes of a and b are at
+// least minDistance bits apart, e.g. to check that a UI change is visible.
+// It returns whether the assertion held.
+func AssertDifferent(t testing.TB, a, b image.Image, minDistance int) bool {
+	t.Helper()
+
+	distance, err := Distance(a, b)
+	if err != nil {
+		t.Errorf("phashtest: cannot hash images: %v", err)
+		return false
+	}
+	if distance < minDistance {
+		t.Errorf("phashtest: images differ by %d bits, want at least %d", distance, minDistance)
+		return false
+	}
+	return true
+}
+
+// AssertGolden compares actual against the PNG golden file at goldenPath
+// like AssertSimilar. On failure it writes the actual image and a heatmap of
+// the differences next to the golden file, with ".actual.png" and
+// ".diff.png" suffixes, for inspection. With UpdateEnv set, it writes actual
+// to goldenPath instead and always succeeds. A missing golden file fails the
+// test.
+func AssertGolden(t testing.TB, goldenPath string, actual image.Image, maxDistance int) bool {
+	t.Helper()
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := writePNG(goldenPath, actual); err != nil {
+			t.Errorf("phashtest: cannot update golden file: %v", err)
+			return false
+		}
+		return true
+	}
+
+	golden, err := readPNG(goldenPath)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Errorf("phashtest: golden file %s does not exist; run with %s=1 to create it", goldenPath, UpdateEnv)
+		return false
+	}
+	if err != nil {
+		t.Errorf("phashtest: cannot read golden file: %v", err)
+		return false
+	}
+
+	if AssertSimilar(t, golden, actual, maxDistance) {
+		return true
+	}
+	base := strings.TrimSuffix(goldenPath, ".png")
+	if err := writePNG(base+".actual.png", actual); err != nil {
+		t.Logf("phashtest: cannot write actual image: %v", err)
+	}
+	if err := writePNG(base+".diff.png", imagemetrics.DiffImage(golden, actual)); err != nil {
+		t.Logf("phashtest: cannot write difference image: %v", err)
+	}
+	return false
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
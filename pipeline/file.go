@@ -0,0 +1,175 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Config holds options for Load and Parse.
+type Config struct {
+	// Sources and Sinks name stages built in code, such as a source listing
+	// an object store bucket or an in-memory index, for pipeline files to
+	// refer to with "name".
+	Sources map[string]Source
+	Sinks   map[string]Sink
+}
+
+var defaultConfig = Config{}
+
+// spec is the YAML form of a pipeline:
+//
+//	workers: 8
+//	source:
+//	  dir: photos            # or archive: backup.tar.gz, or name: <source>
+//	  extensions: [.jpg, .png]
+//	  exclude: [cache]
+//	preprocess:
+//	  - crop: 0.05
+//	  - resize: 512
+//	hashes: [phash, dhash]
+//	sinks:
+//	  - report: hashes.jsonl # or "-" for standard output
+//	  - name: catalog
+type spec struct {
+	Workers int `yaml:"workers"`
+	Source  struct {
+		Dir        string   `yaml:"dir"`
+		Archive    string   `yaml:"archive"`
+		Name       string   `yaml:"name"`
+		Extensions []string `yaml:"extensions"`
+		Include    []string `yaml:"include"`
+		Exclude    []string `yaml:"exclude"`
+	} `yaml:"source"`
+	Preprocess []struct {
+		Resize int     `yaml:"resize"`
+		Crop   float64 `yaml:"crop"`
+	} `yaml:"preprocess"`
+	Hashes []string `yaml:"hashes"`
+	Sinks  []struct {
+		Report string `yaml:"report"`
+		Name   string `yaml:"name"`
+	} `yaml:"sinks"`
+}
+
+// Load reads the pipeline declared in the YAML file at path. Relative
+// paths in the file are resolved against its directory. Report files are
+// created by Load and closed when the pipeline run ends.
+// It optionally accepts a custom configuration.
+func Load(path string, configs ...Config) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parse(data, filepath.Dir(path), configs...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse is like Load for a pipeline declaration in memory, with relative
+// paths resolved against the working directory.
+// It optionally accepts a custom configuration.
+func Parse(data []byte, configs ...Config) (*Pipeline, error) {
+	return parse(data, ".", configs...)
+}
+
+func parse(data []byte, dir string, configs ...Config) (*Pipeline, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	var s spec
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPipeline, err)
+	}
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+
+	p := &Pipeline{Workers: s.Workers}
+	selection := perceptualhash.WithWalk(perceptualhash.WalkConfig{Extensions: s.Source.Extensions, Include: s.Source.Include, Exclude: s.Source.Exclude})
+	switch {
+	case s.Source.Dir != "" && s.Source.Archive == "" && s.Source.Name == "":
+		p.Source = Dir(resolve(s.Source.Dir), selection)
+	case s.Source.Archive != "" && s.Source.Dir == "" && s.Source.Name == "":
+		p.Source = Archive(resolve(s.Source.Archive), selection)
+	case s.Source.Name != "" && s.Source.Dir == "" && s.Source.Archive == "":
+		source, ok := config.Sources[s.Source.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown source %q", ErrInvalidPipeline, s.Source.Name)
+		}
+		p.Source = source
+	default:
+		return nil, fmt.Errorf("%w: source needs exactly one of dir, archive and name", ErrInvalidPipeline)
+	}
+
+	for i, step := range s.Preprocess {
+		switch {
+		case step.Resize > 0 && step.Crop == 0:
+			p.Preprocess = append(p.Preprocess, Resize(step.Resize))
+		case step.Crop > 0 && step.Crop < 0.5 && step.Resize == 0:
+			p.Preprocess = append(p.Preprocess, Crop(step.Crop))
+		default:
+			return nil, fmt.Errorf("%w: preprocess step %d needs a positive resize or a crop below 0.5", ErrInvalidPipeline, i+1)
+		}
+	}
+
+	for _, name := range s.Hashes {
+		h, err := perceptualhash.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, name)
+		}
+		p.Hashers = append(p.Hashers, h)
+	}
+
+	for i, sink := range s.Sinks {
+		switch {
+		case sink.Report != "" && sink.Name == "":
+			if sink.Report == "-" {
+				p.Sinks = append(p.Sinks, Report(os.Stdout))
+				continue
+			}
+			f, err := os.Create(resolve(sink.Report))
+			if err != nil {
+				p.close()
+				return nil, err
+			}
+			r := Report(f).(*report)
+			r.closer = f
+			p.Sinks = append(p.Sinks, r)
+		case sink.Name != "" && sink.Report == "":
+			named, ok := config.Sinks[sink.Name]
+			if !ok {
+				p.close()
+				return nil, fmt.Errorf("%w: unknown sink %q", ErrInvalidPipeline, sink.Name)
+			}
+			p.Sinks = append(p.Sinks, named)
+		default:
+			p.close()
+			return nil, fmt.Errorf("%w: sink %d needs exactly one of report and name", ErrInvalidPipeline, i+1)
+		}
+	}
+	return p, nil
+}
+
+// close closes the sinks of a pipeline that will not run.
+func (p *Pipeline) close() {
+	for _, sink := range p.Sinks {
+		sink.Close()
+	}
+}
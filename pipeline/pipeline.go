@@ -0,0 +1,207 @@
+// Package pipeline declares hashing jobs as a chain of stages: a source of
+// image files, preprocessing steps, hash algorithms and sinks receiving the
+// hashes. Pipelines are built in code or loaded from a YAML file.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"iter"
+	"runtime"
+	"sync"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// ErrInvalidPipeline is returned for pipelines missing a stage and for
+// malformed pipeline files.
+var ErrInvalidPipeline = errors.New("invalid pipeline")
+
+// File is an image file yielded by a Source.
+type File struct {
+	Path string
+	Data []byte
+	// Err reports a file that could not be read. It is passed on to the
+	// sinks as a failed Record.
+	Err error
+}
+
+// Source lists the files to hash, such as a directory, an archive or a
+// bucket of an object store.
+type Source interface {
+	// Files lazily yields the files, stopping when ctx is done.
+	Files(ctx context.Context) iter.Seq[File]
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func(ctx context.Context) iter.Seq[File]
+
+// Files calls f.
+func (f SourceFunc) Files(ctx context.Context) iter.Seq[File] {
+	return f(ctx)
+}
+
+// Step transforms a decoded image before it is hashed.
+type Step func(img image.Image) (image.Image, error)
+
+// Record is the outcome of hashing one file.
+type Record struct {
+	Path string
+	// Hashes maps the name of every hasher of the pipeline to the hash of
+	// the file. It is nil if the file failed.
+	Hashes map[string]perceptualhash.Hash
+	Err    error
+}
+
+// Sink receives the records of a pipeline, such as an index or a report.
+// Its methods are called from a single goroutine.
+type Sink interface {
+	// Write receives one record. An error stops the pipeline.
+	Write(r Record) error
+	// Close is called once the pipeline is done, e.g. to flush output.
+	Close() error
+}
+
+// Pipeline hashes the files of a source with one or more algorithms and
+// passes the hashes to its sinks.
+type Pipeline struct {
+	Source Source
+	// Preprocess is applied in order to every decoded image.
+	Preprocess []Step
+	// Hashers compute the hashes of every file. Empty means the default
+	// perceptual hash, "phash".
+	Hashers []perceptualhash.Hasher
+	Sinks   []Sink
+	// Workers is the number of files decoded and hashed concurrently. Zero
+	// means the number of CPUs.
+	Workers int
+}
+
+// Result summarizes a pipeline run.
+type Result struct {
+	Hashed int
+	Failed int
+}
+
+// Run reads every file of the source, decodes it as perceptualhash.Decode
+// does, preprocesses and hashes it, and passes the record to every sink in
+// turn, failed files included. Records arrive in no particular order. The
+// sinks are closed when the run ends; the error is that of the first sink
+// failing, or ctx.Err() if ctx was done before the run finished.
+func (p *Pipeline) Run(ctx context.Context) (Result, error) {
+	if p.Source == nil {
+		return Result{}, fmt.Errorf("%w: no source", ErrInvalidPipeline)
+	}
+	hashers := p.Hashers
+	if len(hashers) == 0 {
+		phash, err := perceptualhash.Lookup("phash")
+		if err != nil {
+			return Result{}, err
+		}
+		hashers = []perceptualhash.Hasher{phash}
+	}
+	workers := p.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	files := make(chan File)
+	go func() {
+		defer close(files)
+		for file := range p.Source.Files(runCtx) {
+			select {
+			case files <- file:
+			case <-runCtx.Done():
+				return
+			}
+		}
+	}()
+
+	records := make(chan Record)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				select {
+				case records <- p.process(file, hashers):
+				case <-runCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(records)
+	}()
+
+	var (
+		result Result
+		err    error
+	)
+	for record := range records {
+		if err != nil {
+			continue
+		}
+		if record.Err != nil {
+			result.Failed++
+		} else {
+			result.Hashed++
+		}
+		for _, sink := range p.Sinks {
+			if err = sink.Write(record); err != nil {
+				cancel()
+				break
+			}
+		}
+	}
+	for _, sink := range p.Sinks {
+		if closeErr := sink.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return result, err
+}
+
+// process decodes, preprocesses and hashes one file.
+func (p *Pipeline) process(file File, hashers []perceptualhash.Hasher) Record {
+	record := Record{Path: file.Path, Err: file.Err}
+	if record.Err != nil {
+		return record
+	}
+
+	img, _, err := perceptualhash.Decode(file.Data)
+	for _, step := range p.Preprocess {
+		if err != nil {
+			break
+		}
+		img, err = step(img)
+	}
+	if err != nil {
+		record.Err = err
+		return record
+	}
+
+	// The hashers share the intermediates of the image.
+	shared := perceptualhash.NewImage(img)
+	record.Hashes = make(map[string]perceptualhash.Hash, len(hashers))
+	for _, h := range hashers {
+		hash, err := shared.HashWith(h)
+		if err != nil {
+			record.Hashes, record.Err = nil, fmt.Errorf("%s: %w", h.Name(), err)
+			return record
+		}
+		record.Hashes[h.Name()] = hash
+	}
+	return record
+}
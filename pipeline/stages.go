@@ -0,0 +1,213 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"image"
+	"image/draw"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+
+	"github.com/insomnius/tools/imgresize"
+	"github.com/insomnius/tools/index"
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Dir returns a source listing the image files under root, selected as by
+// perceptualhash.DCTHasher.ImagePaths with a hasher configured by opts,
+// such as perceptualhash.WithWalk. Invalid options are reported as a failed
+// file.
+func Dir(root string, opts ...perceptualhash.Option) Source {
+	return SourceFunc(func(ctx context.Context) iter.Seq[File] {
+		h, err := perceptualhash.New(opts...)
+		if err != nil {
+			return failed(root, err)
+		}
+		return readPaths(ctx, h.ImagePaths(root), os.ReadFile)
+	})
+}
+
+// FS is like Dir but lists the files under root within fsys, which can be
+// backed by an object store.
+func FS(fsys fs.FS, root string, opts ...perceptualhash.Option) Source {
+	return SourceFunc(func(ctx context.Context) iter.Seq[File] {
+		h, err := perceptualhash.New(opts...)
+		if err != nil {
+			return failed(root, err)
+		}
+		return readPaths(ctx, h.ImagePathsFS(fsys, root), func(path string) ([]byte, error) {
+			return fs.ReadFile(fsys, path)
+		})
+	})
+}
+
+// failed yields a single failed file for path.
+func failed(path string, err error) iter.Seq[File] {
+	return func(yield func(File) bool) {
+		yield(File{Path: path, Err: err})
+	}
+}
+
+// readPaths yields the files at paths, read with readFile.
+func readPaths(ctx context.Context, paths iter.Seq2[string, error], readFile func(string) ([]byte, error)) iter.Seq[File] {
+	return func(yield func(File) bool) {
+		for path, err := range paths {
+			if ctx.Err() != nil {
+				return
+			}
+			file := File{Path: path, Err: err}
+			if err == nil {
+				file.Data, file.Err = readFile(path)
+			}
+			if !yield(file) {
+				return
+			}
+		}
+	}
+}
+
+// Archive returns a source listing the image files in a zip, tar or
+// gzip-compressed tar archive, as perceptualhash.DCTHasher.ArchiveFiles
+// does with a hasher configured by opts. An unreadable archive and invalid
+// options are reported as a failed file.
+func Archive(archivePath string, opts ...perceptualhash.Option) Source {
+	return SourceFunc(func(ctx context.Context) iter.Seq[File] {
+		h, err := perceptualhash.New(opts...)
+		if err != nil {
+			return failed(archivePath, err)
+		}
+		return func(yield func(File) bool) {
+			for file, err := range h.ArchiveFiles(archivePath) {
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					yield(File{Path: archivePath, Err: err})
+					return
+				}
+				data, err := file.Read()
+				if !yield(File{Path: file.Path, Data: data, Err: err}) {
+					return
+				}
+			}
+		}
+	})
+}
+
+// Resize returns a step shrinking images whose width or height exceeds
+// maxSize to fit, keeping their aspect ratio. Smaller images are left as
+// they are.
+func Resize(maxSize int) Step {
+	return func(img image.Image) (image.Image, error) {
+		bounds := img.Bounds()
+		width, height := bounds.Dx(), bounds.Dy()
+		if width <= maxSize && height <= maxSize {
+			return img, nil
+		}
+		if width >= height {
+			width, height = maxSize, max(height*maxSize/width, 1)
+		} else {
+			width, height = max(width*maxSize/height, 1), maxSize
+		}
+		return imgresize.Resize(img, width, height), nil
+	}
+}
+
+// Crop returns a step trimming margin, a fraction of the width and height,
+// from every side of images, e.g. to cut away borders added by a
+// re-uploader.
+func Crop(margin float64) Step {
+	return func(img image.Image) (image.Image, error) {
+		bounds := img.Bounds()
+		dx, dy := int(float64(bounds.Dx())*margin), int(float64(bounds.Dy())*margin)
+		rect := image.Rect(bounds.Min.X+dx, bounds.Min.Y+dy, bounds.Max.X-dx, bounds.Max.Y-dy)
+		if sub, ok := img.(interface {
+			SubImage(r image.Rectangle) image.Image
+		}); ok {
+			return sub.SubImage(rect), nil
+		}
+		cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+		return cropped, nil
+	}
+}
+
+// SinkFunc adapts a function to a Sink with nothing to close.
+type SinkFunc func(r Record) error
+
+// Write calls f.
+func (f SinkFunc) Write(r Record) error {
+	return f(r)
+}
+
+// Close does nothing.
+func (SinkFunc) Close() error {
+	return nil
+}
+
+// Adder is implemented by the index types.
+type Adder interface {
+	Add(e index.Entry)
+}
+
+// Index returns a sink adding the hash computed by the named hasher of
+// every hashed file to ix, with the file path as ID.
+func Index(ix Adder, hasher string) Sink {
+	return SinkFunc(func(r Record) error {
+		if hash, ok := r.Hashes[hasher]; ok {
+			ix.Add(index.Entry{ID: r.Path, Hash: hash})
+		}
+		return nil
+	})
+}
+
+// Report returns a sink writing every record to w as a line of JSON, with
+// the hashes in hexadecimal and failures as an error message.
+func Report(w io.Writer) Sink {
+	return &report{w: bufio.NewWriter(w)}
+}
+
+type report struct {
+	w *bufio.Writer
+	// closer is the file the report was opened on by Load, if any.
+	closer io.Closer
+}
+
+// reportLine is the JSON form of a Record.
+type reportLine struct {
+	Path   string            `json:"path"`
+	Hashes map[string]string `json:"hashes,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+func (r *report) Write(record Record) error {
+	line := reportLine{Path: record.Path}
+	if record.Err != nil {
+		line.Error = record.Err.Error()
+	}
+	if len(record.Hashes) > 0 {
+		line.Hashes = make(map[string]string, len(record.Hashes))
+		for name, hash := range record.Hashes {
+			line.Hashes[name] = hash.String()
+		}
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	r.w.Write(data)
+	return r.w.WriteByte('\n')
+}
+
+func (r *report) Close() error {
+	err := r.w.Flush()
+	if r.closer != nil {
+		if closeErr := r.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
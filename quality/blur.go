@@ -0,0 +1,37 @@
+package quality
+
+import "image"
+
+// BlurScore returns the variance of the Laplacian of img's luma, a measure
+// of sharpness: blurry images have few strong edges and score low. Scores are
+// only comparable between images of similar content, such as the copies in a
+// duplicate cluster; set Config.Size when their resolutions differ.
+// It optionally accepts a custom configuration.
+func BlurScore(img image.Image, configs ...Config) (float64, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	g, err := gray(img, config)
+	if err != nil {
+		return 0, err
+	}
+	w, h := g.Bounds().Dx(), g.Bounds().Dy()
+	if w < 3 || h < 3 {
+		return 0, nil
+	}
+
+	var sum, sumSquares float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*g.Stride + x
+			laplacian := float64(g.Pix[i-1]) + float64(g.Pix[i+1]) + float64(g.Pix[i-g.Stride]) + float64(g.Pix[i+g.Stride]) - 4*float64(g.Pix[i])
+			sum += laplacian
+			sumSquares += laplacian * laplacian
+		}
+	}
+	n := float64((w - 2) * (h - 2))
+	mean := sum / n
+	return sumSquares/n - mean*mean, nil
+}
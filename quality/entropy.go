@@ -0,0 +1,51 @@
+package quality
+
+import (
+	"image"
+	"math"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// entropySize is the side of the grid images are reduced to before
+// measuring contrast, the working size of perceptual hashes, so noise and
+// compression artifacts that a hash never sees are averaged out.
+const entropySize = 32
+
+// Contrast returns the standard deviation of img's luma after reducing it to
+// 32x32, on a 0-255 scale. Solid backgrounds and blank pages score near zero,
+// even when noisy or compressed.
+func Contrast(img image.Image) (float64, error) {
+	if img.Bounds().Empty() {
+		return 0, ErrEmptyImage
+	}
+
+	small := imgresize.Gray(img, entropySize, entropySize)
+
+	var sum, sumSquares float64
+	for _, v := range small.Pix {
+		sum += float64(v)
+		sumSquares += float64(v) * float64(v)
+	}
+	n := float64(len(small.Pix))
+	mean := sum / n
+	return math.Sqrt(max(sumSquares/n-mean*mean, 0)), nil
+}
+
+// LowEntropy reports whether img is so close to uniform that its perceptual
+// hash is meaningless and would match those of other near-uniform images,
+// i.e. whether its Contrast is below Config.MinContrast. Matchers should
+// exclude such images.
+// It optionally accepts a custom configuration.
+func LowEntropy(img image.Image, configs ...Config) (bool, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	contrast, err := Contrast(img)
+	if err != nil {
+		return false, err
+	}
+	return contrast < config.MinContrast, nil
+}
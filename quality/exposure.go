@@ -0,0 +1,39 @@
+package quality
+
+import "image"
+
+// Exposure returns a score from 0 to 1 of how well img is exposed: the
+// fraction of pixels whose luma is neither crushed to black nor blown to
+// white, reduced as the mean luma moves away from mid-gray. Scores are only
+// comparable between images of similar content, such as the frames of a
+// burst.
+// It optionally accepts a custom configuration.
+func Exposure(img image.Image, configs ...Config) (float64, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	g, err := gray(img, config)
+	if err != nil {
+		return 0, err
+	}
+	w, h := g.Bounds().Dx(), g.Bounds().Dy()
+
+	var sum, clipped int
+	for y := range h {
+		for _, v := range g.Pix[y*g.Stride : y*g.Stride+w] {
+			sum += int(v)
+			if v < 8 || v > 247 {
+				clipped++
+			}
+		}
+	}
+	n := float64(w * h)
+	mean := float64(sum) / n
+	offset := mean - 128
+	if offset < 0 {
+		offset = -offset
+	}
+	return (1 - float64(clipped)/n) * (1 - offset/256), nil
+}
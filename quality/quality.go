@@ -0,0 +1,39 @@
+// Package quality scores single images, for choosing between copies of the
+// same picture or excluding images unfit for matching.
+package quality
+
+import (
+	"errors"
+	"image"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// Config holds options for quality measurements.
+type Config struct {
+	// Size, if positive, resizes images so their longer side is Size pixels
+	// before measuring, so copies at different resolutions score alike.
+	// Zero measures at native resolution.
+	Size int
+	// MinContrast is the Contrast below which LowEntropy flags an image.
+	MinContrast float64
+}
+
+var defaultConfig = Config{
+	MinContrast: 2,
+}
+
+var ErrEmptyImage = errors.New("image has no pixels")
+
+// gray converts img to grayscale, resized according to config.
+func gray(img image.Image, config Config) (*image.Gray, error) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, ErrEmptyImage
+	}
+
+	if config.Size <= 0 {
+		return imgresize.Gray(img, bounds.Dx(), bounds.Dy()), nil
+	}
+	return imgresize.Gray(img, config.Size, config.Size, imgresize.Config{Mode: imgresize.Fit}), nil
+}
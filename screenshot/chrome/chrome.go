@@ -0,0 +1,108 @@
+// Package chrome renders web pages for package screenshot with headless
+// Chrome, driven through the DevTools protocol.
+package chrome
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Config holds options for a Renderer.
+type Config struct {
+	// Width and Height are the viewport size in CSS pixels.
+	Width  int
+	Height int
+	// FullPage captures the whole page instead of the viewport.
+	FullPage bool
+	// Settle is the time waited after the page loaded, for late scripts and
+	// web fonts to finish rendering.
+	Settle time.Duration
+	// ExecPath is the Chrome executable. Empty means the first one found
+	// in the usual locations.
+	ExecPath string
+}
+
+var defaultConfig = Config{
+	Width:  1280,
+	Height: 800,
+	Settle: time.Second,
+}
+
+// Renderer is a headless Chrome instance rendering every page in a new tab.
+// It implements screenshot.Renderer and is safe for concurrent use.
+type Renderer struct {
+	config  Config
+	browser context.Context
+
+	mu     sync.Mutex
+	cancel []context.CancelFunc
+}
+
+// New starts headless Chrome.
+// It optionally accepts a custom configuration.
+func New(configs ...Config) (*Renderer, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.WindowSize(config.Width, config.Height))
+	if config.ExecPath != "" {
+		opts = append(opts, chromedp.ExecPath(config.ExecPath))
+	}
+	allocator, cancelAllocator := chromedp.NewExecAllocator(context.Background(), opts...)
+	browser, cancelBrowser := chromedp.NewContext(allocator)
+	r := &Renderer{config: config, browser: browser, cancel: []context.CancelFunc{cancelBrowser, cancelAllocator}}
+
+	// Running no actions starts the browser.
+	if err := chromedp.Run(browser); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Render loads url in a new tab and returns a screenshot of it.
+func (r *Renderer) Render(ctx context.Context, url string) (image.Image, error) {
+	tab, cancel := chromedp.NewContext(r.browser)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	var data []byte
+	capture := chromedp.CaptureScreenshot(&data)
+	if r.config.FullPage {
+		capture = chromedp.FullScreenshot(&data, 100)
+	}
+	err := chromedp.Run(tab,
+		chromedp.EmulateViewport(int64(r.config.Width), int64(r.config.Height)),
+		chromedp.Navigate(url),
+		chromedp.Sleep(r.config.Settle),
+		capture,
+	)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// Close stops Chrome.
+func (r *Renderer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, cancel := range r.cancel {
+		cancel()
+	}
+	r.cancel = nil
+	return nil
+}
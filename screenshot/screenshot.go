@@ -0,0 +1,91 @@
+// Package screenshot hashes web pages as rendered, so cloned and phishing
+// pages that visually copy a site can be found by their distance to it,
+// whatever their markup. Pages are rendered by a pluggable Renderer; package
+// chrome provides one driving headless Chrome.
+package screenshot
+
+import (
+	"context"
+	"errors"
+	"image"
+	"time"
+
+	"github.com/insomnius/tools/perceptualhash"
+)
+
+// Renderer captures a screenshot of a web page.
+type Renderer interface {
+	Render(ctx context.Context, url string) (image.Image, error)
+}
+
+// RendererFunc adapts a function to a Renderer.
+type RendererFunc func(ctx context.Context, url string) (image.Image, error)
+
+// Render calls f.
+func (f RendererFunc) Render(ctx context.Context, url string) (image.Image, error) {
+	return f(ctx, url)
+}
+
+// Config holds options for Capture.
+type Config struct {
+	// Timeout bounds rendering a page. Zero means no limit.
+	Timeout time.Duration
+	// Hasher computes the perceptual hash, which must match that of the
+	// screenshots compared against. Nil means the default configuration.
+	Hasher *perceptualhash.DCTHasher
+}
+
+var defaultConfig = Config{
+	Timeout: 30 * time.Second,
+}
+
+// ErrEmptyScreenshot is returned for renderers returning an empty image.
+var ErrEmptyScreenshot = errors.New("screenshot is empty")
+
+// Shot is a hashed screenshot of a page.
+type Shot struct {
+	URL   string
+	Image image.Image
+	// Hash is the perceptual hash of the screenshot, and Color its
+	// perceptualhash.ColorHash, telling apart pages with the same layout in
+	// other brand colors.
+	Hash  perceptualhash.Hash
+	Color perceptualhash.Hash
+}
+
+// Distance returns the Hamming distance between the hashes of s and other.
+func (s Shot) Distance(other Shot) int {
+	return s.Hash.Distance(other.Hash)
+}
+
+// Capture renders the page at url with r and hashes the screenshot.
+// It optionally accepts a custom configuration.
+func Capture(ctx context.Context, r Renderer, url string, configs ...Config) (Shot, error) {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	img, err := r.Render(ctx, url)
+	if err != nil {
+		return Shot{}, err
+	}
+	if img == nil || img.Bounds().Empty() {
+		return Shot{}, ErrEmptyScreenshot
+	}
+
+	hasher := config.Hasher
+	if hasher == nil {
+		hasher = new(perceptualhash.DCTHasher)
+	}
+	hash, err := hasher.Hash(img)
+	if err != nil {
+		return Shot{}, err
+	}
+	return Shot{URL: url, Image: img, Hash: hash, Color: perceptualhash.ColorHash(img)}, nil
+}
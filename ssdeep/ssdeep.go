@@ -0,0 +1,276 @@
+// Package ssdeep provides context-triggered piecewise hashing (CTPH) compatible
+// with the ssdeep tool, for fuzzy matching of documents and binaries.
+package ssdeep
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	rollingWindow = 7
+	minBlockSize  = 3
+	spamsumLength = 64
+	hashPrime     = 0x01000193
+	hashInit      = 0x28021967
+	b64           = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+var ErrInvalidSignature = errors.New("invalid ssdeep signature")
+
+// rollingHash is the rolling checksum used to find trigger points.
+type rollingHash struct {
+	window     [rollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *rollingHash) roll(c byte) {
+	r.h2 -= r.h1
+	r.h2 += rollingWindow * uint32(c)
+
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%rollingWindow])
+
+	r.window[r.n%rollingWindow] = c
+	r.n++
+
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+}
+
+func (r *rollingHash) sum() uint32 {
+	return r.h1 + r.h2 + r.h3
+}
+
+// sumHash is the FNV-style hash accumulated between trigger points.
+func sumHash(c byte, h uint32) uint32 {
+	return (h * hashPrime) ^ uint32(c)
+}
+
+// FromPath computes the ssdeep signature of the file at filePath.
+func FromPath(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return FromReader(f)
+}
+
+// FromReader computes the ssdeep signature of everything read from r.
+func FromReader(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return FromBytes(data), nil
+}
+
+// FromBytes computes the ssdeep signature of data.
+// The result has the form "blocksize:signature:doubleSignature".
+func FromBytes(data []byte) string {
+	blockSize := uint32(minBlockSize)
+	for blockSize*spamsumLength < uint32(len(data)) {
+		blockSize *= 2
+	}
+
+	for {
+		sig1, sig2 := digest(data, blockSize)
+		if blockSize > minBlockSize && len(sig1) < spamsumLength/2 {
+			blockSize /= 2
+			continue
+		}
+		return fmt.Sprintf("%d:%s:%s", blockSize, sig1, sig2)
+	}
+}
+
+// digest computes the signatures for blockSize and blockSize*2 in one pass.
+func digest(data []byte, blockSize uint32) (string, string) {
+	var (
+		roll   rollingHash
+		sig1   = make([]byte, 0, spamsumLength)
+		sig2   = make([]byte, 0, spamsumLength/2)
+		h1     = uint32(hashInit)
+		h2     = uint32(hashInit)
+		rolled uint32
+	)
+
+	for _, c := range data {
+		roll.roll(c)
+		rolled = roll.sum()
+		h1 = sumHash(c, h1)
+		h2 = sumHash(c, h2)
+
+		if rolled%blockSize == blockSize-1 {
+			sig1 = appendOrReplace(sig1, b64[h1%64], spamsumLength)
+			if len(sig1) < spamsumLength {
+				h1 = hashInit
+			}
+		}
+		if rolled%(blockSize*2) == blockSize*2-1 {
+			sig2 = appendOrReplace(sig2, b64[h2%64], spamsumLength/2)
+			if len(sig2) < spamsumLength/2 {
+				h2 = hashInit
+			}
+		}
+	}
+
+	if rolled != 0 {
+		sig1 = appendOrReplace(sig1, b64[h1%64], spamsumLength)
+		sig2 = appendOrReplace(sig2, b64[h2%64], spamsumLength/2)
+	}
+
+	return string(sig1), string(sig2)
+}
+
+// appendOrReplace appends c to sig, or overwrites the final character once
+// sig has reached limit, matching the reference implementation.
+func appendOrReplace(sig []byte, c byte, limit int) []byte {
+	if len(sig) < limit {
+		return append(sig, c)
+	}
+	sig[limit-1] = c
+	return sig
+}
+
+// Compare returns a match score between 0 (no match) and 100 (identical)
+// for two ssdeep signatures.
+func Compare(signature1, signature2 string) (int, error) {
+	bs1, s1a, s1b, err := parse(signature1)
+	if err != nil {
+		return 0, err
+	}
+	bs2, s2a, s2b, err := parse(signature2)
+	if err != nil {
+		return 0, err
+	}
+
+	if bs1 != bs2 && bs1 != bs2*2 && bs2 != bs1*2 {
+		return 0, nil
+	}
+
+	s1a, s1b = eliminateSequences(s1a), eliminateSequences(s1b)
+	s2a, s2b = eliminateSequences(s2a), eliminateSequences(s2b)
+
+	if bs1 == bs2 && s1a == s2a {
+		return 100, nil
+	}
+
+	switch {
+	case bs1 == bs2:
+		return max(scoreStrings(s1a, s2a, bs1), scoreStrings(s1b, s2b, bs1*2)), nil
+	case bs1 == bs2*2:
+		return scoreStrings(s1a, s2b, bs1), nil
+	default:
+		return scoreStrings(s1b, s2a, bs2), nil
+	}
+}
+
+// parse splits a signature into its block size and two signature parts.
+func parse(signature string) (uint64, string, string, error) {
+	parts := strings.SplitN(signature, ":", 3)
+	if len(parts) != 3 {
+		return 0, "", "", ErrInvalidSignature
+	}
+
+	blockSize, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || blockSize == 0 {
+		return 0, "", "", ErrInvalidSignature
+	}
+
+	// ssdeep output lines may carry a trailing ,"filename" column.
+	second, _, _ := strings.Cut(parts[2], ",")
+
+	return blockSize, parts[1], second, nil
+}
+
+// eliminateSequences collapses runs of more than three identical characters,
+// which carry little information and would inflate scores.
+func eliminateSequences(s string) string {
+	if len(s) <= 3 {
+		return s
+	}
+
+	out := []byte(s[:3])
+	for i := 3; i < len(s); i++ {
+		if s[i] != s[i-1] || s[i] != s[i-2] || s[i] != s[i-3] {
+			out = append(out, s[i])
+		}
+	}
+	return string(out)
+}
+
+// scoreStrings computes the match score of two signature parts taken at the
+// same block size.
+func scoreStrings(s1, s2 string, blockSize uint64) int {
+	if len(s1) > spamsumLength || len(s2) > spamsumLength {
+		return 0
+	}
+	if !hasCommonSubstring(s1, s2) {
+		return 0
+	}
+
+	score := editDistance(s1, s2)
+	score = score * spamsumLength / (len(s1) + len(s2))
+	score = 100 * score / spamsumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+
+	// Small block sizes produce short signatures whose scores are capped so
+	// that tiny inputs cannot claim a strong match.
+	if blockSize >= (99+rollingWindow)/rollingWindow*minBlockSize {
+		return score
+	}
+	if limit := int(blockSize) / minBlockSize * min(len(s1), len(s2)); score > limit {
+		return limit
+	}
+	return score
+}
+
+// hasCommonSubstring reports whether s1 and s2 share a substring of at least
+// rollingWindow characters.
+func hasCommonSubstring(s1, s2 string) bool {
+	if len(s1) < rollingWindow || len(s2) < rollingWindow {
+		return false
+	}
+
+	for i := 0; i+rollingWindow <= len(s1); i++ {
+		if strings.Contains(s2, s1[i:i+rollingWindow]) {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance computes the weighted Levenshtein distance used by ssdeep:
+// insertions and deletions cost 1, substitutions cost 2.
+func editDistance(s1, s2 string) int {
+	prev := make([]int, len(s2)+1)
+	curr := make([]int, len(s2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s1); i++ {
+		curr[0] = i
+		for j := 1; j <= len(s2); j++ {
+			cost := 2
+			if s1[i-1] == s2[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(s2)]
+}
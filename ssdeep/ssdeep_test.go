@@ -0,0 +1,93 @@
+package ssdeep_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/insomnius/tools/ssdeep"
+)
+
+// The reference digests and scores below are those of the ssdeep tool, as
+// recorded in the test data of github.com/glaslos/ssdeep. The inputs are
+// consecutive reads from math/rand seeded with 1, so they need no files.
+
+// referenceDigests maps input sizes to their digests. The sizes are those
+// of the recorded inputs, every one of which is read from the stream in
+// order.
+var referenceDigests = map[int]string{
+	4097:    "96:yNDH/iNQaSXRLmOSxu1aQP4iWgC8JbkiA5Ix:yNLaNQhSxEgVYkiA5Ix",
+	45056:   "768:mlHmRZnCRFRwSuK/UiwY37TMbsDEsb1Jqi6dcXoWpKXIUxpQDOAvWpPK:mqhCJwjmJD31DzbDwd+oGo9AvOi",
+	86016:   "1536:Jdr3F6yZG0agLg/b6G6REjI+WUhWDKRSpzKjSUT4plmjvX6ex7RwdsHIGV:PrVbZG0BuuGzc+WcdRilmbPx7RwGV",
+	495616:  "12288:sMI4vQyepN1wYIcogaYLQoskJi8LQLhgVtClNHV7+Mb9tkwE:sMI4vQJ8Yyg3L3skJDL+gVtCJ+MbEwE",
+	1028096: "24576:qT76nF87MgyEabDTU2p5GlSnlFRt+yUiZZ5qOaH:46nF82EagW5zvRt7UiL0H",
+}
+
+func TestFromBytesReference(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for step := 4096; step <= 1028096; step += 40960 {
+		size := step
+		if size == 4096 {
+			// The first recorded input is one byte longer than the step.
+			size++
+		}
+		data := make([]byte, size)
+		r.Read(data)
+		want, ok := referenceDigests[size]
+		if !ok {
+			continue
+		}
+		if got := ssdeep.FromBytes(data); got != want {
+			t.Errorf("FromBytes(%d random bytes) = %s, want %s", size, got, want)
+		}
+	}
+}
+
+func TestCompareReference(t *testing.T) {
+	tests := []struct {
+		signature1, signature2 string
+		score                  int
+	}{
+		{
+			"192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt",
+			"192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt",
+			100,
+		},
+		{
+			"192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt",
+			"192:JkjRcePWsNVQza3ntZStn5VfsoXMhRD9+xJMinqF6+wNQ7Q40L/i737rPVt:JkjlQyIrx+kll2",
+			35,
+		},
+		{
+			"196608:pDSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN/JNnQrmhnUPI+/n2Yr:5DHoJXv7XOq7Mb2TwYHXREN/3QrmktPd",
+			"196608:7DSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN/JNnQrmhnUPI+/n2Y7:3DHoJXv7XOq7Mb2TwYHXREN/3QrmktPt",
+			97,
+		},
+		{
+			"24:YDVLfsT1ds/1H9Wpgq7n4XMijV6h4Z3QCw4qat:YD51H9CiMuV6uACwVat",
+			"24:YDVLfyvDj+C+opg8DV0Mdle6hPZ3QCw4qat:YDMvDj+C+kBOM+6HACwVat",
+			54,
+		},
+		{
+			// Unrelated block sizes cannot be compared.
+			referenceDigests[4097],
+			referenceDigests[86016],
+			0,
+		},
+	}
+	for _, test := range tests {
+		score, err := ssdeep.Compare(test.signature1, test.signature2)
+		if err != nil {
+			t.Errorf("Compare(%s, %s): %v", test.signature1, test.signature2, err)
+			continue
+		}
+		if score != test.score {
+			t.Errorf("Compare(%s, %s) = %d, want %d", test.signature1, test.signature2, score, test.score)
+		}
+	}
+}
+
+func TestCompareInvalid(t *testing.T) {
+	if _, err := ssdeep.Compare("", referenceDigests[4097]); err == nil {
+		t.Error("Compare accepted an empty signature")
+	}
+}
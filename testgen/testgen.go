@@ -0,0 +1,149 @@
+// Package testgen derives randomly perturbed variants of images for
+// property-style tests, such as checking that hashes stay within a distance
+// under crops of up to 20%. Variants are drawn from a seeded generator, so a
+// failing case reproduces exactly across runs and machines.
+package testgen
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"math/rand/v2"
+	"os"
+	"strconv"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// SeedEnv is the environment variable Seed reads, so a failing property
+// test can be rerun with the seed it logged.
+const SeedEnv = "TESTGEN_SEED"
+
+// Seed returns the seed in SeedEnv if it is set to an unsigned integer, and
+// fallback otherwise.
+func Seed(fallback uint64) uint64 {
+	if seed, err := strconv.ParseUint(os.Getenv(SeedEnv), 10, 64); err == nil {
+		return seed
+	}
+	return fallback
+}
+
+// Generator draws image variants. Equal seeds yield equal sequences of
+// variants on every platform. A Generator is not safe for concurrent use.
+type Generator struct {
+	seed uint64
+	rng  *rand.Rand
+}
+
+// New returns a generator seeded with seed.
+func New(seed uint64) *Generator {
+	return &Generator{seed: seed, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Seed returns the seed g was created with, for logging with failures.
+func (g *Generator) Seed() uint64 {
+	return g.seed
+}
+
+// Augmentation derives a variant of an image using the randomness of g.
+type Augmentation func(g *Generator, img image.Image) image.Image
+
+// Variants returns n variants of img, each produced by applying augs in
+// order.
+func (g *Generator) Variants(img image.Image, n int, augs ...Augmentation) []image.Image {
+	variants := make([]image.Image, n)
+	for i := range variants {
+		variant := img
+		for _, aug := range augs {
+			variant = aug(g, variant)
+		}
+		variants[i] = variant
+	}
+	return variants
+}
+
+// Crop returns an augmentation removing a random fraction of up to
+// maxFraction of the width and of the height, split randomly between the
+// opposite edges.
+func Crop(maxFraction float64) Augmentation {
+	return func(g *Generator, img image.Image) image.Image {
+		b := img.Bounds()
+		dx := int(g.rng.Float64() * maxFraction * float64(b.Dx()))
+		dy := int(g.rng.Float64() * maxFraction * float64(b.Dy()))
+		left := g.rng.IntN(dx + 1)
+		top := g.rng.IntN(dy + 1)
+		r := image.Rect(b.Min.X+left, b.Min.Y+top, b.Max.X-(dx-left), b.Max.Y-(dy-top))
+
+		dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+		return dst
+	}
+}
+
+// Scale returns an augmentation resizing by a random factor between low
+// and high.
+func Scale(low, high float64) Augmentation {
+	return func(g *Generator, img image.Image) image.Image {
+		factor := low + g.rng.Float64()*(high-low)
+		b := img.Bounds()
+		width := int(float64(b.Dx())*factor + 0.5)
+		height := int(float64(b.Dy())*factor + 0.5)
+		return imgresize.Resize(img, width, height)
+	}
+}
+
+// Brightness returns an augmentation adding a random offset of up to
+// maxDelta in either direction to every channel.
+func Brightness(maxDelta int) Augmentation {
+	return func(g *Generator, img image.Image) image.Image {
+		delta := g.rng.IntN(2*maxDelta+1) - maxDelta
+		return mapPixels(img, func(v uint8) uint8 {
+			return clamp(int(v) + delta)
+		})
+	}
+}
+
+// Noise returns an augmentation adding Gaussian noise with the given
+// standard deviation to every channel.
+func Noise(stdDev float64) Augmentation {
+	return func(g *Generator, img image.Image) image.Image {
+		return mapPixels(img, func(v uint8) uint8 {
+			return clamp(int(float64(v) + g.rng.NormFloat64()*stdDev + 0.5))
+		})
+	}
+}
+
+// JPEG returns an augmentation recompressing as JPEG with a random quality
+// between minQuality and maxQuality.
+func JPEG(minQuality, maxQuality int) Augmentation {
+	return func(g *Generator, img image.Image) image.Image {
+		quality := minQuality + g.rng.IntN(maxQuality-minQuality+1)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return img
+		}
+		decoded, err := jpeg.Decode(&buf)
+		if err != nil {
+			return img
+		}
+		return decoded
+	}
+}
+
+// mapPixels applies fn to the color channels of every pixel, keeping alpha.
+func mapPixels(img image.Image, fn func(uint8) uint8) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = fn(dst.Pix[i])
+		dst.Pix[i+1] = fn(dst.Pix[i+1])
+		dst.Pix[i+2] = fn(dst.Pix[i+2])
+	}
+	return dst
+}
+
+func clamp(v int) uint8 {
+	return uint8(max(0, min(v, 255)))
+}
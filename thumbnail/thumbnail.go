@@ -0,0 +1,161 @@
+// Package thumbnail provides consistent thumbnail generation for reports and
+// user interfaces built on the hashing packages.
+package thumbnail
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/insomnius/tools/imgresize"
+)
+
+// Filter selects the resampling quality.
+type Filter = imgresize.Filter
+
+// Filters, see the imgresize package.
+const (
+	CatmullRom      = imgresize.CatmullRom
+	BiLinear        = imgresize.BiLinear
+	ApproxBiLinear  = imgresize.ApproxBiLinear
+	NearestNeighbor = imgresize.NearestNeighbor
+	Box             = imgresize.Box
+)
+
+// Config holds thumbnail generation options.
+type Config struct {
+	// Width and Height bound the thumbnail; the aspect ratio is preserved.
+	Width  int
+	Height int
+	Filter Filter
+	// Sharpen is the strength of an unsharp mask applied after resizing,
+	// typically between 0.2 and 1. Zero disables sharpening.
+	Sharpen float64
+	// Format is the encoding used by Write: "jpeg", "png", or any format
+	// added with RegisterEncoder, such as "webp".
+	Format string
+	// Quality is the JPEG quality, from 1 to 100.
+	Quality int
+}
+
+var defaultConfig = Config{
+	Width:   256,
+	Height:  256,
+	Filter:  CatmullRom,
+	Format:  "jpeg",
+	Quality: 85,
+}
+
+var ErrUnsupportedFormat = errors.New("thumbnail format is not supported")
+
+// EncodeFunc encodes a thumbnail in a specific format.
+type EncodeFunc func(w io.Writer, img image.Image, config Config) error
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]EncodeFunc{
+		"jpeg": func(w io.Writer, img image.Image, config Config) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: config.Quality})
+		},
+		"png": func(w io.Writer, img image.Image, config Config) error {
+			return png.Encode(w, img)
+		},
+	}
+)
+
+// RegisterEncoder adds or replaces the encoder for format. The standard
+// library has no WebP encoder, so WebP output requires registering one.
+func RegisterEncoder(format string, encode EncodeFunc) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	encoders[format] = encode
+}
+
+// Generate returns img resized to fit within the configured bounds.
+// It optionally accepts a custom configuration.
+func Generate(img image.Image, configs ...Config) image.Image {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	thumb := imgresize.Resize(img, config.Width, config.Height, imgresize.Config{
+		Filter:    config.Filter,
+		Mode:      imgresize.Fit,
+		NoUpscale: true,
+	})
+
+	if config.Sharpen > 0 {
+		sharpen(thumb, config.Sharpen)
+	}
+	return thumb
+}
+
+// Write generates a thumbnail of img and encodes it to w.
+// It optionally accepts a custom configuration.
+func Write(w io.Writer, img image.Image, configs ...Config) error {
+	config := defaultConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	encodersMu.RLock()
+	encode, ok := encoders[config.Format]
+	encodersMu.RUnlock()
+	if !ok {
+		return ErrUnsupportedFormat
+	}
+
+	return encode(w, Generate(img, config), config)
+}
+
+// FromPath decodes the image at filePath and writes its thumbnail to w.
+// It optionally accepts a custom configuration.
+func FromPath(filePath string, w io.Writer, configs ...Config) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+	return Write(w, img, configs...)
+}
+
+// sharpen applies an unsharp mask with a 3x3 box blur in place.
+func sharpen(img *image.RGBA, amount float64) {
+	bounds := img.Bounds()
+	src := make([]uint8, len(img.Pix))
+	copy(src, img.Pix)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			offset := img.PixOffset(x, y)
+			for c := range 3 {
+				var sum, count float64
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := x+dx, y+dy
+						if nx < bounds.Min.X || nx >= bounds.Max.X || ny < bounds.Min.Y || ny >= bounds.Max.Y {
+							continue
+						}
+						sum += float64(src[img.PixOffset(nx, ny)+c])
+						count++
+					}
+				}
+
+				original := float64(src[offset+c])
+				value := original + amount*(original-sum/count)
+				img.Pix[offset+c] = uint8(min(max(value+0.5, 0), 255))
+			}
+		}
+	}
+}